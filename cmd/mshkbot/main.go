@@ -2,18 +2,24 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
 	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/callback"
+	"github.com/sukalov/mshkbot/internal/conversation"
 	"github.com/sukalov/mshkbot/internal/cron"
 	"github.com/sukalov/mshkbot/internal/db"
 	"github.com/sukalov/mshkbot/internal/handlers/admingroup"
 	"github.com/sukalov/mshkbot/internal/handlers/maingroup"
 	"github.com/sukalov/mshkbot/internal/handlers/privatechat"
+	"github.com/sukalov/mshkbot/internal/lichessauth"
+	"github.com/sukalov/mshkbot/internal/redis"
 	"github.com/sukalov/mshkbot/internal/utils"
 )
 
@@ -39,19 +45,75 @@ func main() {
 		log.Fatalf("invalid ADMIN_GROUP_ID: %v", err)
 	}
 
+	// inline buttons are signed, a fixed secret keeps them working when the bot token is rotated
+	callbackSecret := callback.Secret(env["BOT_TOKEN"])
+	if secret := os.Getenv("CALLBACK_SECRET"); secret != "" {
+		callbackSecret = []byte(secret)
+	}
+	callback.Configure(callbackSecret, callback.DefaultTTL)
+	conversation.Configure(redis.KeyValue{})
+
+	// load otb rating lists if configured
+	if path := os.Getenv("FIDE_RATING_LIST"); path != "" {
+		count, err := utils.LoadFideList(path)
+		if err != nil {
+			log.Printf("failed to load fide rating list: %v", err)
+		} else {
+			log.Printf("loaded %d players from fide rating list", count)
+		}
+	}
+	if path := os.Getenv("RCF_RATING_LIST"); path != "" {
+		count, err := utils.LoadRcfList(path)
+		if err != nil {
+			log.Printf("failed to load rcf rating list: %v", err)
+		} else {
+			log.Printf("loaded %d players from rcf rating list", count)
+		}
+	}
+
 	// create bot instance
 	botInstance, err := bot.New("mshkbot", env["BOT_TOKEN"], mainGroupID, adminGroupID)
 	if err != nil {
 		log.Fatalf("failed to create bot: %v", err)
 	}
 
+	// shared processing for every update, logging and metrics see recovered panics as errors
+	botInstance.Use(
+		bot.Logging(),
+		bot.CollectMetrics(),
+		bot.Recover(),
+		bot.Timeout(30*time.Second),
+	)
+
 	// create scheduler
 	scheduler := cron.New(botInstance, mainGroupID, adminGroupID)
 
 	// get handlers from each package
 	mainGroupHandlers := maingroup.GetHandlers()
 	adminGroupHandlers := admingroup.GetHandlers(scheduler)
-	privateHandlers := privatechat.GetHandlers()
+	// lichess oauth login is optional and needs a public callback url
+	var lichessAuth *lichessauth.Provider
+	if clientID, redirectURL := os.Getenv("LICHESS_OAUTH_CLIENT_ID"), os.Getenv("LICHESS_OAUTH_REDIRECT_URL"); clientID != "" && redirectURL != "" {
+		lichessAuth = lichessauth.New(lichessauth.Config{
+			BaseURL:     os.Getenv("LICHESS_OAUTH_BASE_URL"),
+			ClientID:    clientID,
+			RedirectURL: redirectURL,
+		})
+		lichessAuth.SetVerifiedHandler(privatechat.LichessVerifiedHandler(botInstance))
+
+		listenAddr := os.Getenv("OAUTH_LISTEN_ADDR")
+		if listenAddr == "" {
+			listenAddr = ":8080"
+		}
+		go func() {
+			log.Printf("serving lichess oauth callback on %s", listenAddr)
+			if err := lichessAuth.ListenAndServe(listenAddr); err != nil {
+				log.Printf("lichess oauth server stopped: %v", err)
+			}
+		}()
+	}
+
+	privateHandlers := privatechat.GetHandlers(lichessAuth, scheduler)
 
 	// start bot and scheduler in goroutines
 	go botInstance.Start(mainGroupHandlers, adminGroupHandlers, privateHandlers)
@@ -65,6 +127,13 @@ func main() {
 	// cleanup
 	log.Println("shutting down...")
 	scheduler.Stop()
+	if lichessAuth != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := lichessAuth.Shutdown(shutdownCtx); err != nil {
+			log.Printf("failed to stop lichess oauth server: %v", err)
+		}
+		cancel()
+	}
 	botInstance.Stop()
 	db.Close()
 	log.Println("shutdown complete")
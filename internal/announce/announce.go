@@ -0,0 +1,132 @@
+// Package announce keeps the pinned tournament announcement in sync with the list. renders are
+// debounced and never overlap, publishing can wait in the outbox for a long time under group limits
+package announce
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrGone is returned by a publisher when the announcement message no longer exists
+var ErrGone = errors.New("announcement message not found")
+
+// Publisher delivers the rendered announcement to the chat
+type Publisher interface {
+	// EditAnnouncement replaces the text of the posted announcement
+	EditAnnouncement(messageID int, text string) error
+	// PostAnnouncement posts and pins a new announcement, returning its message id
+	PostAnnouncement(text string) (int, error)
+}
+
+// Source is the tournament the announcement is rendered from
+type Source interface {
+	// Current returns the announcement text and the id of the posted message, 0 when nothing is posted
+	Current() (text string, messageID int)
+	// Reposted stores the id of an announcement posted in place of a deleted one
+	Reposted(messageID int) error
+}
+
+// Announcer re-renders the announcement at most once per interval, no matter how often it is marked dirty
+type Announcer struct {
+	publisher Publisher
+	source    Source
+	interval  time.Duration
+
+	mu sync.Mutex
+	// scheduled is set while a render waits for its timer, running while one publishes and dirty
+	// when the list changed during that
+	scheduled     bool
+	running       bool
+	dirty         bool
+	lastRender    time.Time
+	lastText      string
+	lastMessageID int
+}
+
+func New(publisher Publisher, source Source, interval time.Duration) *Announcer {
+	return &Announcer{publisher: publisher, source: source, interval: interval}
+}
+
+// MarkDirty asks for the announcement to be re-rendered soon
+func (a *Announcer) MarkDirty() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.running {
+		a.dirty = true
+		return
+	}
+	a.schedule()
+}
+
+// schedule arms the timer for the next render. the caller holds the lock
+func (a *Announcer) schedule() {
+	if a.scheduled {
+		return
+	}
+	a.scheduled = true
+
+	delay := time.Until(a.lastRender.Add(a.interval))
+	if delay < 0 {
+		delay = 0
+	}
+	time.AfterFunc(delay, a.run)
+}
+
+func (a *Announcer) run() {
+	a.mu.Lock()
+	a.scheduled = false
+	a.running = true
+	a.dirty = false
+	a.lastRender = time.Now()
+	a.mu.Unlock()
+
+	if err := a.render(); err != nil {
+		fmt.Printf("error happened while rendering the announcement: %s\n", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.running = false
+	if a.dirty {
+		a.dirty = false
+		a.schedule()
+	}
+}
+
+func (a *Announcer) render() error {
+	text, messageID := a.source.Current()
+	if messageID == 0 {
+		return nil
+	}
+
+	a.mu.Lock()
+	unchanged := text == a.lastText && messageID == a.lastMessageID
+	a.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	err := a.publisher.EditAnnouncement(messageID, text)
+	if errors.Is(err, ErrGone) {
+		// someone deleted the pinned post, put it back
+		newMessageID, postErr := a.publisher.PostAnnouncement(text)
+		if postErr != nil {
+			return fmt.Errorf("failed to repost announcement: %w", postErr)
+		}
+		if err := a.source.Reposted(newMessageID); err != nil {
+			return err
+		}
+		messageID, err = newMessageID, nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to edit announcement: %w", err)
+	}
+
+	a.mu.Lock()
+	a.lastText = text
+	a.lastMessageID = messageID
+	a.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,171 @@
+package announce
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeChat is both the tournament and the chat: every change bumps the text, the posted
+// message can be deleted and edits can be held back like a busy outbox does
+type fakeChat struct {
+	mu        sync.Mutex
+	version   int
+	messageID int
+	deleted   bool
+	edits     int
+	posts     int
+	// hold blocks edits until it is closed, nil lets them through
+	hold chan struct{}
+	// inFlight counts publishing calls running at once, overlap records the most seen
+	inFlight int
+	overlap  int
+}
+
+func (c *fakeChat) Current() (string, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return "list " + strconv.Itoa(c.version), c.messageID
+}
+
+func (c *fakeChat) Reposted(messageID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messageID = messageID
+	return nil
+}
+
+func (c *fakeChat) EditAnnouncement(messageID int, text string) error {
+	c.mu.Lock()
+	c.inFlight++
+	if c.inFlight > c.overlap {
+		c.overlap = c.inFlight
+	}
+	hold := c.hold
+	c.mu.Unlock()
+
+	if hold != nil {
+		<-hold
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+	c.edits++
+	if c.deleted && messageID == 1 {
+		return ErrGone
+	}
+	return nil
+}
+
+func (c *fakeChat) PostAnnouncement(text string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.posts++
+	return 100 + c.posts, nil
+}
+
+func (c *fakeChat) change() {
+	c.mu.Lock()
+	c.version++
+	c.mu.Unlock()
+}
+
+func (c *fakeChat) counts() (edits, posts, overlap int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.edits, c.posts, c.overlap
+}
+
+// waitEdits blocks until the chat has seen the expected number of edits
+func waitEdits(t *testing.T, c *fakeChat, expected int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		edits, _, _ := c.counts()
+		if edits == expected {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d edits, got %d", expected, edits)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMarkDirtyDebounces(t *testing.T) {
+	chat := &fakeChat{messageID: 1}
+	a := New(chat, chat, 50*time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		chat.change()
+		a.MarkDirty()
+	}
+	waitEdits(t, chat, 1)
+
+	// within the interval more changes wait for the next render
+	chat.change()
+	a.MarkDirty()
+	time.Sleep(20 * time.Millisecond)
+	if edits, _, _ := chat.counts(); edits != 1 {
+		t.Fatalf("expected the second render to wait for the interval, got %d edits", edits)
+	}
+	waitEdits(t, chat, 2)
+}
+
+func TestUnchangedTextIsNotEdited(t *testing.T) {
+	chat := &fakeChat{messageID: 1}
+	a := New(chat, chat, time.Millisecond)
+
+	a.MarkDirty()
+	waitEdits(t, chat, 1)
+	a.MarkDirty()
+	time.Sleep(20 * time.Millisecond)
+	if edits, _, _ := chat.counts(); edits != 1 {
+		t.Errorf("expected the same text not to be edited again, got %d edits", edits)
+	}
+}
+
+func TestSlowPublishRepostsOnce(t *testing.T) {
+	chat := &fakeChat{messageID: 1, deleted: true, hold: make(chan struct{})}
+	a := New(chat, chat, time.Millisecond)
+
+	a.MarkDirty()
+	time.Sleep(10 * time.Millisecond)
+	// the first edit is stuck in the outbox while the list keeps changing
+	for i := 0; i < 5; i++ {
+		chat.change()
+		a.MarkDirty()
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(chat.hold)
+
+	waitEdits(t, chat, 2)
+	time.Sleep(20 * time.Millisecond)
+
+	edits, posts, overlap := chat.counts()
+	if posts != 1 {
+		t.Errorf("expected one repost, got %d", posts)
+	}
+	if overlap != 1 {
+		t.Errorf("expected renders not to overlap, %d ran at once", overlap)
+	}
+	if edits != 2 {
+		t.Errorf("expected one follow-up edit of the reposted message, got %d edits", edits)
+	}
+	if _, messageID := chat.Current(); messageID != 101 {
+		t.Errorf("expected the reposted message to be kept, got %d", messageID)
+	}
+}
+
+func TestNothingPosted(t *testing.T) {
+	chat := &fakeChat{}
+	a := New(chat, chat, time.Millisecond)
+
+	a.MarkDirty()
+	time.Sleep(20 * time.Millisecond)
+	if edits, posts, _ := chat.counts(); edits != 0 || posts != 0 {
+		t.Errorf("expected nothing published without a message, got %d edits and %d posts", edits, posts)
+	}
+}
@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/db"
+)
+
+// admin group administrators are also picked up from chat_member updates,
+// the periodic refresh covers updates missed while the bot was down
+const adminRefreshInterval = 15 * time.Minute
+
+// refreshAdminList syncs admin group administrators into the db and reloads all roles
+func (b *Bot) refreshAdminList() {
+	config := tgbotapi.ChatAdministratorsConfig{
+		ChatConfig: tgbotapi.ChatConfig{
+			ChatID: b.adminGroupID,
+		},
+	}
+
+	admins, err := b.Client.GetChatAdministrators(config)
+	if err != nil {
+		log.Printf("[%s] failed to get admin list: %v", b.name, err)
+	} else {
+		var groupAdmins []db.GroupAdmin
+		for _, admin := range admins {
+			if admin.User.IsBot {
+				continue
+			}
+			groupAdmins = append(groupAdmins, db.GroupAdmin{
+				UserID:   admin.User.ID,
+				Username: admin.User.UserName,
+				Creator:  admin.IsCreator(),
+			})
+		}
+		if err := db.SyncGroupAdmins(groupAdmins); err != nil {
+			log.Printf("[%s] failed to sync group admins: %v", b.name, err)
+		}
+	}
+
+	b.ReloadRoles()
+}
+
+// ReloadRoles reads roles from the db into memory
+func (b *Bot) ReloadRoles() {
+	stored, err := db.GetAdmins()
+	if err != nil {
+		log.Printf("[%s] failed to load roles: %v", b.name, err)
+		return
+	}
+
+	roles := make(map[int64]db.Role, len(stored))
+	for _, admin := range stored {
+		roles[admin.UserID] = admin.Role
+	}
+
+	b.adminMu.Lock()
+	b.roles = roles
+	b.adminMu.Unlock()
+
+	log.Printf("[%s] loaded %d admin roles", b.name, len(roles))
+
+	b.publishAdminCommands()
+}
+
+func (b *Bot) refreshAdminListEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.refreshAdminList()
+		case <-b.stopChan:
+			return
+		}
+	}
+}
+
+// Role returns the role of the user, empty if they have none
+func (b *Bot) Role(userID int64) db.Role {
+	b.adminMu.RLock()
+	defer b.adminMu.RUnlock()
+	return b.roles[userID]
+}
+
+func (b *Bot) IsAdmin(userID int64) bool {
+	return b.Role(userID) != ""
+}
@@ -3,12 +3,22 @@ package bot
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/callback"
+	"github.com/sukalov/mshkbot/internal/conversation"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/i18n"
+	"github.com/sukalov/mshkbot/internal/outbox"
+	"github.com/sukalov/mshkbot/internal/render"
 	"github.com/sukalov/mshkbot/internal/tournament"
 )
 
@@ -26,19 +36,28 @@ type setMessageReactionRequest struct {
 }
 
 type Bot struct {
-	Client         *tgbotapi.BotAPI
-	updateChan     tgbotapi.UpdatesChannel
-	stopChan       chan struct{}
-	name           string
-	mu             sync.Mutex
-	mainGroupID    int64
-	adminGroupID   int64
-	adminUserIDs   map[int64]bool
-	adminMu        sync.RWMutex
-	Tournament     *tournament.TournamentManager
-	adminProcesses *AdminProcessStore
+	Client       *tgbotapi.BotAPI
+	updateChan   tgbotapi.UpdatesChannel
+	stopChan     chan struct{}
+	name         string
+	mu           sync.Mutex
+	mainGroupID  int64
+	adminGroupID int64
+	roles        map[int64]db.Role
+	adminMu      sync.RWMutex
+	Tournament   *tournament.TournamentManager
+	Metrics      *Metrics
+	Outbox       *outbox.Outbox
+	middleware   []Middleware
+	updates      sync.Map
+	sets         map[Scope]HandlerSet
+	// adminMenus holds the roles whose private chat menus were published, guarded by adminMu
+	adminMenus map[int64]db.Role
 }
 
+// the pinned announcement is re-rendered at most this often, bursts of check-ins are merged into one edit
+const announcementInterval = 3 * time.Second
+
 // creates a new bot instance
 func New(name, token string, mainGroupID, adminGroupID int64) (*Bot, error) {
 	botClient, err := tgbotapi.NewBotAPI(token)
@@ -48,26 +67,33 @@ func New(name, token string, mainGroupID, adminGroupID int64) (*Bot, error) {
 
 	updateConfig := tgbotapi.NewUpdate(0)
 	updateConfig.Timeout = 60
+	// chat_member updates are only sent when asked for explicitly
+	updateConfig.AllowedUpdates = []string{"message", "callback_query", "my_chat_member", "chat_member"}
 	updateChan := botClient.GetUpdatesChan(updateConfig)
 
-	return &Bot{
-		Client:         botClient,
-		updateChan:     updateChan,
-		stopChan:       make(chan struct{}),
-		name:           name,
-		mainGroupID:    mainGroupID,
-		adminGroupID:   adminGroupID,
-		adminUserIDs:   make(map[int64]bool),
-		Tournament:     &tournament.TournamentManager{},
-		adminProcesses: NewAdminProcessStore(),
-	}, nil
+	b := &Bot{
+		Client:       botClient,
+		updateChan:   updateChan,
+		stopChan:     make(chan struct{}),
+		name:         name,
+		mainGroupID:  mainGroupID,
+		adminGroupID: adminGroupID,
+		roles:        make(map[int64]db.Role),
+		Tournament:   &tournament.TournamentManager{},
+		Metrics:      NewMetrics(),
+		Outbox:       outbox.New(outbox.DefaultConfig()),
+	}
+	b.Tournament.SetAnnouncementPublisher(b, announcementInterval)
+	return b, nil
 }
 
 // HandlerSet contains handlers for a specific chat type
 type HandlerSet struct {
-	Commands  map[string]func(b *Bot, update tgbotapi.Update) error
+	Scope Scope
+	// Commands are listed in the order /help and the command menus show them
+	Commands  []Command
 	Messages  []func(b *Bot, update tgbotapi.Update) error
-	Callbacks map[string]func(b *Bot, update tgbotapi.Update) error
+	Callbacks []Callback
 }
 
 // begins processing updates with handlers for different chat types
@@ -81,13 +107,34 @@ func (b *Bot) Start(
 		log.Printf("[%s] failed to initialize tournament: %v", b.name, err)
 	}
 	log.Printf("[%s] tournament initialized: %v", b.name, b.Tournament)
-	// fetch admin list on startup
+
+	b.mu.Lock()
+	b.sets = map[Scope]HandlerSet{
+		ScopeMainGroup:  mainGroupHandlers,
+		ScopeAdminGroup: adminGroupHandlers,
+		ScopePrivate:    privateHandlers,
+	}
+	b.mu.Unlock()
+
+	// fetch admin list on startup and keep it fresh
 	b.refreshAdminList()
+	go b.refreshAdminListEvery(adminRefreshInterval)
+	b.publishCommands()
+
+	// middleware wraps routing too, so nothing in an update can crash the bot
+	handle := b.chain(func(b *Bot, update tgbotapi.Update) error {
+		return b.routeUpdate(update, mainGroupHandlers, adminGroupHandlers, privateHandlers)
+	})
 
 	for {
 		select {
 		case update := <-b.updateChan:
-			go b.routeUpdate(update, mainGroupHandlers, adminGroupHandlers, privateHandlers)
+			go func(update tgbotapi.Update) {
+				defer b.forgetUpdate(update)
+				if err := handle(b, update); err != nil {
+					log.Printf("[%s] failed to handle update %d: %v", b.name, update.UpdateID, err)
+				}
+			}(update)
 		case <-b.stopChan:
 			return
 		}
@@ -104,47 +151,27 @@ func (b *Bot) GetAdminGroupID() int64 {
 
 func (b *Bot) ForwardMessage(toChatID, fromChatID int64, messageID int) error {
 	forward := tgbotapi.NewForward(toChatID, fromChatID, messageID)
-	_, err := b.Client.Send(forward)
+	_, err := b.send(toChatID, outbox.PriorityInteractive, forward)
 	return err
 }
 
-func (b *Bot) refreshAdminList() {
-	config := tgbotapi.ChatAdministratorsConfig{
-		ChatConfig: tgbotapi.ChatConfig{
-			ChatID: b.adminGroupID,
-		},
-	}
-
-	admins, err := b.Client.GetChatAdministrators(config)
-	if err != nil {
-		log.Printf("[%s] failed to get admin list: %v", b.name, err)
-		return
-	}
-
-	b.adminMu.Lock()
-	defer b.adminMu.Unlock()
-
-	// clear and rebuild admin list
-	b.adminUserIDs = make(map[int64]bool)
-	for _, admin := range admins {
-		b.adminUserIDs[admin.User.ID] = true
-		log.Printf("[%s] registered admin: %d (%s)", b.name, admin.User.ID, admin.User.UserName)
-	}
-}
-
-func (b *Bot) IsAdmin(userID int64) bool {
-	b.adminMu.RLock()
-	defer b.adminMu.RUnlock()
-	return b.adminUserIDs[userID]
-}
-
 // routes updates to appropriate handler set based on chat type or user id
 func (b *Bot) routeUpdate(
 	update tgbotapi.Update,
 	mainGroupHandlers HandlerSet,
 	adminGroupHandlers HandlerSet,
 	privateHandlers HandlerSet,
-) {
+) error {
+	// admin group administrators changed, roles follow them
+	for _, member := range []*tgbotapi.ChatMemberUpdated{update.ChatMember, update.MyChatMember} {
+		if member != nil {
+			if member.Chat.ID == b.adminGroupID {
+				b.refreshAdminList()
+			}
+			return nil
+		}
+	}
+
 	var chatID int64
 
 	// determine chat id and user id from update
@@ -154,43 +181,66 @@ func (b *Bot) routeUpdate(
 		chatID = update.CallbackQuery.Message.Chat.ID
 	} else {
 		log.Printf("[%s] update has no chat id", b.name)
-		return
+		return nil
 	}
+	_, userID := updateOrigin(update)
 
 	// route to appropriate handler set
-	var handlers HandlerSet
+	var handlers []HandlerSet
 	var chatType string
 
 	log.Printf("chatid, maingroupid: %d, %d", chatID, b.mainGroupID)
 
 	switch {
 	case chatID == b.mainGroupID:
-		log.Printf("[%s] main group message: %s", b.name, update.Message.Text)
-		handlers = mainGroupHandlers
+		if update.Message != nil {
+			log.Printf("[%s] main group message: %s", b.name, update.Message.Text)
+		}
+		handlers = []HandlerSet{mainGroupHandlers}
 		chatType = "main group"
 	case chatID == b.adminGroupID:
-		handlers = adminGroupHandlers
+		handlers = []HandlerSet{adminGroupHandlers}
 		chatType = "admin group"
 	case chatID > 0:
-		handlers = privateHandlers
+		handlers = []HandlerSet{privateHandlers}
 		chatType = "private"
+		// admins can also use admin commands in private chat
+		if b.IsAdmin(userID) {
+			handlers = append(handlers, adminGroupHandlers)
+		}
 	default:
 		log.Printf("[%s] unrecognized chat id: %d", b.name, chatID)
-		return
+		return nil
 	}
 
 	log.Printf("[%s] routing to %s handler", b.name, chatType)
-	b.processUpdate(update, handlers)
+	return b.processUpdate(update, handlers...)
 }
 
-// handles incoming updates with provided handler set
-func (b *Bot) processUpdate(update tgbotapi.Update, handlers HandlerSet) error {
+// errStaleCallback is reported for buttons drawn for a state that has changed since
+var errStaleCallback = errors.New("callback state version changed")
+
+// handles incoming updates with provided handler sets, the first set with a matching command or callback wins
+func (b *Bot) processUpdate(update tgbotapi.Update, sets ...HandlerSet) error {
+	// Help lists commands of the sets this update is routed to
+	b.updateState(update).sets = sets
+
 	// handle command updates
 	if update.Message != nil && update.Message.IsCommand() {
 		command := update.Message.Command()
-		if handler, exists := handlers.Commands[command]; exists {
-			if err := handler(b, update); err != nil {
-				return b.SendMessage(update.Message.From.ID, fmt.Sprintf("ошибка при выполнении команды %s", command))
+		for _, handlers := range sets {
+			cmd, exists := handlers.command(command)
+			if !exists {
+				continue
+			}
+			if !cmd.permits(b.Role(update.Message.From.ID)) {
+				return b.SendMessage(update.Message.Chat.ID, "недостаточно прав для этой команды")
+			}
+			if err := cmd.Handler(b, update); err != nil {
+				if sendErr := b.SendMessage(update.Message.From.ID, fmt.Sprintf("ошибка при выполнении команды %s", command)); sendErr != nil {
+					log.Printf("[%s] failed to report command error: %v", b.name, sendErr)
+				}
+				return fmt.Errorf("command %s: %w", command, err)
 			}
 			return nil
 		}
@@ -199,19 +249,36 @@ func (b *Bot) processUpdate(update tgbotapi.Update, handlers HandlerSet) error {
 
 	// handle callback queries
 	if update.CallbackQuery != nil {
-		data := update.CallbackQuery.Data
-		// extract callback query identifier (before first colon if exists)
-		query := data
-		for i, c := range data {
-			if c == ':' {
-				query = data[:i]
-				break
-			}
-		}
+		query := callback.Route(update.CallbackQuery.Data)
 
-		if handler, exists := handlers.Callbacks[query]; exists {
-			if err := handler(b, update); err != nil {
-				return b.SendMessage(update.Message.From.ID, "ошибка")
+		for _, handlers := range sets {
+			cb, exists := handlers.callback(query)
+			if !exists {
+				continue
+			}
+			if !cb.permits(b.Role(update.CallbackQuery.From.ID)) {
+				_, err := b.Request(tgbotapi.NewCallbackWithAlert(update.CallbackQuery.ID, "недостаточно прав"))
+				return err
+			}
+			data, err := callback.Decode(update.CallbackQuery.Data)
+			if err == nil && cb.Version != nil && data.Version != cb.Version(b) {
+				err = errStaleCallback
+			}
+			if err == nil && cb.Flow != "" {
+				err = b.checkFlow(update, cb.Flow, data.Version)
+			}
+			if err != nil {
+				log.Printf("[%s] rejected callback %s from %d: %v", b.name, query, update.CallbackQuery.From.ID, err)
+				_, err := b.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, i18n.T(b.Lang(update), "callback.outdated")))
+				return err
+			}
+			// handlers parse the data without the signature
+			update.CallbackQuery.Data = data.Plain()
+			if err := cb.Handler(b, update); err != nil {
+				if sendErr := b.SendMessage(update.CallbackQuery.From.ID, "ошибка"); sendErr != nil {
+					log.Printf("[%s] failed to report callback error: %v", b.name, sendErr)
+				}
+				return fmt.Errorf("callback %s: %w", query, err)
 			}
 			return nil
 		}
@@ -225,12 +292,16 @@ func (b *Bot) processUpdate(update tgbotapi.Update, handlers HandlerSet) error {
 	}
 
 	// run generic message handlers
-	for _, handler := range handlers.Messages {
-		if err := handler(b, update); err != nil {
-			log.Printf("[%s] message handler error: %v", b.name, err)
+	var errs []error
+	for _, handlers := range sets {
+		for _, handler := range handlers.Messages {
+			if err := handler(b, update); err != nil {
+				log.Printf("[%s] message handler error: %v", b.name, err)
+				errs = append(errs, err)
+			}
 		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 // halts the bot
@@ -238,19 +309,45 @@ func (b *Bot) Stop() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	close(b.stopChan)
+	b.Outbox.Stop()
 }
 
 func (b *Bot) SendMessage(chatID int64, text string) error {
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.DisableWebPagePreview = true
-	_, err := b.Client.Send(msg)
+	_, err := b.send(chatID, outbox.PriorityInteractive, msg)
+	return err
+}
+
+// SendBulkMessage sends a message that may wait behind replies to users, for mass notifications
+func (b *Bot) SendBulkMessage(chatID int64, text string) error {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.DisableWebPagePreview = true
+	_, err := b.send(chatID, outbox.PriorityBulk, msg)
+	return err
+}
+
+// SendBulkMessageWithButtons is SendBulkMessage with an inline keyboard
+func (b *Bot) SendBulkMessageWithButtons(chatID int64, text string, keyboard tgbotapi.InlineKeyboardMarkup) error {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = keyboard
+	_, err := b.send(chatID, outbox.PriorityBulk, msg)
+	return err
+}
+
+// SendDocument sends a file made in memory with an optional caption
+func (b *Bot) SendDocument(chatID int64, name string, data []byte, caption string) error {
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: name, Bytes: data})
+	doc.Caption = caption
+	_, err := b.send(chatID, outbox.PriorityInteractive, doc)
 	return err
 }
 
 func (b *Bot) SendMessageAndGetID(chatID int64, text string) (int, error) {
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.DisableWebPagePreview = true
-	sentMsg, err := b.Client.Send(msg)
+	sentMsg, err := b.send(chatID, outbox.PriorityInteractive, msg)
 	if err != nil {
 		return 0, err
 	}
@@ -261,7 +358,16 @@ func (b *Bot) SendMessageWithMarkdown(chatID int64, text string, disableLinks bo
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "Markdown"
 	msg.DisableWebPagePreview = disableLinks
-	_, err := b.Client.Send(msg)
+	_, err := b.send(chatID, outbox.PriorityInteractive, msg)
+	return err
+}
+
+// SendMessageWithHTML sends text rendered for the HTML parse mode
+func (b *Bot) SendMessageWithHTML(chatID int64, text string, disableLinks bool) error {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ParseMode = string(render.HTML)
+	msg.DisableWebPagePreview = disableLinks
+	_, err := b.send(chatID, outbox.PriorityInteractive, msg)
 	return err
 }
 
@@ -275,7 +381,21 @@ func (b *Bot) SendMessageWithButtons(
 	msg.ParseMode = "Markdown"
 	msg.DisableWebPagePreview = true
 
-	_, err := b.Client.Send(msg)
+	_, err := b.send(chatID, outbox.PriorityInteractive, msg)
+	return err
+}
+
+// SendPlainMessageWithButtons sends the text as is, for texts with user input that markdown would break on
+func (b *Bot) SendPlainMessageWithButtons(
+	chatID int64,
+	text string,
+	keyboard tgbotapi.InlineKeyboardMarkup,
+) error {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = keyboard
+	msg.DisableWebPagePreview = true
+
+	_, err := b.send(chatID, outbox.PriorityInteractive, msg)
 	return err
 }
 
@@ -289,7 +409,7 @@ func (b *Bot) SendMessageWithButtonsAndGetID(
 	msg.ParseMode = "Markdown"
 	msg.DisableWebPagePreview = true
 
-	sentMsg, err := b.Client.Send(msg)
+	sentMsg, err := b.send(chatID, outbox.PriorityInteractive, msg)
 	if err != nil {
 		return 0, err
 	}
@@ -307,25 +427,44 @@ func (b *Bot) EditMessageWithButtons(
 	edit.DisableWebPagePreview = true
 	edit.ReplyMarkup = &keyboard
 
-	_, err := b.Client.Send(edit)
-	return err
+	return b.Outbox.Edit(chatID, messageID, outbox.PriorityInteractive, func() (tgbotapi.Message, error) {
+		return b.Client.Send(edit)
+	})
+}
+
+// EditButtons replaces the inline keyboard of a message and keeps its text
+func (b *Bot) EditButtons(chatID int64, messageID int, keyboard tgbotapi.InlineKeyboardMarkup) error {
+	edit := tgbotapi.NewEditMessageReplyMarkup(chatID, messageID, keyboard)
+	return b.Outbox.Edit(chatID, messageID, outbox.PriorityInteractive, func() (tgbotapi.Message, error) {
+		return b.Client.Send(edit)
+	})
 }
 
+// Request calls the api right away, for answers to callback queries and other calls outside message limits
 func (b *Bot) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
 	return b.Client.Request(c)
 }
 
-// removeReaction removes all reactions from a message
-func (b *Bot) RemoveReaction(chatID int64, messageID int) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/setMessageReaction", b.Client.Token)
+// send queues a message through the outbox so telegram limits are respected
+func (b *Bot) send(chatID int64, priority outbox.Priority, c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	return b.Outbox.Send(chatID, priority, func() (tgbotapi.Message, error) {
+		return b.Client.Send(c)
+	})
+}
 
-	reqBody := setMessageReactionRequest{
-		ChatID:    chatID,
-		MessageID: messageID,
-		Reaction:  []reactionType{}, // empty array removes reactions
-	}
+// sendRaw queues a call of an api method the library does not support
+func (b *Bot) sendRaw(chatID int64, priority outbox.Priority, method string, body interface{}) error {
+	_, err := b.Outbox.Send(chatID, priority, func() (tgbotapi.Message, error) {
+		return tgbotapi.Message{}, b.rawRequest(method, body)
+	})
+	return err
+}
+
+// rawRequest calls the bot api directly. failures are returned as library errors so retry_after is honoured
+func (b *Bot) rawRequest(method string, body interface{}) error {
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/%s", b.Client.Token, method)
 
-	jsonData, err := json.Marshal(reqBody)
+	jsonData, err := json.Marshal(body)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request: %w", err)
 	}
@@ -336,19 +475,35 @@ func (b *Bot) RemoveReaction(chatID int64, messageID int) error {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		var result map[string]interface{}
-		json.NewDecoder(resp.Body).Decode(&result)
-		return fmt.Errorf("telegram api error: %v", result)
+	var apiResp tgbotapi.APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if !apiResp.Ok {
+		apiErr := &tgbotapi.Error{Code: apiResp.ErrorCode, Message: apiResp.Description}
+		if apiResp.Parameters != nil {
+			apiErr.ResponseParameters = *apiResp.Parameters
+		}
+		return fmt.Errorf("telegram api error: %w", apiErr)
 	}
 
 	return nil
 }
 
+// removeReaction removes all reactions from a message
+func (b *Bot) RemoveReaction(chatID int64, messageID int) error {
+	reqBody := setMessageReactionRequest{
+		ChatID:    chatID,
+		MessageID: messageID,
+		Reaction:  []reactionType{}, // empty array removes reactions
+	}
+
+	return b.sendRaw(chatID, outbox.PriorityInteractive, "setMessageReaction", reqBody)
+}
+
 // giveReaction sends a reaction to a message using direct telegram API call
 func (b *Bot) GiveReaction(chatID int64, messageID int, emoji string) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/setMessageReaction", b.Client.Token)
-
 	reqBody := setMessageReactionRequest{
 		ChatID:    chatID,
 		MessageID: messageID,
@@ -361,30 +516,11 @@ func (b *Bot) GiveReaction(chatID int64, messageID int, emoji string) error {
 		IsBig: false,
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		var result map[string]interface{}
-		json.NewDecoder(resp.Body).Decode(&result)
-		return fmt.Errorf("telegram api error: %v", result)
-	}
-
-	return nil
+	return b.sendRaw(chatID, outbox.PriorityInteractive, "setMessageReaction", reqBody)
 }
 
 // replyToMessage sends a text message as a reply to a specific message
 func (b *Bot) ReplyToMessage(chatID int64, messageID int, text string) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", b.Client.Token)
-
 	reqBody := map[string]interface{}{
 		"chat_id": chatID,
 		"text":    text,
@@ -393,119 +529,133 @@ func (b *Bot) ReplyToMessage(chatID int64, messageID int, text string) error {
 		},
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		var result map[string]interface{}
-		json.NewDecoder(resp.Body).Decode(&result)
-		return fmt.Errorf("telegram api error: %v", result)
-	}
-
-	return nil
+	return b.sendRaw(chatID, outbox.PriorityInteractive, "sendMessage", reqBody)
 }
 
 func (b *Bot) PinMessage(chatID int64, messageID int) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/pinChatMessage", b.Client.Token)
-
 	reqBody := map[string]interface{}{
 		"chat_id":    chatID,
 		"message_id": messageID,
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		var result map[string]interface{}
-		json.NewDecoder(resp.Body).Decode(&result)
-		return fmt.Errorf("telegram api error: %v", result)
-	}
-
-	return nil
+	return b.sendRaw(chatID, outbox.PriorityNormal, "pinChatMessage", reqBody)
 }
 
 func (b *Bot) EditMessage(chatID int64, messageID int, text string) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/editMessageText", b.Client.Token)
+	return b.editText(chatID, messageID, text, "", nil, outbox.PriorityInteractive)
+}
 
+// editText queues a text edit, repeated edits of one message are coalesced.
+// the message loses its buttons unless they are passed again
+func (b *Bot) editText(chatID int64, messageID int, text string, parseMode render.Mode, keyboard *tgbotapi.InlineKeyboardMarkup, priority outbox.Priority) error {
 	reqBody := map[string]interface{}{
 		"chat_id":    chatID,
 		"message_id": messageID,
 		"text":       text,
 	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+	if parseMode != "" {
+		reqBody["parse_mode"] = parseMode
 	}
-
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		var result map[string]interface{}
-		json.NewDecoder(resp.Body).Decode(&result)
-		return fmt.Errorf("telegram api error: %v", result)
+	if keyboard != nil {
+		reqBody["reply_markup"] = keyboard
 	}
 
-	return nil
+	return b.Outbox.Edit(chatID, messageID, priority, func() (tgbotapi.Message, error) {
+		return tgbotapi.Message{}, b.rawRequest("editMessageText", reqBody)
+	})
 }
 
 func (b *Bot) UnpinMessage(chatID int64, messageID int) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/unpinChatMessage", b.Client.Token)
-
 	reqBody := map[string]interface{}{
 		"chat_id":    chatID,
 		"message_id": messageID,
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+	return b.sendRaw(chatID, outbox.PriorityNormal, "unpinChatMessage", reqBody)
+}
+
+// EditAnnouncement updates the pinned tournament announcement in the main group
+func (b *Bot) EditAnnouncement(messageID int, text string) error {
+	keyboard := b.entryKeyboard()
+	err := b.editText(b.mainGroupID, messageID, text, tournament.AnnouncementMode, &keyboard, outbox.PriorityNormal)
+
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case strings.Contains(apiErr.Message, "message is not modified"):
+			return nil
+		case strings.Contains(apiErr.Message, "message to edit not found"), strings.Contains(apiErr.Message, "MESSAGE_ID_INVALID"):
+			return tournament.ErrAnnouncementGone
+		}
 	}
+	return err
+}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+// EntryRoute is the callback route of the sign up and leave buttons under the announcement,
+// its argument is EntryJoin or EntryLeave
+const EntryRoute = "entry"
+
+const (
+	EntryJoin  = "join"
+	EntryLeave = "leave"
+)
+
+// BroadcastsRoute is the callback route of the button under admin broadcasts, its argument
+// is BroadcastsOff or BroadcastsOn
+const BroadcastsRoute = "broadcasts"
+
+const (
+	BroadcastsOff = "off"
+	BroadcastsOn  = "on"
+)
+
+// checkFlow makes sure the pressed button was drawn for the flow the user is in right now
+func (b *Bot) checkFlow(update tgbotapi.Update, flow string, version uint64) error {
+	if update.CallbackQuery.Message == nil {
+		return errStaleCallback
+	}
+	current, err := conversation.Current(b.Context(update), update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.From.ID, flow, version)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		var result map[string]interface{}
-		json.NewDecoder(resp.Body).Decode(&result)
-		return fmt.Errorf("telegram api error: %v", result)
+	if !current {
+		return errStaleCallback
 	}
-
 	return nil
 }
 
-func (b *Bot) SetAdminProcess(adminChatID int64, processType AdminProcessType, duration string) {
-	b.adminProcesses.Set(adminChatID, processType, duration)
+// TournamentVersion ties buttons to the tournament they were drawn for,
+// so buttons left under an old announcement don't sign anyone up for the next one
+func TournamentVersion(b *Bot) uint64 {
+	h := fnv.New32a()
+	h.Write([]byte(b.Tournament.Metadata.ID))
+	return uint64(h.Sum32())
 }
 
-func (b *Bot) GetAdminProcess(adminChatID int64) (*AdminProcess, bool) {
-	return b.adminProcesses.Get(adminChatID)
+// entryKeyboard builds the buttons of the announcement, the group is russian-speaking
+func (b *Bot) entryKeyboard() tgbotapi.InlineKeyboardMarkup {
+	version := TournamentVersion(b)
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(i18n.T(i18n.Default, "announcement.join"), callback.Encode(EntryRoute, version, EntryJoin)),
+			tgbotapi.NewInlineKeyboardButtonData(i18n.T(i18n.Default, "announcement.leave"), callback.Encode(EntryRoute, version, EntryLeave)),
+		),
+	)
 }
 
-func (b *Bot) ClearAdminProcess(adminChatID int64) {
-	b.adminProcesses.Clear(adminChatID)
+// PostAnnouncement sends a new tournament announcement to the main group and pins it
+func (b *Bot) PostAnnouncement(text string) (int, error) {
+	msg := tgbotapi.NewMessage(b.mainGroupID, text)
+	msg.ParseMode = string(tournament.AnnouncementMode)
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = b.entryKeyboard()
+	sent, err := b.send(b.mainGroupID, outbox.PriorityNormal, msg)
+	if err != nil {
+		return 0, err
+	}
+	messageID := sent.MessageID
+	if err := b.PinMessage(b.mainGroupID, messageID); err != nil {
+		log.Printf("[%s] failed to pin announcement: %v", b.name, err)
+	}
+	return messageID, nil
 }
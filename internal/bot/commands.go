@@ -0,0 +1,229 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/i18n"
+)
+
+// Scope tells where a handler set is used, it decides which command menu its commands go to
+type Scope int
+
+const (
+	ScopeMainGroup Scope = iota + 1
+	ScopeAdminGroup
+	ScopePrivate
+)
+
+// Command is a command handler together with what /help and the telegram menu show for it
+type Command struct {
+	Name    string
+	Handler Handler
+	// Args are shown after the command in /help, e.g. "<username>"
+	Args string
+	// Description is an i18n key. commands without one are left out of /help and menus
+	Description string
+	// Role is the minimum role needed to run the command, empty for everyone
+	Role db.Role
+}
+
+// permits reports whether a user with the role may run the command
+func (c Command) permits(role db.Role) bool {
+	return c.Role == "" || role.Allows(c.Role)
+}
+
+// Callback is a handler for inline buttons whose data is routed by Name
+type Callback struct {
+	Name    string
+	Handler Handler
+	// Role is the minimum role needed to press the button, empty for everyone
+	Role db.Role
+	// Version returns the version of the state the buttons are drawn for, buttons carrying
+	// another version answer that the menu is outdated. nil skips the check
+	Version func(b *Bot) uint64
+	// Flow names the conversation the buttons belong to. they carry the version of the flow
+	// they were drawn for and only work while that run of the flow is in progress for the
+	// user pressing them
+	Flow string
+}
+
+// command finds a command of the set by name
+func (s HandlerSet) command(name string) (Command, bool) {
+	for _, command := range s.Commands {
+		if command.Name == name {
+			return command, true
+		}
+	}
+	return Command{}, false
+}
+
+// permits reports whether a user with the role may press the button
+func (c Callback) permits(role db.Role) bool {
+	return c.Role == "" || role.Allows(c.Role)
+}
+
+// callback finds a callback of the set by name
+func (s HandlerSet) callback(name string) (Callback, bool) {
+	for _, callback := range s.Callbacks {
+		if callback.Name == name {
+			return callback, true
+		}
+	}
+	return Callback{}, false
+}
+
+// Help answers with the commands available to the user in the chat the update came from
+func Help(b *Bot, update tgbotapi.Update) error {
+	_, userID := updateOrigin(update)
+	lang := b.Lang(update)
+	role := b.Role(userID)
+
+	var sections []string
+	seen := make(map[string]bool)
+	for _, set := range b.updateState(update).sets {
+		var lines []string
+		for _, command := range set.Commands {
+			if seen[command.Name] || command.Description == "" || !command.permits(role) {
+				continue
+			}
+			seen[command.Name] = true
+			lines = append(lines, helpLine(lang, command))
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		if set.Scope == ScopeAdminGroup {
+			lines = append([]string{i18n.T(lang, "help.admin_header")}, lines...)
+		}
+		sections = append(sections, strings.Join(lines, "\n\n"))
+	}
+
+	return b.SendMessage(update.Message.Chat.ID, strings.Join(sections, "\n\n\n"))
+}
+
+func helpLine(lang i18n.Lang, command Command) string {
+	usage := "/" + command.Name
+	if command.Args != "" {
+		usage += " " + command.Args
+	}
+	return fmt.Sprintf("%s — %s", usage, i18n.T(lang, command.Description))
+}
+
+// botCommandScope is the scope object of setMyCommands
+type botCommandScope struct {
+	Type   string `json:"type"`
+	ChatID int64  `json:"chat_id,omitempty"`
+}
+
+type setMyCommandsRequest struct {
+	Commands     []tgbotapi.BotCommand `json:"commands"`
+	Scope        botCommandScope       `json:"scope"`
+	LanguageCode string                `json:"language_code,omitempty"`
+}
+
+type deleteMyCommandsRequest struct {
+	Scope        botCommandScope `json:"scope"`
+	LanguageCode string          `json:"language_code,omitempty"`
+}
+
+// menu lists the described commands of the sets that the role may run
+func menu(lang i18n.Lang, role db.Role, sets ...HandlerSet) []tgbotapi.BotCommand {
+	var commands []tgbotapi.BotCommand
+	seen := make(map[string]bool)
+	for _, set := range sets {
+		for _, command := range set.Commands {
+			if seen[command.Name] || command.Description == "" || !command.permits(role) {
+				continue
+			}
+			seen[command.Name] = true
+			commands = append(commands, tgbotapi.BotCommand{Command: command.Name, Description: i18n.T(lang, command.Description)})
+		}
+	}
+	return commands
+}
+
+// setCommands publishes a menu in every language, russian being the default for clients with other languages
+func (b *Bot) setCommands(scope botCommandScope, role db.Role, sets ...HandlerSet) error {
+	for _, lang := range i18n.Languages() {
+		request := setMyCommandsRequest{Commands: menu(lang, role, sets...), Scope: scope}
+		if lang != i18n.Default {
+			request.LanguageCode = string(lang)
+		}
+		if err := b.rawRequest("setMyCommands", request); err != nil {
+			return fmt.Errorf("failed to set %s commands for %s: %w", lang, scope.Type, err)
+		}
+	}
+	return nil
+}
+
+// publishCommands sets the command menus of the main group, the admin group and private chats
+func (b *Bot) publishCommands() {
+	b.mu.Lock()
+	sets := b.sets
+	b.mu.Unlock()
+
+	scopes := []struct {
+		scope botCommandScope
+		role  db.Role
+		set   HandlerSet
+	}{
+		{botCommandScope{Type: "all_private_chats"}, "", sets[ScopePrivate]},
+		{botCommandScope{Type: "chat", ChatID: b.mainGroupID}, "", sets[ScopeMainGroup]},
+		// every admin sees the full list in the group, commands above their role are refused when used
+		{botCommandScope{Type: "chat", ChatID: b.adminGroupID}, db.RoleOwner, sets[ScopeAdminGroup]},
+	}
+	for _, s := range scopes {
+		if err := b.setCommands(s.scope, s.role, s.set); err != nil {
+			log.Printf("[%s] %v", b.name, err)
+		}
+	}
+
+	b.publishAdminCommands()
+}
+
+// publishAdminCommands gives admins a private chat menu with the admin commands of their role
+// and takes it away from people who are no longer admins
+func (b *Bot) publishAdminCommands() {
+	b.mu.Lock()
+	sets := b.sets
+	b.mu.Unlock()
+	if sets == nil {
+		return
+	}
+
+	b.adminMu.Lock()
+	roles := make(map[int64]db.Role, len(b.roles))
+	for userID, role := range b.roles {
+		roles[userID] = role
+	}
+	published := b.adminMenus
+	b.adminMenus = roles
+	b.adminMu.Unlock()
+
+	for userID, role := range roles {
+		if published[userID] == role {
+			continue
+		}
+		if err := b.setCommands(botCommandScope{Type: "chat", ChatID: userID}, role, sets[ScopePrivate], sets[ScopeAdminGroup]); err != nil {
+			log.Printf("[%s] %v", b.name, err)
+		}
+	}
+	for userID := range published {
+		if _, ok := roles[userID]; ok {
+			continue
+		}
+		for _, lang := range i18n.Languages() {
+			request := deleteMyCommandsRequest{Scope: botCommandScope{Type: "chat", ChatID: userID}}
+			if lang != i18n.Default {
+				request.LanguageCode = string(lang)
+			}
+			if err := b.rawRequest("deleteMyCommands", request); err != nil {
+				log.Printf("[%s] failed to delete commands of %d: %v", b.name, userID, err)
+			}
+		}
+	}
+}
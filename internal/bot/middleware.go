@@ -0,0 +1,372 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/i18n"
+)
+
+// Handler processes a single update
+type Handler func(b *Bot, update tgbotapi.Update) error
+
+// Middleware wraps a handler with shared pre- and post-processing
+type Middleware func(next Handler) Handler
+
+// PanicError is returned by Recover instead of letting a handler panic crash the bot
+type PanicError struct {
+	Value interface{}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// updateState holds values that live only while one update is processed
+type updateState struct {
+	ctx  context.Context
+	user *db.User
+	lang i18n.Lang
+	sets []HandlerSet
+}
+
+// Use adds middleware around every update. the first one added runs outermost
+func (b *Bot) Use(middleware ...Middleware) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.middleware = append(b.middleware, middleware...)
+}
+
+func (b *Bot) chain(handler Handler) Handler {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := len(b.middleware) - 1; i >= 0; i-- {
+		handler = b.middleware[i](handler)
+	}
+	return handler
+}
+
+// Context returns the context of the update, limited by the Timeout middleware if it is used
+func (b *Bot) Context(update tgbotapi.Update) context.Context {
+	if state, ok := b.updates.Load(update.UpdateID); ok && state.(*updateState).ctx != nil {
+		return state.(*updateState).ctx
+	}
+	return context.Background()
+}
+
+// RegisteredUser returns the user loaded by RequireRegistered for this update
+func (b *Bot) RegisteredUser(update tgbotapi.Update) (db.User, bool) {
+	if state, ok := b.updates.Load(update.UpdateID); ok && state.(*updateState).user != nil {
+		return *state.(*updateState).user, true
+	}
+	return db.User{}, false
+}
+
+// Lang returns the language to answer the user behind the update in
+func (b *Bot) Lang(update tgbotapi.Update) i18n.Lang {
+	state := b.updateState(update)
+	if state.lang != "" {
+		return state.lang
+	}
+
+	var from *tgbotapi.User
+	switch {
+	case update.Message != nil:
+		from = update.Message.From
+	case update.CallbackQuery != nil:
+		from = update.CallbackQuery.From
+	}
+	if from == nil {
+		return i18n.Default
+	}
+
+	if state.user != nil {
+		state.lang = i18n.Match(state.user.Language, from.LanguageCode)
+	} else {
+		state.lang = b.LangOf(from.ID, from.LanguageCode)
+	}
+	return state.lang
+}
+
+// LangOf returns the language of a user outside of an update, clientCode is their telegram language if known
+func (b *Bot) LangOf(userID int64, clientCode string) i18n.Lang {
+	user, err := db.GetByChatID(userID)
+	if err != nil {
+		return i18n.Match("", clientCode)
+	}
+	return i18n.Match(user.Language, clientCode)
+}
+
+func (b *Bot) updateState(update tgbotapi.Update) *updateState {
+	state, _ := b.updates.LoadOrStore(update.UpdateID, &updateState{})
+	return state.(*updateState)
+}
+
+func (b *Bot) forgetUpdate(update tgbotapi.Update) {
+	b.updates.Delete(update.UpdateID)
+}
+
+// Recover turns handler panics into errors and logs the stack
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(b *Bot, update tgbotapi.Update) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("[%s] panic while handling update %d: %v\n%s", b.name, update.UpdateID, r, debug.Stack())
+					err = &PanicError{Value: r}
+				}
+			}()
+			return next(b, update)
+		}
+	}
+}
+
+// Timeout gives every update its own context, available through Bot.Context
+func Timeout(timeout time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(b *Bot, update tgbotapi.Update) error {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			b.updateState(update).ctx = ctx
+			return next(b, update)
+		}
+	}
+}
+
+// Logging writes one line per update with its kind, origin, duration and result
+func Logging() Middleware {
+	return func(next Handler) Handler {
+		return func(b *Bot, update tgbotapi.Update) error {
+			start := time.Now()
+			err := next(b, update)
+
+			chatID, userID := updateOrigin(update)
+			status := "ok"
+			if err != nil {
+				status = err.Error()
+			}
+			log.Printf("[%s] update=%d kind=%s chat=%d user=%d duration=%s status=%q", b.name, update.UpdateID, updateKind(update), chatID, userID, time.Since(start).Round(time.Millisecond), status)
+			return err
+		}
+	}
+}
+
+// CollectMetrics records counts and timings of updates in Bot.Metrics
+func CollectMetrics() Middleware {
+	return func(next Handler) Handler {
+		return func(b *Bot, update tgbotapi.Update) error {
+			start := time.Now()
+			err := next(b, update)
+			b.Metrics.record(updateKind(update), time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// RequireRegistered lets only users with finished registration through and
+// makes their record available through Bot.RegisteredUser
+func RequireRegistered(next Handler) Handler {
+	return RequireRegisteredFor(nil, next)
+}
+
+// StartPayload picks the /start payload for the private chat link given to unregistered
+// users in groups, so registration can end with what they tried to do. empty means no link
+type StartPayload func(b *Bot, update tgbotapi.Update) string
+
+// RequireRegisteredFor is RequireRegistered whose group replies link to the private chat with a /start payload
+func RequireRegisteredFor(payload StartPayload, next Handler) Handler {
+	return func(b *Bot, update tgbotapi.Update) error {
+		_, userID := updateOrigin(update)
+
+		link := ""
+		if payload != nil {
+			if p := payload(b, update); p != "" {
+				link = b.StartLink(p)
+			}
+		}
+
+		user, err := db.GetByChatID(userID)
+		if err != nil {
+			if errors.Is(err, db.ErrUserNotFound) {
+				return b.rejectUnregistered(update, "registration.group_unknown", "registration.private_unknown", link)
+			}
+			return err
+		}
+		if user.State != db.StateCompleted {
+			return b.rejectUnregistered(update, "registration.group_unfinished", "registration.private_unfinished", link)
+		}
+
+		b.updateState(update).user = &user
+		return next(b, update)
+	}
+}
+
+// StartLink opens the private chat with the bot and sends /start with the payload
+func (b *Bot) StartLink(payload string) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s", b.Client.Self.UserName, payload)
+}
+
+// rejectUnregistered answers in the place the user wrote from: a toast for buttons,
+// a reply in groups and a plain message in private chat. the link is added to group answers
+func (b *Bot) rejectUnregistered(update tgbotapi.Update, groupKey, privateKey, link string) error {
+	lang := b.Lang(update)
+	groupText, privateText := i18n.T(lang, groupKey), i18n.T(lang, privateKey)
+	if link != "" {
+		groupText = i18n.T(lang, "registration.link", groupText, link)
+	}
+	if update.CallbackQuery != nil {
+		if link != "" {
+			// telegram opens t.me links given in callback answers right away
+			answer := tgbotapi.NewCallback(update.CallbackQuery.ID, "")
+			answer.URL = link
+			_, err := b.Request(answer)
+			return err
+		}
+		text := groupText
+		if update.CallbackQuery.Message != nil && update.CallbackQuery.Message.Chat.ID > 0 {
+			text = privateText
+		}
+		_, err := b.Request(tgbotapi.NewCallbackWithAlert(update.CallbackQuery.ID, text))
+		return err
+	}
+	if update.Message == nil {
+		return nil
+	}
+	if update.Message.Chat.ID > 0 {
+		return b.SendMessage(update.Message.Chat.ID, privateText)
+	}
+	return b.ReplyToMessage(update.Message.Chat.ID, update.Message.MessageID, groupText)
+}
+
+func updateOrigin(update tgbotapi.Update) (chatID, userID int64) {
+	switch {
+	case update.Message != nil:
+		chatID = update.Message.Chat.ID
+		if update.Message.From != nil {
+			userID = update.Message.From.ID
+		}
+	case update.CallbackQuery != nil:
+		userID = update.CallbackQuery.From.ID
+		if update.CallbackQuery.Message != nil {
+			chatID = update.CallbackQuery.Message.Chat.ID
+		}
+	case update.MyChatMember != nil:
+		chatID = update.MyChatMember.Chat.ID
+		userID = update.MyChatMember.From.ID
+	case update.ChatMember != nil:
+		chatID = update.ChatMember.Chat.ID
+		userID = update.ChatMember.From.ID
+	}
+	return chatID, userID
+}
+
+func updateKind(update tgbotapi.Update) string {
+	switch {
+	case update.Message != nil && update.Message.IsCommand():
+		return "command:" + update.Message.Command()
+	case update.Message != nil:
+		return "message"
+	case update.CallbackQuery != nil:
+		query, _, _ := strings.Cut(update.CallbackQuery.Data, ":")
+		return "callback:" + query
+	case update.MyChatMember != nil, update.ChatMember != nil:
+		return "chat_member"
+	default:
+		return "other"
+	}
+}
+
+// Metrics counts processed updates per kind
+type Metrics struct {
+	mu     sync.Mutex
+	since  time.Time
+	byKind map[string]*KindStats
+}
+
+type KindStats struct {
+	Count   int64
+	Errors  int64
+	Panics  int64
+	Total   time.Duration
+	Slowest time.Duration
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{since: time.Now(), byKind: make(map[string]*KindStats)}
+}
+
+func (m *Metrics) record(kind string, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, ok := m.byKind[kind]
+	if !ok {
+		stats = &KindStats{}
+		m.byKind[kind] = stats
+	}
+	stats.Count++
+	stats.Total += duration
+	if duration > stats.Slowest {
+		stats.Slowest = duration
+	}
+	if err != nil {
+		stats.Errors++
+		var panicErr *PanicError
+		if errors.As(err, &panicErr) {
+			stats.Panics++
+		}
+	}
+}
+
+// Snapshot returns a copy of the counters
+func (m *Metrics) Snapshot() map[string]KindStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make(map[string]KindStats, len(m.byKind))
+	for kind, stats := range m.byKind {
+		snapshot[kind] = *stats
+	}
+	return snapshot
+}
+
+// Format renders the counters for admins, busiest kinds first
+func (m *Metrics) Format() string {
+	snapshot := m.Snapshot()
+	if len(snapshot) == 0 {
+		return "обновлений ещё не было"
+	}
+
+	kinds := make([]string, 0, len(snapshot))
+	var total, errs, panics int64
+	for kind, stats := range snapshot {
+		kinds = append(kinds, kind)
+		total += stats.Count
+		errs += stats.Errors
+		panics += stats.Panics
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if snapshot[kinds[i]].Count != snapshot[kinds[j]].Count {
+			return snapshot[kinds[i]].Count > snapshot[kinds[j]].Count
+		}
+		return kinds[i] < kinds[j]
+	})
+
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("с %s: %d обновлений, %d ошибок, %d паник\n\n", m.since.Format("02.01.2006 15:04"), total, errs, panics))
+	for _, kind := range kinds {
+		stats := snapshot[kind]
+		average := stats.Total / time.Duration(stats.Count)
+		builder.WriteString(fmt.Sprintf("%s: %d, ошибок %d, среднее %s, максимум %s\n", kind, stats.Count, stats.Errors, average.Round(time.Millisecond), stats.Slowest.Round(time.Millisecond)))
+	}
+	return builder.String()
+}
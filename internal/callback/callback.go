@@ -0,0 +1,156 @@
+// Package callback signs inline button data so that buttons can't be forged,
+// stop working after a while and go stale when the state they were drawn for changes.
+//
+// encoded data looks like "<route>:<token>[:<arg>...]". the token is base64url of
+// the expiry in unix minutes, the state version as uvarint and a truncated hmac
+// of all of it together with the route and the args.
+package callback
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxLength is the telegram limit for callback data in bytes
+const MaxLength = 64
+
+// DefaultTTL is how long buttons stay usable
+const DefaultTTL = 7 * 24 * time.Hour
+
+const macSize = 6
+
+var (
+	ErrMalformed = errors.New("malformed callback data")
+	ErrSignature = errors.New("bad callback signature")
+	ErrExpired   = errors.New("callback expired")
+)
+
+// Data is decoded callback data
+type Data struct {
+	Route   string
+	Args    []string
+	Version uint64
+	Expires time.Time
+}
+
+// Plain joins the route and the args back together the way handlers parse them
+func (d Data) Plain() string {
+	return strings.Join(append([]string{d.Route}, d.Args...), ":")
+}
+
+// Codec encodes and decodes signed callback data
+type Codec struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func New(secret []byte, ttl time.Duration) *Codec {
+	return &Codec{secret: secret, ttl: ttl, now: time.Now}
+}
+
+// Encode builds button data for a route, args must not contain colons. the result is cut to nothing but the route
+// when it doesn't fit into telegram's limit, so such buttons answer as outdated instead of failing to send.
+// that is a bug in the caller and is logged
+func (c *Codec) Encode(route string, version uint64, args ...string) string {
+	expires := uint32(c.now().Add(c.ttl).Unix() / 60)
+
+	payload := make([]byte, 4, 4+binary.MaxVarintLen64+macSize)
+	binary.BigEndian.PutUint32(payload, expires)
+	payload = binary.AppendUvarint(payload, version)
+	payload = append(payload, c.sign(route, payload, args)...)
+
+	data := strings.Join(append([]string{route, base64.RawURLEncoding.EncodeToString(payload)}, args...), ":")
+	if len(data) > MaxLength {
+		log.Printf("callback data for route %s is %d bytes, over the %d byte limit, the button will not work", route, len(data), MaxLength)
+		return route
+	}
+	return data
+}
+
+// Decode checks the signature and expiry of button data
+func (c *Codec) Decode(data string) (Data, error) {
+	parts := strings.Split(data, ":")
+	if len(parts) < 2 {
+		return Data{}, ErrMalformed
+	}
+	route, args := parts[0], parts[2:]
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || len(payload) < 4+1+macSize {
+		return Data{}, ErrMalformed
+	}
+	body, mac := payload[:len(payload)-macSize], payload[len(payload)-macSize:]
+	if !hmac.Equal(mac, c.sign(route, body, args)) {
+		return Data{}, ErrSignature
+	}
+
+	version, n := binary.Uvarint(body[4:])
+	if n <= 0 || 4+n != len(body) {
+		return Data{}, ErrMalformed
+	}
+
+	expires := time.Unix(int64(binary.BigEndian.Uint32(body))*60, 0)
+	if c.now().After(expires) {
+		return Data{}, ErrExpired
+	}
+
+	return Data{Route: route, Args: args, Version: version, Expires: expires}, nil
+}
+
+func (c *Codec) sign(route string, body []byte, args []string) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(route))
+	mac.Write([]byte{0})
+	mac.Write(body)
+	for _, arg := range args {
+		mac.Write([]byte{0})
+		mac.Write([]byte(arg))
+	}
+	return mac.Sum(nil)[:macSize]
+}
+
+var (
+	stdMu sync.RWMutex
+	std   = New(nil, DefaultTTL)
+)
+
+// Configure sets the secret of the package codec, it has to be called before any button is built
+func Configure(secret []byte, ttl time.Duration) {
+	stdMu.Lock()
+	defer stdMu.Unlock()
+	std = New(secret, ttl)
+}
+
+// Encode builds button data with the package codec
+func Encode(route string, version uint64, args ...string) string {
+	stdMu.RLock()
+	defer stdMu.RUnlock()
+	return std.Encode(route, version, args...)
+}
+
+// Decode reads button data with the package codec
+func Decode(data string) (Data, error) {
+	stdMu.RLock()
+	defer stdMu.RUnlock()
+	return std.Decode(data)
+}
+
+// Route returns the route of button data without checking it
+func Route(data string) string {
+	route, _, _ := strings.Cut(data, ":")
+	return route
+}
+
+// Secret derives a codec secret from the bot token, used when no secret is configured
+func Secret(token string) []byte {
+	sum := sha256.Sum256([]byte("callback:" + token))
+	return sum[:]
+}
@@ -0,0 +1,79 @@
+package callback
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCodec(now time.Time) *Codec {
+	c := New([]byte("secret"), time.Hour)
+	c.now = func() time.Time { return now }
+	return c
+}
+
+func TestRoundTrip(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	c := testCodec(now)
+
+	for _, tc := range []struct {
+		route   string
+		version uint64
+		args    []string
+	}{
+		{"language", 0, []string{"en"}},
+		{"schedule", 1760788800, []string{"field", "wednesday", "unverified_policy"}},
+		{"action", 300, nil},
+	} {
+		data := c.Encode(tc.route, tc.version, tc.args...)
+		if len(data) > MaxLength {
+			t.Fatalf("%q is longer than %d bytes", data, MaxLength)
+		}
+		got, err := c.Decode(data)
+		if err != nil {
+			t.Fatalf("failed to decode %q: %v", data, err)
+		}
+		if got.Route != tc.route || got.Version != tc.version || len(got.Args) != len(tc.args) {
+			t.Errorf("decoded %+v, want %s v%d %v", got, tc.route, tc.version, tc.args)
+		}
+		if want := strings.Join(append([]string{tc.route}, tc.args...), ":"); got.Plain() != want {
+			t.Errorf("Plain() = %q, want %q", got.Plain(), want)
+		}
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	c := testCodec(now)
+	data := c.Encode("schedule", 7, "delete_event", "monday")
+
+	tampered := strings.Replace(data, "monday", "tuesday", 1)
+	if _, err := c.Decode(tampered); !errors.Is(err, ErrSignature) {
+		t.Errorf("tampered args: got %v, want %v", err, ErrSignature)
+	}
+
+	other := New([]byte("other"), time.Hour)
+	other.now = c.now
+	if _, err := other.Decode(data); !errors.Is(err, ErrSignature) {
+		t.Errorf("foreign secret: got %v, want %v", err, ErrSignature)
+	}
+
+	later := testCodec(now.Add(2 * time.Hour))
+	if _, err := later.Decode(data); !errors.Is(err, ErrExpired) {
+		t.Errorf("expired: got %v, want %v", err, ErrExpired)
+	}
+
+	for _, legacy := range []string{"schedule", "schedule:approve", "register:lichess", "language:!!"} {
+		if _, err := c.Decode(legacy); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%q: got %v, want %v", legacy, err, ErrMalformed)
+		}
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	c := testCodec(time.Now())
+	if got := c.Encode("route", 1, strings.Repeat("x", MaxLength)); got != "route" {
+		t.Errorf("expected oversized data to collapse to the route, got %q", got)
+	}
+}
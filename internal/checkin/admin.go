@@ -0,0 +1,106 @@
+package checkin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/eligibility"
+	"github.com/sukalov/mshkbot/internal/redis"
+	"github.com/sukalov/mshkbot/internal/tournament"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// Add puts a registered user into the tournament on an admin's behalf. rating limits don't apply,
+// ratings are still fetched so the admin list shows them. players who left earlier are added anew
+func Add(ctx context.Context, b *bot.Bot, user db.User) (Result, error) {
+	if !b.Tournament.Metadata.Exists {
+		return Result{Outcome: NoTournament}, nil
+	}
+
+	userID := int(user.ChatID)
+
+	for _, player := range b.Tournament.List {
+		if player.ID != userID {
+			continue
+		}
+		if player.State != types.StateCheckedOut {
+			return Result{Outcome: Already, Player: player}, nil
+		}
+		if err := b.Tournament.RemovePlayer(ctx, userID); err != nil {
+			log.Printf("failed to remove checked-out player %d before adding again: %v", userID, err)
+		}
+		break
+	}
+
+	snapshot := eligibility.Check(user, b.Tournament.Metadata)
+	if err := redis.SetLastEligibility(ctx, user.ChatID, *snapshot); err != nil {
+		log.Printf("failed to store eligibility snapshot for user %d: %v", userID, err)
+	}
+
+	player := types.Player{
+		ID:          userID,
+		Username:    user.Username,
+		SavedName:   user.SavedName,
+		TimeAdded:   time.Now().UTC(),
+		State:       types.StateInTournament,
+		PeakRating:  eligibility.PeakRating(snapshot),
+		OTBRating:   eligibility.OTBRating(snapshot),
+		Eligibility: snapshot,
+	}
+
+	player, err := b.Tournament.AddPlayer(ctx, player)
+	if errors.Is(err, tournament.ErrAlreadyInList) {
+		return Result{Outcome: Already, Player: player}, nil
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to add player %d: %w", userID, err)
+	}
+
+	if err := db.IncrementTimesPlayed(user.ChatID); err != nil {
+		log.Printf("failed to increment times played for user %d: %v", userID, err)
+	}
+
+	b.Tournament.MarkAnnouncementDirty()
+
+	return added(b, player), nil
+}
+
+// AddGuest puts someone without telegram into the tournament, the tournament manager gives them a synthetic
+// id. the ratings are whatever the admin typed in, either may be nil. guests take a place like everyone else
+func AddGuest(ctx context.Context, b *bot.Bot, name string, peak *types.PeakRating, otb *types.OTBRating) (Result, error) {
+	if !b.Tournament.Metadata.Exists {
+		return Result{Outcome: NoTournament}, nil
+	}
+
+	player := types.Player{
+		SavedName:  name,
+		TimeAdded:  time.Now().UTC(),
+		State:      types.StateInTournament,
+		PeakRating: peak,
+		OTBRating:  otb,
+	}
+
+	player, err := b.Tournament.AddPlayer(ctx, player)
+	if errors.Is(err, tournament.ErrAlreadyInList) {
+		return Result{Outcome: Already, Player: player}, nil
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to add guest %s: %w", name, err)
+	}
+
+	b.Tournament.MarkAnnouncementDirty()
+
+	return added(b, player), nil
+}
+
+func added(b *bot.Bot, player types.Player) Result {
+	if player.State == types.StateQueued {
+		return Result{Outcome: Queued, Player: player, Ahead: queuedAhead(b, player.ID)}
+	}
+	return Result{Outcome: Admitted, Player: player}
+}
@@ -0,0 +1,240 @@
+// Package checkin signs players up for the current tournament. it is shared by
+// /checkin in the group and by check-ins that start elsewhere, e.g. /start links
+package checkin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/eligibility"
+	"github.com/sukalov/mshkbot/internal/i18n"
+	"github.com/sukalov/mshkbot/internal/redis"
+	"github.com/sukalov/mshkbot/internal/tournament"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// Outcome is what a check-in attempt ended with
+type Outcome int
+
+const (
+	Admitted Outcome = iota + 1
+	Queued
+	Pending
+	Rejected
+	Already
+	AlreadyLeft
+	NoTournament
+	Closed
+
+	Left
+	Withdrew
+	NotIn
+	AlreadyOut
+	NothingToLeave
+)
+
+// Result describes a check-in or check-out attempt
+type Result struct {
+	Outcome Outcome
+	Player  types.Player
+	// Reason is the eligibility reason of a rejection
+	Reason string
+	// Ahead counts queued players who came before this one
+	Ahead int
+}
+
+// Origin is the message a player checked in with, admins get a link to it. zero for check-ins outside the group
+type Origin struct {
+	ChatID    int64
+	MessageID int
+}
+
+// Enter checks the user's eligibility and adds them to the current tournament. only while registration is open
+func Enter(ctx context.Context, b *bot.Bot, user db.User, origin Origin) (Result, error) {
+	if !b.Tournament.Metadata.Exists {
+		return Result{Outcome: NoTournament}, nil
+	}
+	if b.Tournament.Metadata.CurrentPhase() != types.PhaseOpen {
+		return Result{Outcome: Closed}, nil
+	}
+
+	userID := int(user.ChatID)
+
+	for _, player := range b.Tournament.List {
+		if player.ID != userID {
+			continue
+		}
+		if player.State == types.StateCheckedOut {
+			return Result{Outcome: AlreadyLeft, Player: player}, nil
+		}
+		return Result{Outcome: Already, Player: player}, nil
+	}
+
+	snapshot := eligibility.Check(user, b.Tournament.Metadata)
+	if err := redis.SetLastEligibility(ctx, user.ChatID, *snapshot); err != nil {
+		log.Printf("failed to store eligibility snapshot for user %d: %v", userID, err)
+	}
+	for _, check := range snapshot.Sites {
+		if check.Error != "" {
+			log.Printf("failed to check %s ratings for user %d: %s", check.Site, userID, check.Error)
+		}
+	}
+
+	if snapshot.Decision == types.DecisionRejected {
+		log.Printf("user %d (%s) rejected from tournament: %s", userID, user.Username, snapshot.Reason)
+		recordRejection(ctx, b, snapshot.Reason)
+		return Result{Outcome: Rejected, Reason: snapshot.Reason}, nil
+	}
+
+	policy := eligibility.Policy(b.Tournament.Metadata)
+	unverified := snapshot.Decision == types.DecisionUnverified
+	if unverified && policy == types.UnverifiedReject {
+		log.Printf("user %d (%s) rejected from tournament: ratings unavailable", userID, user.Username)
+		recordRejection(ctx, b, snapshot.Reason)
+		return Result{Outcome: Rejected, Reason: snapshot.Reason}, nil
+	}
+
+	// the tournament manager queues the player when no seat is left
+	state := types.StateInTournament
+	if unverified && policy == types.UnverifiedPending {
+		state = types.StatePending
+	}
+
+	player := types.Player{
+		ID:               userID,
+		Username:         user.Username,
+		SavedName:        user.SavedName,
+		TimeAdded:        time.Now().UTC(),
+		State:            state,
+		PeakRating:       eligibility.PeakRating(snapshot),
+		OTBRating:        eligibility.OTBRating(snapshot),
+		Eligibility:      snapshot,
+		Unverified:       unverified,
+		CheckinMessageID: origin.MessageID,
+		CheckinChatID:    origin.ChatID,
+	}
+
+	player, err := b.Tournament.AddPlayer(ctx, player)
+	if errors.Is(err, tournament.ErrAlreadyInList) {
+		return Result{Outcome: Already, Player: player}, nil
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to add player %d: %w", userID, err)
+	}
+	log.Printf("user %d (%s) checked in to tournament", userID, user.Username)
+
+	if err := db.IncrementTimesPlayed(user.ChatID); err != nil {
+		log.Printf("failed to increment times played for user %d: %v", userID, err)
+	}
+
+	b.Tournament.MarkAnnouncementDirty()
+
+	if unverified {
+		notifyAdminsAboutUnverifiedPlayer(b, player)
+	}
+
+	result := Result{Outcome: Admitted, Player: player}
+	switch player.State {
+	case types.StatePending:
+		result.Outcome = Pending
+	case types.StateQueued:
+		result.Outcome = Queued
+		result.Ahead = queuedAhead(b, userID)
+	}
+	return result, nil
+}
+
+// Message is the answer to a check-in or check-out attempt
+func (r Result) Message(lang i18n.Lang) string {
+	switch r.Outcome {
+	case Admitted:
+		return i18n.T(lang, "checkin.done")
+	case Queued:
+		reply := i18n.T(lang, "checkin.queued")
+		if r.Ahead > 0 {
+			reply += ". " + i18n.N(lang, "checkin.queue_ahead", r.Ahead)
+		}
+		return reply
+	case Pending:
+		return i18n.T(lang, "checkin.pending")
+	case Rejected:
+		return eligibility.RejectionMessage(lang, r.Reason)
+	case Already:
+		return i18n.T(lang, "checkin.already")
+	case AlreadyLeft:
+		return i18n.T(lang, "checkin.already_left")
+	case Closed:
+		return i18n.T(lang, "checkin.closed")
+	case Left:
+		return i18n.T(lang, "checkout.done")
+	case Withdrew:
+		return i18n.T(lang, "checkout.withdrawn")
+	case NotIn:
+		return i18n.T(lang, "checkout.not_in")
+	case AlreadyOut:
+		return i18n.T(lang, "checkout.already")
+	case NothingToLeave:
+		return i18n.T(lang, "checkin.no_tournament")
+	default:
+		return i18n.T(lang, "checkin.unavailable")
+	}
+}
+
+func recordRejection(ctx context.Context, b *bot.Bot, reason string) {
+	if err := b.Tournament.RecordRejection(ctx, reason); err != nil {
+		log.Printf("failed to record rejection: %v", err)
+	}
+}
+
+// queuedAhead counts the players who joined the queue before the given one
+func queuedAhead(b *bot.Bot, playerID int) int {
+	ahead := 0
+	for _, player := range b.Tournament.List {
+		if player.ID == playerID {
+			break
+		}
+		if player.State == types.StateQueued {
+			ahead++
+		}
+	}
+	return ahead
+}
+
+func notifyAdminsAboutUnverifiedPlayer(b *bot.Bot, player types.Player) {
+	sites := strings.Join(eligibility.FailedSites(player.Eligibility), ", ")
+
+	var message string
+	if player.State == types.StatePending {
+		message = fmt.Sprintf("%s (@%s) ждёт проверки рейтинга: не отвечает %s. запишу автоматически, когда сайт заработает", player.SavedName, player.Username, sites)
+	} else {
+		message = fmt.Sprintf("%s (@%s) записан без проверки рейтинга: не отвечает %s. проверю ещё раз, когда сайт заработает", player.SavedName, player.Username, sites)
+	}
+
+	if err := b.SendMessage(b.GetAdminGroupID(), message); err != nil {
+		log.Printf("failed to notify admins about unverified player: %v", err)
+	}
+}
+
+// payloadPrefix starts /start payloads of check-in links
+const payloadPrefix = "checkin_"
+
+// Payload is the /start payload that checks the user into the tournament after registration
+func Payload(b *bot.Bot, update tgbotapi.Update) string {
+	if !b.Tournament.Metadata.Exists || b.Tournament.Metadata.ID == "" {
+		return ""
+	}
+	return payloadPrefix + b.Tournament.Metadata.ID
+}
+
+// ParsePayload returns the tournament id of a check-in /start payload
+func ParsePayload(payload string) (string, bool) {
+	tournamentID, ok := strings.CutPrefix(payload, payloadPrefix)
+	return tournamentID, ok && tournamentID != ""
+}
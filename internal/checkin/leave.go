@@ -0,0 +1,91 @@
+package checkin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/tournament"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// checked-out players stay in the list for a while so the admins see who left
+const cleanupDelay = 15 * time.Minute
+
+// Leave checks the user out of the current tournament and promotes the first queued player into their place.
+// leaving after registration closed is a withdrawal, such players stay in the list for the archive
+func Leave(ctx context.Context, b *bot.Bot, userID int64) (Result, error) {
+	if !b.Tournament.Metadata.Exists {
+		return Result{Outcome: NothingToLeave}, nil
+	}
+
+	playerID := int(userID)
+	withdrawn := b.Tournament.Metadata.CurrentPhase() == types.PhaseClosed
+
+	previous, promoted, err := b.Tournament.CheckOut(ctx, playerID, withdrawn)
+	if errors.Is(err, tournament.ErrNotInList) {
+		return Result{Outcome: NotIn}, nil
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to check out player: %w", err)
+	}
+	if previous.State == types.StateCheckedOut {
+		return Result{Outcome: AlreadyOut, Player: previous}, nil
+	}
+
+	updatedPlayer := previous
+	updatedPlayer.State = types.StateCheckedOut
+	updatedPlayer.Withdrawn = withdrawn
+
+	log.Printf("user %d checked out from tournament", playerID)
+
+	if err := b.Tournament.RecordCheckOut(ctx); err != nil {
+		log.Printf("failed to record check-out: %v", err)
+	}
+
+	if err := db.DecrementTimesPlayed(userID); err != nil {
+		log.Printf("failed to decrement times played for user %d: %v", playerID, err)
+	}
+
+	if promoted != nil {
+		log.Printf("promoted player %d (%s) from queue to tournament", promoted.ID, promoted.Username)
+	}
+
+	b.Tournament.MarkAnnouncementDirty()
+
+	if withdrawn {
+		log.Printf("user %d withdrew after registration closed", playerID)
+		return Result{Outcome: Withdrew, Player: updatedPlayer}, nil
+	}
+
+	go schedulePlayerCleanup(b, playerID, cleanupDelay)
+
+	return Result{Outcome: Left, Player: updatedPlayer}, nil
+}
+
+func schedulePlayerCleanup(b *bot.Bot, playerID int, delay time.Duration) {
+	time.Sleep(delay)
+
+	ctx := context.Background()
+
+	var shouldRemove bool
+	for _, player := range b.Tournament.List {
+		if player.ID == playerID && player.State == types.StateCheckedOut {
+			shouldRemove = true
+			break
+		}
+	}
+
+	if shouldRemove {
+		if err := b.Tournament.RemovePlayer(ctx, playerID); err != nil {
+			log.Printf("failed to cleanup checked-out player %d: %v", playerID, err)
+			return
+		}
+
+		log.Printf("cleaned up checked-out player %d after %v", playerID, delay)
+	}
+}
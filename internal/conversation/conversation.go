@@ -0,0 +1,150 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// Conversation is the state of a multi-step flow of one user in one chat. Version is a nonce
+// picked when the flow starts, buttons of the flow carry it so that buttons left from an
+// earlier run of the flow stop working
+type Conversation struct {
+	ChatID    int64             `json:"chat_id"`
+	UserID    int64             `json:"user_id"`
+	Flow      string            `json:"flow"`
+	Step      string            `json:"step"`
+	Data      map[string]string `json:"data,omitempty"`
+	Version   uint64            `json:"version"`
+	Timeout   time.Duration     `json:"timeout"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+const DefaultTimeout = 15 * time.Minute
+
+// Store keeps conversations under a key until their timeout runs out, the bot keeps them in redis
+type Store interface {
+	// Get returns nil without an error when the key is missing or expired
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Del reports whether there was something to delete
+	Del(ctx context.Context, key string) (bool, error)
+}
+
+var store Store
+
+// Configure sets where conversations are kept, it has to be called before any flow starts
+func Configure(s Store) {
+	store = s
+}
+
+func key(chatID, userID int64) string {
+	return fmt.Sprintf("conversation:%d:%d", chatID, userID)
+}
+
+// Start begins a flow for the user in the chat, replacing any flow in progress
+func Start(ctx context.Context, chatID, userID int64, flow, step string, data map[string]string, timeout time.Duration) (*Conversation, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if data == nil {
+		data = make(map[string]string)
+	}
+
+	c := &Conversation{
+		ChatID: chatID,
+		UserID: userID,
+		Flow:   flow,
+		Step:   step,
+		Data:   data,
+		// kept to 32 bits so that the buttons fit into the callback data limit, never 0
+		Version: uint64(rand.Uint32()) + 1,
+		Timeout: timeout,
+	}
+	if err := Save(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Get returns the flow in progress or nil if there is none or it has timed out
+func Get(ctx context.Context, chatID, userID int64) (*Conversation, error) {
+	data, err := store.Get(ctx, key(chatID, userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var c Conversation
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal conversation: %w", err)
+	}
+	if c.Data == nil {
+		c.Data = make(map[string]string)
+	}
+	return &c, nil
+}
+
+// GetFlow returns the conversation only if it belongs to the given flow
+func GetFlow(ctx context.Context, chatID, userID int64, flow string) (*Conversation, error) {
+	c, err := Get(ctx, chatID, userID)
+	if err != nil || c == nil || c.Flow != flow {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Current reports whether the flow is in progress for the user in the chat and was started
+// with the given version
+func Current(ctx context.Context, chatID, userID int64, flow string, version uint64) (bool, error) {
+	c, err := GetFlow(ctx, chatID, userID, flow)
+	if err != nil || c == nil {
+		return false, err
+	}
+	return c.Version == version, nil
+}
+
+// Save persists the conversation and restarts its timeout
+func Save(ctx context.Context, c *Conversation) error {
+	c.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal conversation: %w", err)
+	}
+	if err := store.Set(ctx, key(c.ChatID, c.UserID), data, c.Timeout); err != nil {
+		return fmt.Errorf("failed to save conversation: %w", err)
+	}
+	return nil
+}
+
+// Advance moves the conversation to the next step
+func Advance(ctx context.Context, c *Conversation, step string) error {
+	c.Step = step
+	return Save(ctx, c)
+}
+
+// EndFlow finishes the flow of the user in the chat if it is the given one, a flow started
+// since then is left alone
+func EndFlow(ctx context.Context, chatID, userID int64, flow string) error {
+	c, err := GetFlow(ctx, chatID, userID, flow)
+	if err != nil || c == nil {
+		return err
+	}
+	if _, err := store.Del(ctx, key(chatID, userID)); err != nil {
+		return fmt.Errorf("failed to end conversation: %w", err)
+	}
+	return nil
+}
+
+// Cancel ends whatever flow is in progress and reports whether there was one to cancel
+func Cancel(ctx context.Context, chatID, userID int64) (bool, error) {
+	deleted, err := store.Del(ctx, key(chatID, userID))
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel conversation: %w", err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,312 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore keeps values in memory with expiry on a clock the test moves
+type memoryStore struct {
+	mu      sync.Mutex
+	now     time.Time
+	values  map[string][]byte
+	expires map[string]time.Time
+	ttls    map[string]time.Duration
+	fail    error
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		now:     time.Date(2026, time.October, 5, 12, 0, 0, 0, time.UTC),
+		values:  make(map[string][]byte),
+		expires: make(map[string]time.Time),
+		ttls:    make(map[string]time.Duration),
+	}
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		return nil, s.fail
+	}
+	if expires, ok := s.expires[key]; ok && !s.now.Before(expires) {
+		delete(s.values, key)
+		delete(s.expires, key)
+	}
+	return s.values[key], nil
+}
+
+func (s *memoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		return s.fail
+	}
+	s.values[key] = value
+	s.ttls[key] = ttl
+	delete(s.expires, key)
+	if ttl > 0 {
+		s.expires[key] = s.now.Add(ttl)
+	}
+	return nil
+}
+
+func (s *memoryStore) Del(ctx context.Context, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		return false, s.fail
+	}
+	_, ok := s.values[key]
+	delete(s.values, key)
+	delete(s.expires, key)
+	return ok, nil
+}
+
+func (s *memoryStore) advance(d time.Duration) {
+	s.mu.Lock()
+	s.now = s.now.Add(d)
+	s.mu.Unlock()
+}
+
+func useMemoryStore(t *testing.T) *memoryStore {
+	t.Helper()
+	s := newMemoryStore()
+	Configure(s)
+	t.Cleanup(func() { Configure(nil) })
+	return s
+}
+
+func TestStartAndGet(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		data        map[string]string
+		timeout     time.Duration
+		wantTimeout time.Duration
+	}{
+		{"default timeout", nil, 0, DefaultTimeout},
+		{"negative timeout", nil, -time.Minute, DefaultTimeout},
+		{"own timeout and data", map[string]string{"segment": "all"}, time.Minute, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := useMemoryStore(t)
+
+			if _, err := Start(ctx, 1, 2, "broadcast", "text", tt.data, tt.timeout); err != nil {
+				t.Fatalf("Start failed: %v", err)
+			}
+			if ttl := s.ttls[key(1, 2)]; ttl != tt.wantTimeout {
+				t.Errorf("stored with ttl %v, want %v", ttl, tt.wantTimeout)
+			}
+
+			c, err := Get(ctx, 1, 2)
+			if err != nil || c == nil {
+				t.Fatalf("Get = %v, %v, want the conversation", c, err)
+			}
+			if c.Flow != "broadcast" || c.Step != "text" || c.Timeout != tt.wantTimeout || c.Data == nil {
+				t.Errorf("Get = %+v", c)
+			}
+			if tt.data != nil && c.Data["segment"] != "all" {
+				t.Errorf("data = %v, want segment all", c.Data)
+			}
+		})
+	}
+}
+
+func TestGetMissing(t *testing.T) {
+	useMemoryStore(t)
+	c, err := Get(context.Background(), 1, 2)
+	if c != nil || err != nil {
+		t.Errorf("Get = %v, %v, want nil, nil", c, err)
+	}
+}
+
+func TestGetStoreError(t *testing.T) {
+	s := useMemoryStore(t)
+	s.fail = errors.New("connection refused")
+	if _, err := Get(context.Background(), 1, 2); err == nil {
+		t.Error("expected the store error to be returned")
+	}
+}
+
+func TestGetFlow(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		flow string
+		want bool
+	}{
+		{"same flow", "create_tournament", true},
+		{"other flow", "broadcast", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useMemoryStore(t)
+			if _, err := Start(ctx, 1, 2, "create_tournament", "limit", nil, 0); err != nil {
+				t.Fatalf("Start failed: %v", err)
+			}
+			c, err := GetFlow(ctx, 1, 2, tt.flow)
+			if err != nil {
+				t.Fatalf("GetFlow failed: %v", err)
+			}
+			if (c != nil) != tt.want {
+				t.Errorf("GetFlow(%s) = %v, want found %v", tt.flow, c, tt.want)
+			}
+		})
+	}
+}
+
+func TestConversationsAreKeptApart(t *testing.T) {
+	ctx := context.Background()
+	useMemoryStore(t)
+
+	if _, err := Start(ctx, 1, 2, "broadcast", "text", nil, 0); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	for _, ids := range [][2]int64{{1, 3}, {4, 2}} {
+		if c, _ := Get(ctx, ids[0], ids[1]); c != nil {
+			t.Errorf("chat %d user %d sees the conversation of chat 1 user 2", ids[0], ids[1])
+		}
+	}
+}
+
+func TestAdvanceRestartsTimeout(t *testing.T) {
+	ctx := context.Background()
+	s := useMemoryStore(t)
+
+	c, err := Start(ctx, 1, 2, "create_tournament", "limit", nil, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	s.advance(8 * time.Minute)
+	if err := Advance(ctx, c, "intro"); err != nil {
+		t.Fatalf("Advance failed: %v", err)
+	}
+
+	s.advance(8 * time.Minute)
+	got, err := Get(ctx, 1, 2)
+	if err != nil || got == nil {
+		t.Fatalf("Get = %v, %v, want the conversation kept alive by Advance", got, err)
+	}
+	if got.Step != "intro" {
+		t.Errorf("step = %s, want intro", got.Step)
+	}
+
+	s.advance(2 * time.Minute)
+	if got, _ := Get(ctx, 1, 2); got != nil {
+		t.Errorf("Get = %+v, want nil after the timeout", got)
+	}
+}
+
+func TestEndFlow(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		started  string
+		end      string
+		wantKept bool
+	}{
+		{"own flow", "broadcast", "broadcast", false},
+		{"other flow", "create_tournament", "broadcast", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useMemoryStore(t)
+			if _, err := Start(ctx, 1, 2, tt.started, "step", nil, 0); err != nil {
+				t.Fatalf("Start failed: %v", err)
+			}
+			if err := EndFlow(ctx, 1, 2, tt.end); err != nil {
+				t.Fatalf("EndFlow failed: %v", err)
+			}
+			c, _ := Get(ctx, 1, 2)
+			if (c != nil) != tt.wantKept {
+				t.Errorf("after EndFlow(%s) conversation = %v, want kept %v", tt.end, c, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestEndFlowWithoutConversation(t *testing.T) {
+	useMemoryStore(t)
+	if err := EndFlow(context.Background(), 1, 2, "broadcast"); err != nil {
+		t.Errorf("EndFlow = %v, want nil", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ctx := context.Background()
+	useMemoryStore(t)
+
+	if cancelled, err := Cancel(ctx, 1, 2); err != nil || cancelled {
+		t.Errorf("Cancel without a conversation = %v, %v, want false, nil", cancelled, err)
+	}
+
+	if _, err := Start(ctx, 1, 2, "schedule_edit", "value", nil, 0); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if cancelled, err := Cancel(ctx, 1, 2); err != nil || !cancelled {
+		t.Errorf("Cancel = %v, %v, want true, nil", cancelled, err)
+	}
+	if c, _ := Get(ctx, 1, 2); c != nil {
+		t.Errorf("conversation still there after Cancel: %+v", c)
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	ctx := context.Background()
+	useMemoryStore(t)
+
+	first, err := Start(ctx, 1, 2, "broadcast", "confirm", nil, 0)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if first.Version == 0 {
+		t.Fatal("expected the flow to get a version")
+	}
+	second, err := Start(ctx, 1, 2, "broadcast", "confirm", nil, 0)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if first.Version == second.Version {
+		t.Skip("both runs picked the same version")
+	}
+
+	tests := []struct {
+		name    string
+		flow    string
+		version uint64
+		want    bool
+	}{
+		{"current run", "broadcast", second.Version, true},
+		{"earlier run", "broadcast", first.Version, false},
+		{"other flow", "create_tournament", second.Version, false},
+		{"no version", "broadcast", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, err := Current(ctx, 1, 2, tt.flow, tt.version)
+			if err != nil {
+				t.Fatalf("Current failed: %v", err)
+			}
+			if current != tt.want {
+				t.Errorf("Current(%s, %d) = %v, want %v", tt.flow, tt.version, current, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrentWithoutConversation(t *testing.T) {
+	useMemoryStore(t)
+	if current, err := Current(context.Background(), 1, 2, "broadcast", 0); err != nil || current {
+		t.Errorf("Current = %v, %v, want false, nil", current, err)
+	}
+}
@@ -0,0 +1,144 @@
+package cron
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/eligibility"
+	"github.com/sukalov/mshkbot/internal/i18n"
+	"github.com/sukalov/mshkbot/internal/render"
+	"github.com/sukalov/mshkbot/internal/stats"
+)
+
+// Report renders the admin report for the tournaments opened in [from, to), split into messages
+// that fit telegram's limit. a tournament is never split between two messages
+func (s *Scheduler) Report(from, to time.Time) ([]string, error) {
+	archives, err := db.GetArchivesBetween(from, to)
+	if err != nil {
+		return nil, err
+	}
+	registrations, err := db.CountRegistrations(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := []string{fmt.Sprintf("отчёт за %s–%s", from.In(s.timezone).Format("02.01"), to.Add(-time.Second).In(s.timezone).Format("02.01"))}
+
+	entries, checkOuts := 0, 0
+	rejections := make(map[string]int)
+	for _, archive := range archives {
+		metadata, players, err := archive.Decode()
+		if err != nil {
+			log.Printf("skipping archived tournament: %v", err)
+			continue
+		}
+		summary := stats.Summarize(stats.Tournament{Metadata: metadata, Players: players})
+		blocks = append(blocks, s.describeSummary(summary))
+
+		entries += summary.Entries
+		checkOuts += summary.CheckOuts
+		if eligibility.IsGreen(metadata) {
+			for reason, n := range metadata.Rejections {
+				rejections[reason] += n
+			}
+		}
+	}
+
+	var builder strings.Builder
+	if len(archives) == 0 {
+		builder.WriteString("турниров не было\n\n")
+	} else {
+		builder.WriteString(fmt.Sprintf("всего записей: %d, выписались: %d%s\n", entries, checkOuts, percent(checkOuts, entries)))
+	}
+	builder.WriteString(fmt.Sprintf("новых регистраций: %d", registrations))
+
+	if len(rejections) > 0 {
+		reasons := make([]string, 0, len(rejections))
+		for reason := range rejections {
+			reasons = append(reasons, reason)
+		}
+		sort.Slice(reasons, func(i, j int) bool {
+			if rejections[reasons[i]] != rejections[reasons[j]] {
+				return rejections[reasons[i]] > rejections[reasons[j]]
+			}
+			return reasons[i] < reasons[j]
+		})
+		builder.WriteString("\n\nотказы в зелёных турнирах:")
+		for _, reason := range reasons {
+			builder.WriteString(fmt.Sprintf("\n%s — %d", reason, rejections[reason]))
+		}
+	}
+
+	blocks = append(blocks, builder.String())
+	return render.Pack(blocks, render.MaxMessageLength), nil
+}
+
+func (s *Scheduler) describeSummary(summary stats.Summary) string {
+	opened := summary.Metadata.OpenedAt.In(s.timezone)
+	day := i18n.T(i18n.Default, fmt.Sprintf("weekday.%d", opened.Weekday()))
+
+	lines := []string{
+		fmt.Sprintf("%s %s", day, opened.Format("02.01")),
+		fmt.Sprintf("записей: %d", summary.Entries),
+	}
+	if limit := summary.Metadata.Limit; limit > 0 {
+		lines = append(lines, fmt.Sprintf("мест занято: %d из %d (%.0f%%)", summary.Seated, limit, summary.FillRate()*100))
+	} else {
+		lines = append(lines, fmt.Sprintf("участников: %d, без лимита", summary.Seated))
+	}
+	lines = append(lines, fmt.Sprintf("очередь: %d, ждали в очереди: %d", summary.Queue, summary.Waited))
+	if summary.TimeToFull > 0 {
+		lines = append(lines, fmt.Sprintf("места закончились через %s после открытия", formatDuration(summary.TimeToFull)))
+	}
+	lines = append(lines, fmt.Sprintf("выписались: %d%s", summary.CheckOuts, percent(summary.CheckOuts, summary.Entries)))
+	return strings.Join(lines, "\n")
+}
+
+// sendWeeklyDigest posts the report for the current week to the admin group
+func (s *Scheduler) sendWeeklyDigest() {
+	now := time.Now().In(s.timezone)
+	daysSinceMonday := (int(now.Weekday()) + 6) % 7
+	monday := time.Date(now.Year(), now.Month(), now.Day()-daysSinceMonday, 0, 0, 0, 0, s.timezone)
+
+	report, err := s.Report(monday, now)
+	if err != nil {
+		log.Printf("failed to build weekly digest: %v", err)
+		return
+	}
+	for _, message := range report {
+		s.notifyAdmins(message)
+	}
+	log.Println("weekly digest sent to admin chat")
+}
+
+// isLastEventOfWeek tells whether no approved event is left after today until sunday
+func (s *Scheduler) isLastEventOfWeek(now time.Time) bool {
+	for day := now.Weekday(); day != time.Sunday; {
+		day = (day + 1) % 7
+		if s.ScheduleManager.GetEventForWeekday(day) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func percent(part, total int) string {
+	if total == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%.0f%%)", float64(part)/float64(total)*100)
+}
+
+// formatDuration writes a duration as hours and minutes
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	if hours == 0 {
+		return fmt.Sprintf("%d мин", minutes)
+	}
+	return fmt.Sprintf("%d ч %d мин", hours, minutes)
+}
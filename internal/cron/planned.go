@@ -0,0 +1,80 @@
+package cron
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/redis"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// PlanTournament opens the tournament at openAt, or right away when that time has passed.
+// only one tournament can wait to be opened
+func (s *Scheduler) PlanTournament(ctx context.Context, openAt time.Time, metadata types.TournamentMetadata) error {
+	if !openAt.After(time.Now()) {
+		return s.OpenTournament(metadata)
+	}
+
+	planned, err := redis.GetPlannedTournament(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get planned tournament: %w", err)
+	}
+	if planned != nil {
+		return fmt.Errorf("another tournament is planned for %s", planned.OpenAt.In(s.timezone).Format("02.01 15:04"))
+	}
+
+	metadata.Phase = types.PhaseScheduled
+	if err := redis.SetPlannedTournament(ctx, types.PlannedTournament{OpenAt: openAt, Metadata: metadata}); err != nil {
+		return fmt.Errorf("failed to save planned tournament: %w", err)
+	}
+	log.Printf("tournament planned for %s", openAt.In(s.timezone).Format("2006-01-02 15:04"))
+	return nil
+}
+
+// runTournamentClock moves tournaments through their phases: it opens the planned tournament
+// when its time comes, closes registration of the running one when it starts and ends it
+// once its close time has passed
+func (s *Scheduler) runTournamentClock() {
+	ctx := context.Background()
+	now := time.Now()
+
+	metadata := s.bot.Tournament.Metadata
+	if metadata.Exists && metadata.CurrentPhase() == types.PhaseOpen && metadata.StartsAt != nil && !now.Before(*metadata.StartsAt) {
+		if err := s.bot.Tournament.SetPhase(ctx, types.PhaseClosed); err != nil {
+			log.Printf("failed to close registration: %v", err)
+		} else {
+			log.Printf("registration for tournament %s closed", metadata.ID)
+		}
+	}
+
+	if closeAt := s.bot.Tournament.Metadata.CloseAt; s.bot.Tournament.Metadata.Exists && closeAt != nil && !now.Before(*closeAt) {
+		log.Printf("closing tournament %s on time", s.bot.Tournament.Metadata.ID)
+		s.scheduledTournamentEnd()
+	}
+
+	planned, err := redis.GetPlannedTournament(ctx)
+	if err != nil {
+		log.Printf("failed to get planned tournament: %v", err)
+		return
+	}
+	if planned == nil || now.Before(planned.OpenAt) {
+		return
+	}
+	if s.bot.Tournament.Metadata.Exists {
+		// the running tournament has to end first, try again next minute
+		return
+	}
+
+	if err := redis.ClearPlannedTournament(ctx); err != nil {
+		log.Printf("failed to clear planned tournament: %v", err)
+		return
+	}
+	if err := s.OpenTournament(planned.Metadata); err != nil {
+		log.Printf("failed to open planned tournament: %v", err)
+		if err := s.bot.SendMessage(s.adminGroupID, fmt.Sprintf("не получилось открыть запланированный турнир: %v", err)); err != nil {
+			log.Printf("failed to notify admins: %v", err)
+		}
+	}
+}
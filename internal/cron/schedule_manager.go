@@ -10,28 +10,37 @@ import (
 
 	redisClient "github.com/go-redis/redis/v8"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/callback"
 	"github.com/sukalov/mshkbot/internal/redis"
+	"github.com/sukalov/mshkbot/internal/types"
 )
 
 type ScheduledEvent struct {
-	ID            string       `json:"id"`
-	Day           string       `json:"day"`
-	Weekday       time.Weekday `json:"weekday"`
-	StartHour     int          `json:"start_hour"`
-	EndHour       int          `json:"end_hour"`
-	Limit         int          `json:"limit"`
-	LichessLimit  int          `json:"lichess_limit"`
-	ChesscomLimit int          `json:"chesscom_limit"`
-	Intro         string       `json:"intro"`
-	Deleted       bool         `json:"deleted"`
+	ID      string       `json:"id"`
+	Day     string       `json:"day"`
+	Weekday time.Weekday `json:"weekday"`
+	// StartHour is when registration opens, GameHour when the games start and registration closes
+	StartHour     int    `json:"start_hour"`
+	GameHour      int    `json:"game_hour,omitempty"`
+	EndHour       int    `json:"end_hour"`
+	Limit         int    `json:"limit"`
+	LichessLimit  int    `json:"lichess_limit"`
+	ChesscomLimit int    `json:"chesscom_limit"`
+	OTBLimit      int    `json:"otb_limit"`
+	Intro         string `json:"intro"`
+	Deleted       bool   `json:"deleted"`
+	// announcement layout in text/template, empty for the default one
+	Template string `json:"template,omitempty"`
+	// what happens to players whose ratings can't be fetched: allow, pending or reject
+	UnverifiedPolicy string `json:"unverified_policy,omitempty"`
 }
 
 type WeekSchedule struct {
-	Events         []*ScheduledEvent `json:"events"`
-	Approved       bool              `json:"approved"`
-	MessageID      int               `json:"message_id"`
-	EditingEventID string            `json:"editing_event_id"`
-	EditingField   string            `json:"editing_field"`
+	Events    []*ScheduledEvent `json:"events"`
+	Approved  bool              `json:"approved"`
+	MessageID int               `json:"message_id"`
+	// Version changes with every edit, buttons drawn for an older version are refused
+	Version uint64 `json:"version"`
 }
 
 type ScheduleManager struct {
@@ -43,6 +52,13 @@ func NewScheduleManager() *ScheduleManager {
 	return &ScheduleManager{}
 }
 
+// events saved before registration and games had hours of their own kept the game start in StartHour
+// and opened registration at defaultStartHour
+const (
+	defaultStartHour = 12
+	defaultGameHour  = 19
+)
+
 func getHardcodedDefaults() []*ScheduledEvent {
 	return []*ScheduledEvent{
 		{
@@ -50,6 +66,7 @@ func getHardcodedDefaults() []*ScheduledEvent {
 			Day:           "понедельник",
 			Weekday:       time.Monday,
 			StartHour:     12,
+			GameHour:      19,
 			EndHour:       21,
 			Limit:         32,
 			LichessLimit:  0,
@@ -61,6 +78,7 @@ func getHardcodedDefaults() []*ScheduledEvent {
 			Day:           "вторник",
 			Weekday:       time.Tuesday,
 			StartHour:     12,
+			GameHour:      19,
 			EndHour:       21,
 			Limit:         24,
 			LichessLimit:  1600,
@@ -72,6 +90,7 @@ func getHardcodedDefaults() []*ScheduledEvent {
 			Day:           "среда",
 			Weekday:       time.Wednesday,
 			StartHour:     12,
+			GameHour:      19,
 			EndHour:       21,
 			Limit:         24,
 			LichessLimit:  0,
@@ -98,6 +117,16 @@ func (sm *ScheduleManager) GetDefaultEvents() []*ScheduledEvent {
 		return getHardcodedDefaults()
 	}
 
+	for _, e := range events {
+		if e.GameHour != 0 {
+			continue
+		}
+		e.GameHour = e.StartHour
+		if e.GameHour <= defaultStartHour {
+			e.GameHour = defaultGameHour
+		}
+		e.StartHour = defaultStartHour
+	}
 	return events
 }
 
@@ -125,12 +154,17 @@ func (sm *ScheduleManager) SaveCurrentAsDefaults() error {
 			Day:           e.Day,
 			Weekday:       e.Weekday,
 			StartHour:     e.StartHour,
+			GameHour:      e.GameHour,
 			EndHour:       e.EndHour,
 			Limit:         e.Limit,
 			LichessLimit:  e.LichessLimit,
 			ChesscomLimit: e.ChesscomLimit,
+			OTBLimit:      e.OTBLimit,
 			Intro:         e.Intro,
 			Deleted:       false,
+
+			UnverifiedPolicy: e.UnverifiedPolicy,
+			Template:         e.Template,
 		}
 	}
 
@@ -141,10 +175,22 @@ func (sm *ScheduleManager) InitWeekSchedule() {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
+	// seeded from the clock so buttons of a schedule sent before a restart don't match the new one
 	sm.current = &WeekSchedule{
 		Events:   sm.GetDefaultEvents(),
 		Approved: false,
+		Version:  uint64(time.Now().Unix()),
+	}
+}
+
+// Version returns the version of the current schedule, 0 when there is none
+func (sm *ScheduleManager) Version() uint64 {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	if sm.current == nil {
+		return 0
 	}
+	return sm.current.Version
 }
 
 func (sm *ScheduleManager) GetCurrentSchedule() *WeekSchedule {
@@ -167,6 +213,7 @@ func (sm *ScheduleManager) SetApproved(approved bool) {
 	defer sm.mu.Unlock()
 	if sm.current != nil {
 		sm.current.Approved = approved
+		sm.current.Version++
 	}
 }
 
@@ -196,6 +243,7 @@ func (sm *ScheduleManager) DeleteEvent(eventID string) bool {
 	for _, e := range sm.current.Events {
 		if e.ID == eventID {
 			e.Deleted = true
+			sm.current.Version++
 			return true
 		}
 	}
@@ -211,6 +259,7 @@ func (sm *ScheduleManager) RestoreEvent(eventID string) bool {
 	for _, e := range sm.current.Events {
 		if e.ID == eventID {
 			e.Deleted = false
+			sm.current.Version++
 			return true
 		}
 	}
@@ -231,33 +280,6 @@ func (sm *ScheduleManager) GetEvent(eventID string) *ScheduledEvent {
 	return nil
 }
 
-func (sm *ScheduleManager) SetEditingEvent(eventID, field string) {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
-	if sm.current != nil {
-		sm.current.EditingEventID = eventID
-		sm.current.EditingField = field
-	}
-}
-
-func (sm *ScheduleManager) GetEditingState() (eventID, field string) {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
-	if sm.current == nil {
-		return "", ""
-	}
-	return sm.current.EditingEventID, sm.current.EditingField
-}
-
-func (sm *ScheduleManager) ClearEditingState() {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
-	if sm.current != nil {
-		sm.current.EditingEventID = ""
-		sm.current.EditingField = ""
-	}
-}
-
 func (sm *ScheduleManager) UpdateEventField(eventID, field string, value interface{}) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
@@ -295,16 +317,47 @@ func (sm *ScheduleManager) UpdateEventField(eventID, field string, value interfa
 		} else {
 			return fmt.Errorf("invalid value type for chesscom_limit")
 		}
+	case "otb_limit":
+		if v, ok := value.(int); ok {
+			event.OTBLimit = v
+		} else {
+			return fmt.Errorf("invalid value type for otb_limit")
+		}
+	case "start_hour":
+		if v, ok := value.(int); ok {
+			event.StartHour = v
+		} else {
+			return fmt.Errorf("invalid value type for start_hour")
+		}
+	case "game_hour":
+		if v, ok := value.(int); ok {
+			event.GameHour = v
+		} else {
+			return fmt.Errorf("invalid value type for game_hour")
+		}
+	case "unverified_policy":
+		if v, ok := value.(string); ok {
+			event.UnverifiedPolicy = v
+		} else {
+			return fmt.Errorf("invalid value type for unverified_policy")
+		}
 	case "intro":
 		if v, ok := value.(string); ok {
 			event.Intro = v
 		} else {
 			return fmt.Errorf("invalid value type for intro")
 		}
+	case "template":
+		if v, ok := value.(string); ok {
+			event.Template = v
+		} else {
+			return fmt.Errorf("invalid value type for template")
+		}
 	default:
 		return fmt.Errorf("unknown field: %s", field)
 	}
 
+	sm.current.Version++
 	return nil
 }
 
@@ -355,13 +408,23 @@ func (sm *ScheduleManager) FormatScheduleMessage() string {
 			statusIcon = "❌"
 		}
 
-		msg += fmt.Sprintf("%s *%s* (%02d:00 - %02d:00)\n", statusIcon, e.Day, e.StartHour, e.EndHour)
+		msg += fmt.Sprintf("%s *%s* (запись с %02d:00, игры %02d:00 - %02d:00)\n", statusIcon, e.Day, e.StartHour, e.GameHour, e.EndHour)
 		msg += fmt.Sprintf("   лимит: %d", e.Limit)
 		if e.LichessLimit > 0 || e.ChesscomLimit > 0 {
 			msg += fmt.Sprintf(" | lichess<%d, chesscom<%d", e.LichessLimit, e.ChesscomLimit)
 		}
+		if e.OTBLimit > 0 {
+			msg += fmt.Sprintf(" | фиде/фшр<%d", e.OTBLimit)
+		}
+		if e.UnverifiedPolicy != "" && e.UnverifiedPolicy != types.UnverifiedAllow {
+			msg += fmt.Sprintf(" | без проверки: %s", e.UnverifiedPolicy)
+		}
+		msg += "\n"
+		msg += fmt.Sprintf("   текст: _%s_\n", truncateString(e.Intro, 150))
+		if e.Template != "" {
+			msg += "   список: свой шаблон\n"
+		}
 		msg += "\n"
-		msg += fmt.Sprintf("   текст: _%s_\n\n", truncateString(e.Intro, 150))
 	}
 
 	if sm.current.Approved {
@@ -381,30 +444,37 @@ func truncateString(s string, maxLen int) string {
 	return string(runes[:maxLen-3]) + "..."
 }
 
-func GetScheduleMainKeyboard() tgbotapi.InlineKeyboardMarkup {
+// scheduleButton builds a button of the schedule menu signed for the given schedule version
+func scheduleButton(version uint64, text string, args ...string) tgbotapi.InlineKeyboardButton {
+	return tgbotapi.NewInlineKeyboardButtonData(text, callback.Encode("schedule", version, args...))
+}
+
+func (sm *ScheduleManager) GetScheduleMainKeyboard() tgbotapi.InlineKeyboardMarkup {
+	version := sm.Version()
 	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("всё верно", "schedule:approve"),
+			scheduleButton(version, "всё верно", "approve"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("редактировать", "schedule:edit"),
-			tgbotapi.NewInlineKeyboardButtonData("удалить", "schedule:delete"),
+			scheduleButton(version, "редактировать", "edit"),
+			scheduleButton(version, "удалить", "delete"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("сохранить как дефолт", "schedule:save_defaults"),
+			scheduleButton(version, "сохранить как дефолт", "save_defaults"),
 		),
 	)
 }
 
-func GetScheduleSelectEventKeyboard(action string) tgbotapi.InlineKeyboardMarkup {
+func (sm *ScheduleManager) GetScheduleSelectEventKeyboard(action string) tgbotapi.InlineKeyboardMarkup {
+	version := sm.Version()
 	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("понедельник", fmt.Sprintf("schedule:%s:monday", action)),
-			tgbotapi.NewInlineKeyboardButtonData("вторник", fmt.Sprintf("schedule:%s:tuesday", action)),
-			tgbotapi.NewInlineKeyboardButtonData("среда", fmt.Sprintf("schedule:%s:wednesday", action)),
+			scheduleButton(version, "понедельник", action, "monday"),
+			scheduleButton(version, "вторник", action, "tuesday"),
+			scheduleButton(version, "среда", action, "wednesday"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("<< назад", "schedule:back"),
+			scheduleButton(version, "<< назад", "back"),
 		),
 	)
 }
@@ -421,39 +491,49 @@ func (sm *ScheduleManager) GetDeleteEventKeyboard() tgbotapi.InlineKeyboardMarku
 		} else {
 			label = "[-] " + e.Day
 		}
-		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(label, fmt.Sprintf("schedule:delete_event:%s", e.ID)))
+		buttons = append(buttons, scheduleButton(sm.current.Version, label, "delete_event", e.ID))
 	}
 
 	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(buttons...),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("<< назад", "schedule:back"),
+			scheduleButton(sm.current.Version, "<< назад", "back"),
 		),
 	)
 }
 
-func GetScheduleEditFieldKeyboard(eventID string) tgbotapi.InlineKeyboardMarkup {
+func (sm *ScheduleManager) GetScheduleEditFieldKeyboard(eventID string) tgbotapi.InlineKeyboardMarkup {
+	version := sm.Version()
 	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("лимит участников", fmt.Sprintf("schedule:field:%s:limit", eventID)),
+			scheduleButton(version, "открытие записи", "field", eventID, "start_hour"),
+			scheduleButton(version, "начало игр", "field", eventID, "game_hour"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			scheduleButton(version, "лимит участников", "field", eventID, "limit"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			scheduleButton(version, "лимит lichess", "field", eventID, "lichess_limit"),
+			scheduleButton(version, "лимит chesscom", "field", eventID, "chesscom_limit"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("лимит lichess", fmt.Sprintf("schedule:field:%s:lichess_limit", eventID)),
-			tgbotapi.NewInlineKeyboardButtonData("лимит chesscom", fmt.Sprintf("schedule:field:%s:chesscom_limit", eventID)),
+			scheduleButton(version, "лимит фиде/фшр", "field", eventID, "otb_limit"),
+			scheduleButton(version, "если сайт лежит", "field", eventID, "unverified_policy"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("текст объявления", fmt.Sprintf("schedule:field:%s:intro", eventID)),
+			scheduleButton(version, "текст объявления", "field", eventID, "intro"),
+			scheduleButton(version, "шаблон списка", "field", eventID, "template"),
 		),
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("<< назад", "schedule:back"),
+			scheduleButton(version, "<< назад", "back"),
 		),
 	)
 }
 
-func GetScheduleBackKeyboard() tgbotapi.InlineKeyboardMarkup {
+func (sm *ScheduleManager) GetScheduleBackKeyboard() tgbotapi.InlineKeyboardMarkup {
 	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("<< назад", "schedule:back"),
+			scheduleButton(sm.Version(), "<< назад", "back"),
 		),
 	)
 }
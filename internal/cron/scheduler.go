@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/types"
 )
 
 type Scheduler struct {
@@ -46,26 +48,10 @@ func (s *Scheduler) Start() {
 		s.sendSchedulePreview()
 	})
 
-	s.scheduleWeekly(time.Monday, 12, 0, func() {
-		s.scheduledTournamentStartFromSchedule(time.Monday)
-	})
-	s.scheduleWeekly(time.Monday, 21, 0, func() {
-		s.scheduledTournamentEndFromSchedule(time.Monday)
-	})
-
-	s.scheduleWeekly(time.Tuesday, 12, 0, func() {
-		s.scheduledTournamentStartFromSchedule(time.Tuesday)
-	})
-	s.scheduleWeekly(time.Tuesday, 21, 0, func() {
-		s.scheduledTournamentEndFromSchedule(time.Tuesday)
-	})
+	s.scheduleHourly(s.openScheduledRegistration)
 
-	s.scheduleWeekly(time.Wednesday, 12, 0, func() {
-		s.scheduledTournamentStartFromSchedule(time.Wednesday)
-	})
-	s.scheduleWeekly(time.Wednesday, 21, 0, func() {
-		s.scheduledTournamentEndFromSchedule(time.Wednesday)
-	})
+	s.scheduleEvery(5*time.Minute, s.reverifyPlayers)
+	s.scheduleEvery(time.Minute, s.runTournamentClock)
 }
 
 func (s *Scheduler) Stop() {
@@ -101,6 +87,57 @@ func (s *Scheduler) scheduleWeekly(weekday time.Weekday, hour, minute int, handl
 	}()
 }
 
+// scheduleEvery creates a goroutine that runs a task at a fixed interval
+func (s *Scheduler) scheduleEvery(interval time.Duration, handler func()) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				handler()
+			case <-s.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// scheduleHourly creates a goroutine that runs a task at the start of every hour
+func (s *Scheduler) scheduleHourly(handler func()) {
+	go func() {
+		timer := time.NewTimer(untilNextHour())
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-timer.C:
+				handler()
+				timer.Reset(untilNextHour())
+			case <-s.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+func untilNextHour() time.Duration {
+	now := time.Now()
+	return now.Truncate(time.Hour).Add(time.Hour).Sub(now)
+}
+
+// openScheduledRegistration opens today's approved event when its registration hour comes
+func (s *Scheduler) openScheduledRegistration() {
+	now := time.Now().In(s.timezone)
+	event := s.ScheduleManager.GetEventForWeekday(now.Weekday())
+	if event == nil || event.StartHour != now.Hour() {
+		return
+	}
+	log.Printf("registration hour of %s has come", event.Day)
+	s.scheduledTournamentStartFromSchedule(now.Weekday())
+}
+
 // timeUntilNext calculates duration until the next occurrence of the scheduled task
 func (s *Scheduler) timeUntilNext(task scheduledTask) time.Duration {
 	now := time.Now().In(s.timezone)
@@ -127,54 +164,86 @@ func (s *Scheduler) timeUntilNext(task scheduledTask) time.Duration {
 	return duration
 }
 
-func (s *Scheduler) scheduledTournamentStart(limit int, lichessRatingLimit int, chesscomRatingLimit int, announcementIntro string) {
+func (s *Scheduler) scheduledTournamentStart(metadata types.TournamentMetadata) {
+	if err := s.OpenTournament(metadata); err != nil {
+		log.Printf("failed to start scheduled tournament: %v", err)
+	}
+}
+
+// OpenTournament creates the tournament and posts and pins its announcement in the main group
+func (s *Scheduler) OpenTournament(metadata types.TournamentMetadata) error {
 	ctx := context.Background()
 
-	if err := s.bot.Tournament.CreateTournament(ctx, limit, lichessRatingLimit, chesscomRatingLimit, announcementIntro); err != nil {
-		log.Printf("failed to create tournament: %v", err)
-		return
+	if err := s.bot.Tournament.CreateTournament(ctx, metadata); err != nil {
+		return fmt.Errorf("failed to create tournament: %w", err)
 	}
 
-	announcementMessage := announcementIntro + "\n\nучастники:\nпока никого нет"
-
-	messageID, err := s.bot.SendMessageAndGetID(s.mainGroupID, announcementMessage)
+	messageID, err := s.bot.PostAnnouncement(s.bot.Tournament.AnnouncementText())
+	if err != nil && metadata.AnnouncementTemplate != "" {
+		// telegram refused the event template, the list still has to be posted
+		log.Printf("failed to post announcement with the event template, falling back to the default one: %v", err)
+		if err := s.bot.Tournament.DropAnnouncementTemplate(ctx); err != nil {
+			log.Printf("failed to drop announcement template: %v", err)
+		}
+		messageID, err = s.bot.PostAnnouncement(s.bot.Tournament.AnnouncementText())
+	}
 	if err != nil {
-		log.Printf("failed to send message: %v", err)
-		return
+		return fmt.Errorf("failed to post announcement: %w", err)
 	}
 
 	if err := s.bot.Tournament.SetAnnouncementMessageID(ctx, messageID); err != nil {
 		log.Printf("failed to store announcement message ID: %v", err)
 	}
 
-	if err := s.bot.PinMessage(s.mainGroupID, messageID); err != nil {
-		log.Printf("failed to pin message: %v", err)
-	}
+	go s.notifySubscribers(s.bot.Tournament.Metadata)
 
-	log.Printf("tournament started: limit=%d, lichess_limit=%d, chesscom_limit=%d, intro=%s", limit, lichessRatingLimit, chesscomRatingLimit, announcementIntro)
+	log.Printf("tournament started: limit=%d, lichess_limit=%d, chesscom_limit=%d, otb_limit=%d, unverified_policy=%s, intro=%s", metadata.Limit, metadata.LichessRatingLimit, metadata.ChesscomRatingLimit, metadata.OTBRatingLimit, metadata.UnverifiedPolicy, metadata.AnnouncementIntro)
+	return nil
 }
 
 func (s *Scheduler) scheduledTournamentEnd() {
-	ctx := context.Background()
-
 	if !s.bot.Tournament.Metadata.Exists {
 		log.Printf("no tournament to end")
 		return
 	}
 
-	announcementMessageID := s.bot.Tournament.Metadata.AnnouncementMessageID
-	if announcementMessageID != 0 {
-		if err := s.bot.UnpinMessage(s.mainGroupID, announcementMessageID); err != nil {
+	if err := s.FinishTournament(context.Background()); err != nil {
+		log.Printf("failed to end tournament: %v", err)
+		return
+	}
+
+	log.Printf("tournament ended and removed")
+}
+
+// FinishTournament unpins the announcement, archives the tournament if anyone signed up and removes it
+func (s *Scheduler) FinishTournament(ctx context.Context) error {
+	metadata := s.bot.Tournament.Metadata
+	players := s.bot.Tournament.Players()
+
+	if metadata.AnnouncementMessageID != 0 {
+		if err := s.bot.UnpinMessage(s.mainGroupID, metadata.AnnouncementMessageID); err != nil {
 			log.Printf("failed to unpin message: %v", err)
 		}
 	}
 
+	if len(players) > 0 {
+		metadata.Phase = types.PhaseFinished
+		if err := db.ArchiveTournament(metadata, players); err != nil {
+			log.Printf("failed to archive tournament %s: %v", metadata.ID, err)
+		} else {
+			log.Printf("tournament %s archived with %d players", metadata.ID, len(players))
+		}
+	}
+
 	if err := s.bot.Tournament.RemoveTournament(ctx); err != nil {
-		log.Printf("failed to remove tournament: %v", err)
-		return
+		return fmt.Errorf("failed to remove tournament: %w", err)
 	}
 
-	log.Printf("tournament ended and removed")
+	// the digest follows the last scheduled tournament of the week
+	if metadata.EventID != "" && s.isLastEventOfWeek(time.Now().In(s.timezone)) {
+		go s.sendWeeklyDigest()
+	}
+	return nil
 }
 
 func (s *Scheduler) sendSchedulePreview() {
@@ -183,7 +252,7 @@ func (s *Scheduler) sendSchedulePreview() {
 	s.ScheduleManager.InitWeekSchedule()
 
 	message := s.ScheduleManager.FormatScheduleMessage()
-	keyboard := GetScheduleMainKeyboard()
+	keyboard := s.ScheduleManager.GetScheduleMainKeyboard()
 
 	messageID, err := s.bot.SendMessageWithButtonsAndGetID(s.adminGroupID, message, keyboard)
 	if err != nil {
@@ -202,7 +271,7 @@ func (s *Scheduler) UpdateScheduleMessage() error {
 	}
 
 	message := s.ScheduleManager.FormatScheduleMessage()
-	keyboard := GetScheduleMainKeyboard()
+	keyboard := s.ScheduleManager.GetScheduleMainKeyboard()
 
 	return s.bot.EditMessageWithButtons(s.adminGroupID, messageID, message, keyboard)
 }
@@ -215,6 +284,11 @@ func (s *Scheduler) GetAdminGroupID() int64 {
 	return s.adminGroupID
 }
 
+// Timezone is the zone the schedule and admin-entered times are in
+func (s *Scheduler) Timezone() *time.Location {
+	return s.timezone
+}
+
 func (s *Scheduler) scheduledTournamentStartFromSchedule(weekday time.Weekday) {
 	event := s.ScheduleManager.GetEventForWeekday(weekday)
 	if event == nil {
@@ -222,15 +296,28 @@ func (s *Scheduler) scheduledTournamentStartFromSchedule(weekday time.Weekday) {
 		return
 	}
 
-	s.scheduledTournamentStart(event.Limit, event.LichessLimit, event.ChesscomLimit, event.Intro)
-}
+	metadata := types.TournamentMetadata{
+		EventID:              event.ID,
+		Limit:                event.Limit,
+		LichessRatingLimit:   event.LichessLimit,
+		ChesscomRatingLimit:  event.ChesscomLimit,
+		OTBRatingLimit:       event.OTBLimit,
+		AnnouncementIntro:    event.Intro,
+		AnnouncementTemplate: event.Template,
+		UnverifiedPolicy:     event.UnverifiedPolicy,
+	}
 
-func (s *Scheduler) scheduledTournamentEndFromSchedule(weekday time.Weekday) {
-	event := s.ScheduleManager.GetEventForWeekday(weekday)
-	if event == nil {
-		log.Printf("no approved event for %s, skipping tournament end", weekday)
-		return
+	// registration opens now, closes when the games start and the tournament is archived at the end hour.
+	// hours that have already passed today are left out
+	now := time.Now().In(s.timezone)
+	startsAt := time.Date(now.Year(), now.Month(), now.Day(), event.GameHour, 0, 0, 0, s.timezone)
+	if startsAt.After(now) {
+		metadata.StartsAt = &startsAt
+	}
+	closeAt := time.Date(now.Year(), now.Month(), now.Day(), event.EndHour, 0, 0, 0, s.timezone)
+	if closeAt.After(now) {
+		metadata.CloseAt = &closeAt
 	}
 
-	s.scheduledTournamentEnd()
+	s.scheduledTournamentStart(metadata)
 }
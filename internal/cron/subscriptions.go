@@ -0,0 +1,48 @@
+package cron
+
+import (
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/callback"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/eligibility"
+	"github.com/sukalov/mshkbot/internal/i18n"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// notifySubscribers messages everyone subscribed to the tournament's event or category
+// with a button that checks them in
+func (s *Scheduler) notifySubscribers(metadata types.TournamentMetadata) {
+	topics := []string{types.TopicAll}
+	if metadata.EventID != "" {
+		topics = append(topics, types.EventTopic(metadata.EventID))
+	}
+	if eligibility.IsGreen(metadata) {
+		topics = append(topics, types.TopicGreen)
+	}
+
+	users, err := db.GetSubscribers(topics...)
+	if err != nil {
+		log.Printf("failed to get subscribers: %v", err)
+		return
+	}
+
+	version := bot.TournamentVersion(s.bot)
+	delivered, failed := 0, 0
+	for _, user := range users {
+		lang := i18n.Match(user.Language, "")
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "announcement.join"), callback.Encode(bot.EntryRoute, version, bot.EntryJoin)),
+		))
+		if err := s.bot.SendBulkMessageWithButtons(user.ChatID, i18n.T(lang, "subscribe.opened", metadata.AnnouncementIntro), keyboard); err != nil {
+			log.Printf("failed to notify subscriber %d: %v", user.ChatID, err)
+			failed++
+			continue
+		}
+		delivered++
+	}
+
+	log.Printf("notified subscribers of tournament %s: %d delivered, %d failed", metadata.ID, delivered, failed)
+}
@@ -0,0 +1,113 @@
+package cron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/eligibility"
+	"github.com/sukalov/mshkbot/internal/i18n"
+	"github.com/sukalov/mshkbot/internal/tournament"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// reverifyPlayers re-runs rating checks for players admitted or held while a rating site was down
+func (s *Scheduler) reverifyPlayers() {
+	if !s.bot.Tournament.Metadata.Exists {
+		return
+	}
+
+	ctx := context.Background()
+	players := s.bot.Tournament.Players()
+	changed := false
+
+	for _, player := range players {
+		if player.IsGuest() || player.State == types.StateCheckedOut || (!player.Unverified && player.State != types.StatePending) {
+			continue
+		}
+
+		user, err := db.GetByChatID(int64(player.ID))
+		if err != nil {
+			log.Printf("failed to get user %d for re-verification: %v", player.ID, err)
+			continue
+		}
+
+		snapshot := eligibility.Check(user, s.bot.Tournament.Metadata)
+		lang := i18n.Match(user.Language, "")
+
+		switch snapshot.Decision {
+		case types.DecisionUnverified:
+			continue
+
+		case types.DecisionRejected:
+			promoted, err := s.bot.Tournament.RemoveRejected(ctx, player.ID, player.State)
+			if errors.Is(err, tournament.ErrPlayerMoved) {
+				log.Printf("player %d changed state during re-verification, skipping", player.ID)
+				continue
+			}
+			if err != nil {
+				log.Printf("failed to remove player %d after re-verification: %v", player.ID, err)
+				continue
+			}
+			if err := db.DecrementTimesPlayed(int64(player.ID)); err != nil {
+				log.Printf("failed to decrement times played for user %d: %v", player.ID, err)
+			}
+			if promoted != nil {
+				log.Printf("promoted player %d (%s) from queue to tournament", promoted.ID, promoted.Username)
+			}
+			log.Printf("player %d (%s) removed after re-verification: %s", player.ID, player.Username, snapshot.Reason)
+			if err := s.bot.Tournament.RecordRejection(ctx, snapshot.Reason); err != nil {
+				log.Printf("failed to record rejection: %v", err)
+			}
+
+			if err := s.bot.SendMessage(int64(player.ID), i18n.T(lang, "verification.removed", eligibility.RejectionMessage(lang, snapshot.Reason))); err != nil {
+				log.Printf("failed to notify player %d: %v", player.ID, err)
+			}
+			s.notifyAdmins(fmt.Sprintf("%s (@%s) снят с турнира после повторной проверки рейтинга: %s", player.SavedName, player.Username, snapshot.Reason))
+
+		case types.DecisionAdmitted:
+			updatedPlayer, err := s.bot.Tournament.UpdateVerified(ctx, player.ID, player.State, func(p *types.Player) {
+				p.Eligibility = snapshot
+				p.PeakRating = eligibility.PeakRating(snapshot)
+				p.OTBRating = eligibility.OTBRating(snapshot)
+				p.Unverified = false
+			})
+			if errors.Is(err, tournament.ErrPlayerMoved) {
+				log.Printf("player %d changed state during re-verification, skipping", player.ID)
+				continue
+			}
+			if err != nil {
+				log.Printf("failed to update player %d after re-verification: %v", player.ID, err)
+				continue
+			}
+			log.Printf("player %d (%s) verified in background", player.ID, player.Username)
+
+			switch {
+			case player.State != types.StatePending:
+			case updatedPlayer.State == types.StateQueued:
+				if err := s.bot.SendMessage(int64(player.ID), i18n.T(lang, "verification.queued")); err != nil {
+					log.Printf("failed to notify player %d: %v", player.ID, err)
+				}
+			default:
+				if err := s.bot.SendMessage(int64(player.ID), i18n.T(lang, "verification.admitted")); err != nil {
+					log.Printf("failed to notify player %d: %v", player.ID, err)
+				}
+			}
+			s.notifyAdmins(fmt.Sprintf("рейтинг %s (@%s) проверен, всё в порядке", player.SavedName, player.Username))
+		}
+
+		changed = true
+	}
+
+	if changed {
+		s.bot.Tournament.MarkAnnouncementDirty()
+	}
+}
+
+func (s *Scheduler) notifyAdmins(message string) {
+	if err := s.bot.SendMessage(s.adminGroupID, message); err != nil {
+		log.Printf("failed to send message to admin chat: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+// admins.go
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GroupAdmin is an administrator of the admin group as reported by telegram
+type GroupAdmin struct {
+	UserID   int64
+	Username string
+	Creator  bool
+}
+
+// GetAdmins returns everyone with a role
+func GetAdmins() ([]Admin, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var admins []Admin
+	if err := Database.WithContext(ctx).Order("added_at").Find(&admins).Error; err != nil {
+		return nil, fmt.Errorf("failed to get admins: %w", err)
+	}
+	return admins, nil
+}
+
+// SetRole gives the user a role by hand. manual roles survive admin group syncs
+func SetRole(userID int64, username string, role Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	admin := Admin{UserID: userID, Username: username, Role: role, Source: AdminSourceManual}
+	result := Database.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"username", "role", "source"}),
+	}).Create(&admin)
+	if result.Error != nil {
+		return fmt.Errorf("failed to set role: %w", result.Error)
+	}
+	return nil
+}
+
+// RemoveRole takes every role away from the user
+func RemoveRole(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := Database.WithContext(ctx).Where("user_id = ?", userID).Delete(&Admin{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove role: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("no admin found with user id: %d", userID)
+	}
+	return nil
+}
+
+// SyncGroupAdmins mirrors admin group administrators into the admins table.
+// the creator becomes owner, the rest admins. roles given by hand are left alone
+func SyncGroupAdmins(groupAdmins []GroupAdmin) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return Database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing []Admin
+		if err := tx.Find(&existing).Error; err != nil {
+			return fmt.Errorf("failed to get admins: %w", err)
+		}
+
+		manual := make(map[int64]bool)
+		current := make(map[int64]bool)
+		for _, admin := range existing {
+			if admin.Source == AdminSourceManual {
+				manual[admin.UserID] = true
+			}
+		}
+
+		for _, groupAdmin := range groupAdmins {
+			current[groupAdmin.UserID] = true
+			if manual[groupAdmin.UserID] {
+				continue
+			}
+
+			role := RoleAdmin
+			if groupAdmin.Creator {
+				role = RoleOwner
+			}
+			admin := Admin{UserID: groupAdmin.UserID, Username: groupAdmin.Username, Role: role, Source: AdminSourceTelegram}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"username", "role"}),
+			}).Create(&admin).Error; err != nil {
+				return fmt.Errorf("failed to save group admin %d: %w", groupAdmin.UserID, err)
+			}
+		}
+
+		// people who stopped being group administrators lose the role they got from it
+		for _, admin := range existing {
+			if admin.Source == AdminSourceTelegram && !current[admin.UserID] {
+				if err := tx.Where("user_id = ?", admin.UserID).Delete(&Admin{}).Error; err != nil {
+					return fmt.Errorf("failed to remove former group admin %d: %w", admin.UserID, err)
+				}
+			}
+		}
+
+		return nil
+	})
+}
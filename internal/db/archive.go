@@ -0,0 +1,111 @@
+// archive.go
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/types"
+	"gorm.io/gorm/clause"
+)
+
+// TournamentArchive is a finished tournament with its final list, kept as json
+type TournamentArchive struct {
+	ID         string    `gorm:"primaryKey;column:id"`
+	OpenedAt   time.Time `gorm:"column:opened_at;index"`
+	FinishedAt time.Time `gorm:"column:finished_at"`
+	Metadata   string    `gorm:"column:metadata"`
+	Players    string    `gorm:"column:players"`
+}
+
+func (TournamentArchive) TableName() string {
+	return "tournament_archives"
+}
+
+// Decode unpacks the archived metadata and list
+func (a TournamentArchive) Decode() (types.TournamentMetadata, []types.Player, error) {
+	var metadata types.TournamentMetadata
+	if err := json.Unmarshal([]byte(a.Metadata), &metadata); err != nil {
+		return metadata, nil, fmt.Errorf("failed to unmarshal archived metadata of %s: %w", a.ID, err)
+	}
+	var players []types.Player
+	if err := json.Unmarshal([]byte(a.Players), &players); err != nil {
+		return metadata, nil, fmt.Errorf("failed to unmarshal archived players of %s: %w", a.ID, err)
+	}
+	return metadata, players, nil
+}
+
+// ArchiveTournament saves a finished tournament. archiving the same tournament again replaces it
+func ArchiveTournament(metadata types.TournamentMetadata, players []types.Player) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	playersJSON, err := json.Marshal(players)
+	if err != nil {
+		return fmt.Errorf("failed to marshal players: %w", err)
+	}
+
+	openedAt := metadata.OpenedAt
+	if openedAt.IsZero() {
+		openedAt = time.Now().UTC()
+	}
+	id := metadata.ID
+	if id == "" {
+		id = openedAt.Format("20060102-1504")
+	}
+
+	archive := TournamentArchive{
+		ID:         id,
+		OpenedAt:   openedAt,
+		FinishedAt: time.Now().UTC(),
+		Metadata:   string(metadataJSON),
+		Players:    string(playersJSON),
+	}
+	result := Database.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&archive)
+	if result.Error != nil {
+		return fmt.Errorf("failed to archive tournament: %w", result.Error)
+	}
+	return nil
+}
+
+// GetRecentArchives returns the last n archived tournaments, newest first
+func GetRecentArchives(n int) ([]TournamentArchive, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var archives []TournamentArchive
+	if err := Database.WithContext(ctx).Order("opened_at desc").Limit(n).Find(&archives).Error; err != nil {
+		return nil, fmt.Errorf("failed to get archived tournaments: %w", err)
+	}
+	return archives, nil
+}
+
+// GetArchives returns every archived tournament, oldest first
+func GetArchives() ([]TournamentArchive, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var archives []TournamentArchive
+	if err := Database.WithContext(ctx).Order("opened_at").Find(&archives).Error; err != nil {
+		return nil, fmt.Errorf("failed to get archived tournaments: %w", err)
+	}
+	return archives, nil
+}
+
+// GetArchivesBetween returns the tournaments opened in [from, to), oldest first
+func GetArchivesBetween(from, to time.Time) ([]TournamentArchive, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var archives []TournamentArchive
+	if err := Database.WithContext(ctx).Where("opened_at >= ? AND opened_at < ?", from.UTC(), to.UTC()).Order("opened_at").Find(&archives).Error; err != nil {
+		return nil, fmt.Errorf("failed to get archived tournaments: %w", err)
+	}
+	return archives, nil
+}
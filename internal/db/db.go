@@ -63,6 +63,9 @@ func init() {
 		// run auto migrations
 		if err := Database.AutoMigrate(
 			&User{},
+			&Admin{},
+			&TournamentArchive{},
+			&Subscription{},
 			// add other models here as you create them
 		); err != nil {
 			log.Fatalf("failed to auto migrate: %v", err)
@@ -9,17 +9,22 @@ import (
 
 // User represents a telegram user
 type User struct {
-	ChatID        int64      `gorm:"primaryKey;column:chat_id"`
-	Username      string     `gorm:"column:username;index"`
-	TgName        string     `gorm:"column:tg_name"`
-	SavedName     string     `gorm:"column:saved_name"`
-	Lichess       *string    `gorm:"column:lichess;unique"`
-	ChessCom      *string    `gorm:"column:chesscom;unique"`
-	BannedUntil   *time.Time `gorm:"column:banned_until"`
-	NotGreenUntil *time.Time `gorm:"column:not_green_until"`
-	TimesPlayed   int        `gorm:"column:times_played;default:0"`
-	State         State      `gorm:"column:state"`
-	AddedAt       time.Time  `gorm:"column:added_at;autoCreateTime"`
+	ChatID          int64      `gorm:"primaryKey;column:chat_id"`
+	Username        string     `gorm:"column:username;index"`
+	TgName          string     `gorm:"column:tg_name"`
+	SavedName       string     `gorm:"column:saved_name"`
+	Lichess         *string    `gorm:"column:lichess;unique"`
+	LichessVerified bool       `gorm:"column:lichess_verified;default:false"`
+	ChessCom        *string    `gorm:"column:chesscom;unique"`
+	Fide            *string    `gorm:"column:fide;unique"`
+	Rcf             *string    `gorm:"column:rcf;unique"`
+	BannedUntil     *time.Time `gorm:"column:banned_until"`
+	NotGreenUntil   *time.Time `gorm:"column:not_green_until"`
+	TimesPlayed     int        `gorm:"column:times_played;default:0"`
+	Language        string     `gorm:"column:language"`
+	NoBroadcasts    bool       `gorm:"column:no_broadcasts;default:false"`
+	State           State      `gorm:"column:state"`
+	AddedAt         time.Time  `gorm:"column:added_at;autoCreateTime"`
 }
 
 type State string
@@ -32,6 +37,8 @@ const (
 	StateEditingSavedName State = "editing_saved_name"
 	StateEditingLichess   State = "editing_lichess"
 	StateEditingChessCom  State = "editing_chesscom"
+	StateEditingFide      State = "editing_fide"
+	StateEditingRcf       State = "editing_rcf"
 )
 
 // TableName specifies the table name for User model
@@ -47,6 +54,62 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// Admin grants a telegram user access to admin commands
+type Admin struct {
+	UserID   int64     `gorm:"primaryKey;column:user_id"`
+	Username string    `gorm:"column:username;index"`
+	Role     Role      `gorm:"column:role"`
+	Source   string    `gorm:"column:source"`
+	AddedAt  time.Time `gorm:"column:added_at;autoCreateTime"`
+}
+
+type Role string
+
+// roles from most to least powerful
+const (
+	RoleOwner   Role = "owner"
+	RoleAdmin   Role = "admin"
+	RoleArbiter Role = "arbiter"
+)
+
+// where a role came from: given by a command or taken from admin group administrators
+const (
+	AdminSourceManual   = "manual"
+	AdminSourceTelegram = "telegram"
+)
+
+func (Admin) TableName() string {
+	return "admins"
+}
+
+func (r Role) rank() int {
+	switch r {
+	case RoleOwner:
+		return 3
+	case RoleAdmin:
+		return 2
+	case RoleArbiter:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Allows reports whether the role is at least the required one
+func (r Role) Allows(required Role) bool {
+	return r.rank() > 0 && r.rank() >= required.rank()
+}
+
+// ParseRole accepts role names typed by admins
+func ParseRole(value string) (Role, bool) {
+	switch role := Role(value); role {
+	case RoleOwner, RoleAdmin, RoleArbiter:
+		return role, true
+	default:
+		return "", false
+	}
+}
+
 // add more models below as your project grows
 // example:
 // type Message struct {
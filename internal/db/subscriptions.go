@@ -0,0 +1,64 @@
+// subscriptions.go
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Subscription asks for a message when registration opens for tournaments of a topic
+type Subscription struct {
+	UserID  int64     `gorm:"primaryKey;column:user_id"`
+	Topic   string    `gorm:"primaryKey;column:topic"`
+	AddedAt time.Time `gorm:"column:added_at;autoCreateTime"`
+}
+
+func (Subscription) TableName() string {
+	return "subscriptions"
+}
+
+// GetSubscriptions returns the topics the user is subscribed to
+func GetSubscriptions(userID int64) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var topics []string
+	if err := Database.WithContext(ctx).Model(&Subscription{}).Where("user_id = ?", userID).Pluck("topic", &topics).Error; err != nil {
+		return nil, fmt.Errorf("failed to get subscriptions: %w", err)
+	}
+	return topics, nil
+}
+
+// ToggleSubscription subscribes the user to the topic or unsubscribes if they already were.
+// it reports whether the user is subscribed now
+func ToggleSubscription(userID int64, topic string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := Database.WithContext(ctx).Where("user_id = ? AND topic = ?", userID, topic).Delete(&Subscription{})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to unsubscribe: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return false, nil
+	}
+
+	if err := Database.WithContext(ctx).Create(&Subscription{UserID: userID, Topic: topic}).Error; err != nil {
+		return false, fmt.Errorf("failed to subscribe: %w", err)
+	}
+	return true, nil
+}
+
+// GetSubscribers returns registered users subscribed to any of the topics
+func GetSubscribers(topics ...string) ([]User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var users []User
+	subscribed := Database.Model(&Subscription{}).Select("user_id").Where("topic IN ?", topics)
+	if err := Database.WithContext(ctx).Where("chat_id IN (?) AND state = ?", subscribed, StateCompleted).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to get subscribers: %w", err)
+	}
+	return users, nil
+}
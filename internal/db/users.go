@@ -10,10 +10,14 @@ import (
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/i18n"
 	"github.com/sukalov/mshkbot/internal/utils"
 	"gorm.io/gorm"
 )
 
+// ErrUserNotFound is returned when no user matches the lookup
+var ErrUserNotFound = errors.New("user not found")
+
 func Register(update tgbotapi.Update) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -50,7 +54,7 @@ func GetByChatID(chatID int64) (User, error) {
 
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return User{}, fmt.Errorf("user not found: %d", chatID)
+			return User{}, fmt.Errorf("%w: %d", ErrUserNotFound, chatID)
 		}
 		return User{}, fmt.Errorf("failed to retrieve user: %w", result.Error)
 	}
@@ -67,7 +71,7 @@ func GetByUsername(username string) (User, error) {
 
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return User{}, fmt.Errorf("user not found")
+			return User{}, ErrUserNotFound
 		}
 		return User{}, fmt.Errorf("failed to retrieve user: %w", result.Error)
 	}
@@ -108,7 +112,10 @@ func UpdateLichess(chatID int64, lichess string) error {
 	result := Database.WithContext(ctx).
 		Model(&User{}).
 		Where("chat_id = ?", chatID).
-		Update("lichess", value)
+		Updates(map[string]interface{}{
+			"lichess":          value,
+			"lichess_verified": false,
+		})
 
 	if result.Error != nil {
 		return fmt.Errorf("failed to update lichess: %w", result.Error)
@@ -207,6 +214,48 @@ func SetNotGreenUntil(chatID int64, until *time.Time) error {
 	return nil
 }
 
+// SetLanguage stores the language the user chose for bot messages
+func SetLanguage(chatID int64, language string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := Database.WithContext(ctx).
+		Model(&User{}).
+		Where("chat_id = ?", chatID).
+		Update("language", language)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update language: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %d", ErrUserNotFound, chatID)
+	}
+
+	return nil
+}
+
+// SetNoBroadcasts turns admin broadcasts off or back on for the user
+func SetNoBroadcasts(chatID int64, off bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := Database.WithContext(ctx).
+		Model(&User{}).
+		Where("chat_id = ?", chatID).
+		Update("no_broadcasts", off)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update broadcast setting: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %d", ErrUserNotFound, chatID)
+	}
+
+	return nil
+}
+
 func IncrementTimesPlayed(chatID int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -262,6 +311,22 @@ func GetAll() ([]User, error) {
 	return users, nil
 }
 
+// CountRegistrations counts users who finished registration and first came to the bot in [from, to)
+func CountRegistrations(from, to time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var count int64
+	result := Database.WithContext(ctx).Model(&User{}).
+		Where("state = ? AND added_at >= ? AND added_at < ?", StateCompleted, from.UTC(), to.UTC()).
+		Count(&count)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to count registrations: %w", result.Error)
+	}
+
+	return count, nil
+}
+
 func GetUser(chatID int64) (User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -274,7 +339,7 @@ func GetUser(chatID int64) (User, error) {
 
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return User{}, fmt.Errorf("user not found")
+			return User{}, ErrUserNotFound
 		}
 		return User{}, fmt.Errorf("failed to get user state: %w", result.Error)
 	}
@@ -299,18 +364,28 @@ func Delete(chatID int64) error {
 	return nil
 }
 
-func Stringify(u User) string {
+func Stringify(u User, lang i18n.Lang) string {
 	builder := strings.Builder{}
 
 	if u.SavedName != "" {
-		builder.WriteString(fmt.Sprintf("ник: %s\n", u.SavedName))
+		builder.WriteString(i18n.T(lang, "me.nickname", u.SavedName) + "\n")
 	}
 	if u.Lichess != nil && *u.Lichess != "" {
-		builder.WriteString(fmt.Sprintf("lichess: [%s](https://lichess.org/@/%s)\n", *u.Lichess, *u.Lichess))
+		verified := ""
+		if u.LichessVerified {
+			verified = " ✓"
+		}
+		builder.WriteString(fmt.Sprintf("lichess: [%s](https://lichess.org/@/%s)%s\n", *u.Lichess, *u.Lichess, verified))
 	}
 	if u.ChessCom != nil && *u.ChessCom != "" {
 		builder.WriteString(fmt.Sprintf("chess.com: [%s](https://www.chess.com/member/%s)\n", *u.ChessCom, *u.ChessCom))
 	}
+	if u.Fide != nil && *u.Fide != "" {
+		builder.WriteString(fmt.Sprintf("fide: [%s](https://ratings.fide.com/profile/%s)\n", *u.Fide, *u.Fide))
+	}
+	if u.Rcf != nil && *u.Rcf != "" {
+		builder.WriteString(fmt.Sprintf("%s: [%s](https://ratings.ruchess.ru/people/%s)\n", i18n.T(lang, "platform.rcf"), *u.Rcf, *u.Rcf))
+	}
 
 	return builder.String()
 }
@@ -328,8 +403,9 @@ func UpdateLichessAndState(chatID int64, lichess string, newState State) error {
 		Model(&User{}).
 		Where("chat_id = ?", chatID).
 		Updates(map[string]interface{}{
-			"lichess": &lichess,
-			"state":   newState,
+			"lichess":          &lichess,
+			"lichess_verified": false,
+			"state":            newState,
 		})
 
 	if result.Error != nil {
@@ -343,6 +419,35 @@ func UpdateLichessAndState(chatID int64, lichess string, newState State) error {
 	return nil
 }
 
+// UpdateVerifiedLichessAndState stores a lichess account confirmed through oauth
+func UpdateVerifiedLichessAndState(chatID int64, lichess string, newState State) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if lichess == "" {
+		return fmt.Errorf("update lichess with ''")
+	}
+
+	result := Database.WithContext(ctx).
+		Model(&User{}).
+		Where("chat_id = ?", chatID).
+		Updates(map[string]interface{}{
+			"lichess":          &lichess,
+			"lichess_verified": true,
+			"state":            newState,
+		})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update verified lichess and state: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("no user found with chat id: %d", chatID)
+	}
+
+	return nil
+}
+
 // UpdateChessComAndState updates chess.com username and state in one transaction
 func UpdateChessComAndState(chatID int64, chessCom string, newState State) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -371,6 +476,62 @@ func UpdateChessComAndState(chatID int64, chessCom string, newState State) error
 	return nil
 }
 
+// UpdateFideAndState updates fide id and state in one transaction
+func UpdateFideAndState(chatID int64, fideID string, newState State) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if fideID == "" {
+		return fmt.Errorf("update fide with ''")
+	}
+
+	result := Database.WithContext(ctx).
+		Model(&User{}).
+		Where("chat_id = ?", chatID).
+		Updates(map[string]interface{}{
+			"fide":  &fideID,
+			"state": newState,
+		})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update fide and state: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("no user found with chat id: %d", chatID)
+	}
+
+	return nil
+}
+
+// UpdateRcfAndState updates rcf id and state in one transaction
+func UpdateRcfAndState(chatID int64, rcfID string, newState State) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if rcfID == "" {
+		return fmt.Errorf("update rcf with ''")
+	}
+
+	result := Database.WithContext(ctx).
+		Model(&User{}).
+		Where("chat_id = ?", chatID).
+		Updates(map[string]interface{}{
+			"rcf":   &rcfID,
+			"state": newState,
+		})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update rcf and state: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("no user found with chat id: %d", chatID)
+	}
+
+	return nil
+}
+
 // GetOrCreateUser combines getting and creating user in one operation
 func GetOrCreateUser(update tgbotapi.Update) (User, bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
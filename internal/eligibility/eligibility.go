@@ -0,0 +1,256 @@
+package eligibility
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/i18n"
+	"github.com/sukalov/mshkbot/internal/types"
+	"github.com/sukalov/mshkbot/internal/utils"
+)
+
+// IsGreen reports whether tournament limits make it a beginner (green) tournament
+func IsGreen(metadata types.TournamentMetadata) bool {
+	return (metadata.LichessRatingLimit > 0 && metadata.LichessRatingLimit <= 1600) ||
+		(metadata.ChesscomRatingLimit > 0 && metadata.ChesscomRatingLimit <= 1400)
+}
+
+// Check runs every rating check for the user against the tournament limits and
+// returns the full evidence together with the decision
+func Check(user db.User, metadata types.TournamentMetadata) *types.Eligibility {
+	snapshot := &types.Eligibility{
+		CheckedAt: time.Now().UTC(),
+		Limits: types.EligibilityLimits{
+			Lichess:  metadata.LichessRatingLimit,
+			Chesscom: metadata.ChesscomRatingLimit,
+			OTB:      metadata.OTBRatingLimit,
+			Green:    IsGreen(metadata),
+		},
+		Decision: types.DecisionAdmitted,
+	}
+
+	reject := func(reason string) {
+		if snapshot.Decision != types.DecisionRejected {
+			snapshot.Decision = types.DecisionRejected
+			snapshot.Reason = reason
+		}
+	}
+
+	if snapshot.Limits.Green && user.NotGreenUntil != nil && time.Now().Before(*user.NotGreenUntil) {
+		snapshot.NotGreenUntil = user.NotGreenUntil
+		reject(types.ReasonNotGreen)
+	}
+
+	if user.Lichess != nil {
+		check := types.SiteCheck{Site: types.SiteLichess, Username: *user.Lichess, Limit: metadata.LichessRatingLimit}
+		ratings, err := utils.GetLichessAllTimeHigh(*user.Lichess)
+		if err != nil {
+			check.Error = err.Error()
+		} else {
+			check.Blitz, check.Rapid, check.Classical = ratings.Blitz, ratings.Rapid, ratings.Classical
+			check.Exceeded = exceeds(check.Limit, ratings.Blitz, ratings.Rapid, ratings.Classical)
+		}
+		snapshot.Sites = append(snapshot.Sites, check)
+		if check.Exceeded {
+			reject(types.ReasonLichessLimit)
+		}
+	}
+
+	if user.ChessCom != nil {
+		check := types.SiteCheck{Site: types.SiteChesscom, Username: *user.ChessCom, Limit: metadata.ChesscomRatingLimit}
+		ratings, err := utils.GetChessComAllTimeHigh(*user.ChessCom)
+		if err != nil {
+			check.Error = err.Error()
+		} else {
+			check.Blitz, check.Rapid, check.Classical = ratings.Blitz, ratings.Rapid, ratings.Classical
+			check.Exceeded = exceeds(check.Limit, ratings.Blitz, ratings.Rapid, ratings.Classical)
+		}
+		snapshot.Sites = append(snapshot.Sites, check)
+		if check.Exceeded {
+			reject(types.ReasonChesscomLimit)
+		}
+	}
+
+	// otb lists are checked on standard and blitz only, rapid is too rarely rated. an id missing from
+	// a loaded list means the player has no rating there, only a list that failed to load is an outage
+	if user.Fide != nil {
+		check := types.SiteCheck{Site: types.SiteFide, Username: *user.Fide, Limit: metadata.OTBRatingLimit}
+		if ratings, ok := utils.GetFideRatings(*user.Fide); ok {
+			check.Blitz, check.Rapid, check.Classical = ratings.Blitz, ratings.Rapid, ratings.Standard
+			check.Exceeded = exceeds(check.Limit, ratings.Standard, ratings.Blitz)
+		} else if utils.FideListLoaded() {
+			check.Unrated = true
+		} else {
+			check.Error = "rating list not loaded"
+		}
+		snapshot.Sites = append(snapshot.Sites, check)
+		if check.Exceeded {
+			reject(types.ReasonFideLimit)
+		}
+	}
+
+	if user.Rcf != nil {
+		check := types.SiteCheck{Site: types.SiteRcf, Username: *user.Rcf, Limit: metadata.OTBRatingLimit}
+		if ratings, ok := utils.GetRcfRatings(*user.Rcf); ok {
+			check.Blitz, check.Rapid, check.Classical = ratings.Blitz, ratings.Rapid, ratings.Standard
+			check.Exceeded = exceeds(check.Limit, ratings.Standard, ratings.Blitz)
+		} else if utils.RcfListLoaded() {
+			check.Unrated = true
+		} else {
+			check.Error = "rating list not loaded"
+		}
+		snapshot.Sites = append(snapshot.Sites, check)
+		if check.Exceeded {
+			reject(types.ReasonRcfLimit)
+		}
+	}
+
+	// a site that is down only matters if the tournament has a limit for it
+	if snapshot.Decision == types.DecisionAdmitted {
+		for _, check := range snapshot.Sites {
+			if check.Error != "" && check.Limit > 0 {
+				snapshot.Decision = types.DecisionUnverified
+				snapshot.Reason = types.ReasonRatingUnavailable
+				break
+			}
+		}
+	}
+
+	return snapshot
+}
+
+// Policy returns the tournament policy for unverified players, allowing them in by default
+func Policy(metadata types.TournamentMetadata) string {
+	switch metadata.UnverifiedPolicy {
+	case types.UnverifiedPending, types.UnverifiedReject:
+		return metadata.UnverifiedPolicy
+	default:
+		return types.UnverifiedAllow
+	}
+}
+
+// FailedSites lists sites whose ratings could not be fetched
+func FailedSites(snapshot *types.Eligibility) []string {
+	var sites []string
+	for _, check := range snapshot.Sites {
+		if check.Error != "" {
+			sites = append(sites, check.Site)
+		}
+	}
+	return sites
+}
+
+func exceeds(limit int, ratings ...int) bool {
+	if limit == 0 {
+		return false
+	}
+	for _, rating := range ratings {
+		if rating >= limit {
+			return true
+		}
+	}
+	return false
+}
+
+// PeakRating picks the online rating shown next to the player in admin lists, lichess first
+func PeakRating(snapshot *types.Eligibility) *types.PeakRating {
+	for _, site := range []string{types.SiteLichess, types.SiteChesscom} {
+		for _, check := range snapshot.Sites {
+			if check.Site == site && check.Error == "" {
+				return &types.PeakRating{
+					Site:         check.Site,
+					BlitzPeak:    check.Blitz,
+					SiteUsername: check.Username,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// OTBRating picks the over-the-board rating shown next to the player, fide first
+func OTBRating(snapshot *types.Eligibility) *types.OTBRating {
+	for _, site := range []string{types.SiteFide, types.SiteRcf} {
+		for _, check := range snapshot.Sites {
+			if check.Site == site && check.Error == "" && !check.Unrated {
+				return &types.OTBRating{
+					Source:   check.Site,
+					ID:       check.Username,
+					Standard: check.Classical,
+					Rapid:    check.Rapid,
+					Blitz:    check.Blitz,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// RejectionMessage is the reply a player gets when check-in is refused
+func RejectionMessage(lang i18n.Lang, reason string) string {
+	switch reason {
+	case types.ReasonLichessLimit:
+		return i18n.T(lang, "rejection.lichess_limit")
+	case types.ReasonChesscomLimit:
+		return i18n.T(lang, "rejection.chesscom_limit")
+	case types.ReasonFideLimit:
+		return i18n.T(lang, "rejection.fide_limit")
+	case types.ReasonRcfLimit:
+		return i18n.T(lang, "rejection.rcf_limit")
+	case types.ReasonRatingUnavailable:
+		return i18n.T(lang, "rejection.rating_unavailable")
+	default:
+		return i18n.T(lang, "rejection.not_green")
+	}
+}
+
+// Format renders the snapshot for admins
+func Format(snapshot *types.Eligibility) string {
+	builder := strings.Builder{}
+
+	decision := "допущен"
+	switch snapshot.Decision {
+	case types.DecisionRejected:
+		decision = fmt.Sprintf("отказано (%s)", snapshot.Reason)
+	case types.DecisionUnverified:
+		decision = "рейтинг не проверен, сайт недоступен"
+	}
+	builder.WriteString(fmt.Sprintf("решение: %s\n", decision))
+	builder.WriteString(fmt.Sprintf("проверено: %s\n", snapshot.CheckedAt.In(time.FixedZone("moscow", 3*60*60)).Format("02.01.2006 15:04:05")))
+
+	builder.WriteString(fmt.Sprintf("\nлимиты: lichess %d, chess.com %d, фиде/фшр %d", snapshot.Limits.Lichess, snapshot.Limits.Chesscom, snapshot.Limits.OTB))
+	if snapshot.Limits.Green {
+		builder.WriteString(" (зелёный)")
+	}
+	builder.WriteString("\n")
+
+	if snapshot.NotGreenUntil != nil {
+		builder.WriteString(fmt.Sprintf("отстранён от зелёных до %s\n", snapshot.NotGreenUntil.Format("02.01.2006")))
+	}
+
+	if len(snapshot.Sites) == 0 {
+		builder.WriteString("\nаккаунты не указаны\n")
+		return builder.String()
+	}
+
+	builder.WriteString("\n")
+	for _, check := range snapshot.Sites {
+		if check.Error != "" {
+			builder.WriteString(fmt.Sprintf("%s %s: ошибка — %s\n", check.Site, check.Username, check.Error))
+			continue
+		}
+		if check.Unrated {
+			builder.WriteString(fmt.Sprintf("%s %s: нет в рейтинг-листе, без рейтинга\n", check.Site, check.Username))
+			continue
+		}
+		mark := "ok"
+		if check.Exceeded {
+			mark = "превышен"
+		}
+		builder.WriteString(fmt.Sprintf("%s %s: блиц %d, рапид %d, классика %d — %s\n", check.Site, check.Username, check.Blitz, check.Rapid, check.Classical, mark))
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,170 @@
+// Package export writes tables as csv or xlsx documents for spreadsheets and pairing programs
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// formats a table can be written in
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// Table is a header row and data rows of the same width
+type Table struct {
+	Header []string
+	Rows   [][]string
+}
+
+// Write renders the table in the format, csv or xlsx
+func Write(table Table, format string) ([]byte, error) {
+	switch format {
+	case FormatCSV:
+		return CSV(table)
+	case FormatXLSX:
+		return XLSX(table)
+	default:
+		return nil, fmt.Errorf("unknown export format: %s", format)
+	}
+}
+
+// CSV writes the table as comma separated values. a byte order mark goes first so excel reads it as utf-8
+func CSV(table Table) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString("\ufeff")
+
+	writer := csv.NewWriter(&buffer)
+	if err := writer.Write(table.Header); err != nil {
+		return nil, fmt.Errorf("failed to write csv header: %w", err)
+	}
+	for _, row := range table.Rows {
+		safe := make([]string, len(row))
+		for i, value := range row {
+			safe[i] = defuse(value)
+		}
+		if err := writer.Write(safe); err != nil {
+			return nil, fmt.Errorf("failed to write csv row: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write csv rows: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// defuse keeps spreadsheets from reading names like =cmd() or -2+cmd() as formulas, some of them skip a
+// leading tab or carriage return before looking. negative numbers and a lone dash stay as they are
+func defuse(value string) string {
+	if value == "" || value == "-" || !strings.ContainsRune("=+-@\t\r", rune(value[0])) || isNumber(value) {
+		return value
+	}
+	return "'" + value
+}
+
+// XLSX writes the table as a single sheet workbook. whole numbers become number cells so they sort,
+// everything else is an inline string
+func XLSX(table Table) ([]byte, error) {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", workbook},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+		{"xl/worksheets/sheet1.xml", sheet(table)},
+	}
+	for _, file := range files {
+		writer, err := archive.Create(file.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s to xlsx: %w", file.name, err)
+		}
+		if _, err := writer.Write([]byte(file.content)); err != nil {
+			return nil, fmt.Errorf("failed to write %s to xlsx: %w", file.name, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish xlsx: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+func sheet(table Table) string {
+	var builder strings.Builder
+	builder.WriteString(xml.Header)
+	builder.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	rows := append([][]string{table.Header}, table.Rows...)
+	for i, row := range rows {
+		builder.WriteString(fmt.Sprintf(`<row r="%d">`, i+1))
+		for j, value := range row {
+			ref := column(j) + strconv.Itoa(i+1)
+			if isNumber(value) && i > 0 {
+				builder.WriteString(fmt.Sprintf(`<c r="%s"><v>%s</v></c>`, ref, value))
+				continue
+			}
+			builder.WriteString(fmt.Sprintf(`<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref))
+			xml.EscapeText(&builder, []byte(value))
+			builder.WriteString(`</t></is></c>`)
+		}
+		builder.WriteString(`</row>`)
+	}
+
+	builder.WriteString(`</sheetData></worksheet>`)
+	return builder.String()
+}
+
+// column turns a zero based index into a column name: A, B, ..., Z, AA, AB
+func column(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// isNumber tells whole numbers that keep their value as a number cell, ids with leading zeros stay text
+func isNumber(value string) bool {
+	digits := strings.TrimPrefix(value, "-")
+	if digits == "" || len(digits) > 15 || (len(digits) > 1 && digits[0] == '0') {
+		return false
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+const contentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`</Types>`
+
+const rootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const workbook = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+	`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="export" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const workbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`</Relationships>`
@@ -0,0 +1,118 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func sampleTable() Table {
+	return Table{
+		Header: []string{"name", "rating", "id"},
+		Rows: [][]string{
+			{"Иван, \"Грозный\"", "1850", "007"},
+			{"<Anna> & co", "-", "12"},
+			{"=HYPERLINK()", "+1", "@x"},
+		},
+	}
+}
+
+func TestCSV(t *testing.T) {
+	got, err := CSV(sampleTable())
+	if err != nil {
+		t.Fatalf("CSV failed: %v", err)
+	}
+	want := "\ufeffname,rating,id\n\"Иван, \"\"Грозный\"\"\",1850,007\n<Anna> & co,-,12\n'=HYPERLINK(),'+1,'@x\n"
+	if string(got) != want {
+		t.Errorf("CSV = %q, want %q", got, want)
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	data, err := XLSX(sampleTable())
+	if err != nil {
+		t.Fatalf("XLSX failed: %v", err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("xlsx is not a zip: %v", err)
+	}
+
+	files := make(map[string]string)
+	for _, file := range reader.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", file.Name, err)
+		}
+		content, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", file.Name, err)
+		}
+		files[file.Name] = string(content)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		content, ok := files[name]
+		if !ok {
+			t.Errorf("xlsx has no %s", name)
+			continue
+		}
+		if err := xml.Unmarshal([]byte(content), new(struct{})); err != nil {
+			t.Errorf("%s is not valid xml: %v", name, err)
+		}
+	}
+
+	sheet := files["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<c r="A1" t="inlineStr"><is><t xml:space="preserve">name</t></is></c>`,
+		`<c r="B2"><v>1850</v></c>`,
+		`<c r="C2" t="inlineStr"><is><t xml:space="preserve">007</t></is></c>`,
+		`&lt;Anna&gt; &amp; co`,
+		`<c r="C3"><v>12</v></c>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet has no %s\n%s", want, sheet)
+		}
+	}
+}
+
+func TestColumn(t *testing.T) {
+	tests := map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"}
+	for index, want := range tests {
+		if got := column(index); got != want {
+			t.Errorf("column(%d) = %s, want %s", index, got, want)
+		}
+	}
+}
+
+func TestDefuse(t *testing.T) {
+	tests := map[string]string{
+		"=1+1":                   "'=1+1",
+		"+1":                     "'+1",
+		"@SUM(A1)":               "'@SUM(A1)",
+		"-2+3+cmd|' /C calc'!A0": "'-2+3+cmd|' /C calc'!A0",
+		"\t=1+1":                 "'\t=1+1",
+		"\r=1+1":                 "'\r=1+1",
+		"-12":                    "-12",
+		"-":                      "-",
+		"":                       "",
+		"Anna":                   "Anna",
+		"a=b":                    "a=b",
+	}
+	for value, want := range tests {
+		if got := defuse(value); got != want {
+			t.Errorf("defuse(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	if _, err := Write(sampleTable(), "pdf"); err == nil {
+		t.Error("Write accepted an unknown format")
+	}
+}
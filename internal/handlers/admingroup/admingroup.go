@@ -10,8 +10,14 @@ import (
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/callback"
+	"github.com/sukalov/mshkbot/internal/conversation"
 	"github.com/sukalov/mshkbot/internal/cron"
 	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/eligibility"
+	"github.com/sukalov/mshkbot/internal/redis"
+	"github.com/sukalov/mshkbot/internal/render"
+	"github.com/sukalov/mshkbot/internal/tournament"
 	"github.com/sukalov/mshkbot/internal/types"
 	"github.com/sukalov/mshkbot/internal/utils"
 )
@@ -22,142 +28,211 @@ var scheduler *cron.Scheduler
 func GetHandlers(s *cron.Scheduler) bot.HandlerSet {
 	scheduler = s
 	return bot.HandlerSet{
-		Commands: map[string]func(b *bot.Bot, update tgbotapi.Update) error{
-			"help":                 handleHelp,
-			"tournament":           handleTournament,
-			"tournament_json":      handleTournamentJSON,
-			"create_tournament":    handleCreateTournament,
-			"remove_tournament":    handleRemoveTournament,
-			"suspend_from_green":   handleSuspendFromGreen,
-			"ban_player":           handleBanPlayer,
-			"unban_player":         handleUnbanPlayer,
-			"admit_to_green":       handleAdmitToGreen,
-			"test_transliteration": handleTestTransliteration,
-			"transliterate_all":    handleTransliterateAll,
-			"send_schedule":        handleSendSchedule,
+		Scope: bot.ScopeAdminGroup,
+		Commands: []bot.Command{
+			{Name: "help", Handler: bot.Help, Description: "command.help", Role: db.RoleArbiter},
+			{Name: "tournament", Handler: handleTournament, Description: "command.tournament", Role: db.RoleArbiter},
+			{Name: "tournament_json", Handler: handleTournamentJSON, Description: "command.tournament_json", Role: db.RoleArbiter},
+			{Name: "add", Handler: handleAddPlayer, Args: "<@username | имя гостя>", Description: "command.add", Role: db.RoleArbiter},
+			{Name: "kick", Handler: handleKick, Args: "[@username | имя]", Description: "command.kick", Role: db.RoleArbiter},
+			{Name: "promote", Handler: handlePromote, Args: "[@username | имя]", Description: "command.promote", Role: db.RoleArbiter},
+			{Name: "demote", Handler: handleDemote, Args: "[@username | имя]", Description: "command.demote", Role: db.RoleArbiter},
+			{Name: "swap", Handler: handleSwap, Args: "[n m]", Description: "command.swap", Role: db.RoleArbiter},
+			{Name: "no_show", Handler: handleNoShow, Args: "[@username | имя]", Description: "command.no_show", Role: db.RoleArbiter},
+			{Name: "set_limit", Handler: handleSetLimit, Args: "[число мест]", Description: "command.set_limit", Role: db.RoleArbiter},
+			{Name: "set_rating_limit", Handler: handleSetRatingLimit, Args: "<lichess|chesscom|otb> <рейтинг>", Description: "command.set_rating_limit", Role: db.RoleArbiter},
+			{Name: "set_unverified_policy", Handler: handleSetUnverifiedPolicy, Args: "<allow|pending|reject>", Description: "command.set_unverified_policy", Role: db.RoleArbiter},
+			{Name: "export", Handler: handleExport, Args: "[csv|xlsx]", Description: "command.export", Role: db.RoleArbiter},
+			{Name: "why", Handler: handleWhy, Args: "<username>", Description: "command.why", Role: db.RoleArbiter},
+			{Name: "create_tournament", Handler: handleCreateTournament, Description: "command.create_tournament", Role: db.RoleArbiter},
+			{Name: "remove_tournament", Handler: handleRemoveTournament, Description: "command.remove_tournament", Role: db.RoleArbiter},
+			{Name: "send_schedule", Handler: handleSendSchedule, Description: "command.send_schedule", Role: db.RoleAdmin},
+			{Name: "suspend_from_green", Handler: handleSuspendFromGreen, Description: "command.suspend_from_green", Role: db.RoleAdmin},
+			{Name: "admit_to_green", Handler: handleAdmitToGreen, Description: "command.admit_to_green", Role: db.RoleAdmin},
+			{Name: "ban_player", Handler: handleBanPlayer, Description: "command.ban_player", Role: db.RoleAdmin},
+			{Name: "unban_player", Handler: handleUnbanPlayer, Description: "command.unban_player", Role: db.RoleAdmin},
+			{Name: "test_transliteration", Handler: handleTestTransliteration, Description: "command.test_transliteration", Role: db.RoleAdmin},
+			{Name: "broadcast", Handler: handleBroadcast, Args: "<all|participants|queue|recent n|green>", Description: "command.broadcast", Role: db.RoleAdmin},
+			{Name: "transliterate_all", Handler: handleTransliterateAll, Description: "command.transliterate_all", Role: db.RoleAdmin},
+			{Name: "cancel", Handler: handleCancel, Description: "command.cancel", Role: db.RoleArbiter},
+			{Name: "export_users", Handler: handleExportUsers, Args: "[csv|xlsx]", Description: "command.export_users", Role: db.RoleAdmin},
+			{Name: "report", Handler: handleReport, Args: "<с> <по>", Description: "command.report", Role: db.RoleAdmin},
+			{Name: "metrics", Handler: handleMetrics, Description: "command.metrics", Role: db.RoleAdmin},
+			{Name: "admins", Handler: handleAdmins, Description: "command.admins", Role: db.RoleAdmin},
+			{Name: "grant", Handler: handleGrant, Args: "<username> <owner|admin|arbiter>", Description: "command.grant", Role: db.RoleOwner},
+			{Name: "revoke", Handler: handleRevoke, Args: "<username>", Description: "command.revoke", Role: db.RoleOwner},
 		},
 		Messages: []func(b *bot.Bot, update tgbotapi.Update) error{
 			handleScheduleFieldInput,
+			handleCreateTournamentInput,
+			handleBroadcastInput,
 			handleAdminMessage,
 		},
-		Callbacks: map[string]func(b *bot.Bot, update tgbotapi.Update) error{
-			"suspend_duration": handleSuspendDuration,
-			"ban_duration":     handleBanDuration,
-			"schedule":         handleScheduleCallback,
+		Callbacks: []bot.Callback{
+			{Name: "suspend_duration", Handler: handleDuration, Role: db.RoleAdmin, Flow: flowUserAction},
+			{Name: "ban_duration", Handler: handleDuration, Role: db.RoleAdmin, Flow: flowUserAction},
+			{Name: "schedule", Handler: handleScheduleCallback, Role: db.RoleAdmin, Version: scheduleVersion},
+			{Name: rosterRoute, Handler: handleRosterCallback, Role: db.RoleArbiter, Version: bot.TournamentVersion},
+			{Name: limitRoute, Handler: handleLimitCallback, Role: db.RoleArbiter, Version: bot.TournamentVersion},
+			{Name: createRoute, Handler: handleCreateCallback, Role: db.RoleArbiter, Flow: flowCreateTournament},
+			{Name: broadcastRoute, Handler: handleBroadcastCallback, Role: db.RoleAdmin, Flow: flowBroadcast},
 		},
 	}
 }
 
-func handleHelp(b *bot.Bot, update tgbotapi.Update) error {
-	return b.SendMessage(update.Message.Chat.ID, "команды администратора:\n\n/tournament - показать состояние турнира\n\n/send_schedule - показать расписание на неделю (сбрасывается автоматически в воскресенье 15:00)\n\n/suspend_from_green - отстранить пользователя от зелёных турниров\n\n/admit_to_green - допустить пользователя к зелёным турнирам\n\n/ban_player - забанить пользователя\n\n/unban_player - разбанить пользователя")
+func handleMetrics(b *bot.Bot, update tgbotapi.Update) error {
+	return b.SendMessage(update.Message.Chat.ID, b.Metrics.Format())
 }
 
-func handleTournamentJSON(b *bot.Bot, update tgbotapi.Update) error {
-	jsonStr, err := b.Tournament.GetTournamentJSON()
+func handleAdmins(b *bot.Bot, update tgbotapi.Update) error {
+	admins, err := db.GetAdmins()
 	if err != nil {
 		return err
 	}
-	return b.SendMessageWithMarkdown(update.Message.Chat.ID, fmt.Sprintf("```json\n%s```", jsonStr), true)
+	if len(admins) == 0 {
+		return b.SendMessage(update.Message.Chat.ID, "админов нет")
+	}
+
+	builder := strings.Builder{}
+	builder.WriteString("админы:\n\n")
+	for _, admin := range admins {
+		name := fmt.Sprintf("%d", admin.UserID)
+		if admin.Username != "" {
+			name = "@" + admin.Username
+		}
+		source := ""
+		if admin.Source == db.AdminSourceTelegram {
+			source = " (админ группы)"
+		}
+		builder.WriteString(fmt.Sprintf("%s — %s%s\n", name, admin.Role, source))
+	}
+	return b.SendMessage(update.Message.Chat.ID, builder.String())
 }
 
-func handleTournament(b *bot.Bot, update tgbotapi.Update) error {
-	if !b.Tournament.Metadata.Exists {
-		return b.SendMessage(update.Message.Chat.ID, "турнир не создан")
+func handleGrant(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) != 2 {
+		return b.SendMessage(chatID, "использование: /grant <username> <owner|admin|arbiter>")
+	}
+
+	role, ok := db.ParseRole(args[1])
+	if !ok {
+		return b.SendMessage(chatID, "роль должна быть owner, admin или arbiter")
+	}
+
+	username := strings.TrimPrefix(args[0], "@")
+	user, err := db.GetByUsername(username)
+	if err != nil {
+		return b.SendMessage(chatID, fmt.Sprintf("пользователь с юзернеймом %s не найден. сначала нужно написать боту", username))
+	}
+
+	if err := db.SetRole(user.ChatID, user.Username, role); err != nil {
+		return err
 	}
+	b.ReloadRoles()
+	log.Printf("admin %d granted %s to %d", update.Message.From.ID, role, user.ChatID)
 
-	message := buildTournamentMessageForAdmin(b)
-	return b.SendMessageWithMarkdown(update.Message.Chat.ID, message, true)
+	return b.SendMessage(chatID, fmt.Sprintf("%s теперь %s", username, role))
 }
 
-func formatPlayerLineForAdmin(num int, player types.Player) string {
-	var playerLine string
-	if player.CheckinMessageID != 0 && player.CheckinChatID != 0 {
-		chatIDForLink := player.CheckinChatID
-		if chatIDForLink < 0 {
-			chatIDForLink = -chatIDForLink - 1000000000000
-		}
-		messageLink := fmt.Sprintf("https://t.me/c/%d/%d", chatIDForLink, player.CheckinMessageID)
-		playerLine = fmt.Sprintf("%d. [%s](%s)", num, player.SavedName, messageLink)
-	} else {
-		playerLine = fmt.Sprintf("%d. %s", num, player.SavedName)
+func handleRevoke(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+
+	username := strings.TrimPrefix(strings.TrimSpace(update.Message.CommandArguments()), "@")
+	if username == "" {
+		return b.SendMessage(chatID, "использование: /revoke <username>")
 	}
 
-	if player.Username != "" {
-		playerLine += fmt.Sprintf(" (@%s)", player.Username)
+	user, err := db.GetByUsername(username)
+	if err != nil {
+		return b.SendMessage(chatID, fmt.Sprintf("пользователь с юзернеймом %s не найден", username))
+	}
+	if user.ChatID == update.Message.From.ID {
+		return b.SendMessage(chatID, "нельзя забрать роль у самого себя")
 	}
 
-	if player.PeakRating != nil {
-		var siteURL string
-		switch player.PeakRating.Site {
-		case types.SiteLichess:
-			siteURL = fmt.Sprintf("https://lichess.org/@/%s", player.PeakRating.SiteUsername)
-			playerLine += fmt.Sprintf(" ([%s](%s) %d)", player.PeakRating.Site, siteURL, player.PeakRating.BlitzPeak)
-		case types.SiteChesscom:
-			siteURL = fmt.Sprintf("https://www.chess.com/member/%s", player.PeakRating.SiteUsername)
-			playerLine += fmt.Sprintf(" ([%s](%s) %d)", player.PeakRating.Site, siteURL, player.PeakRating.BlitzPeak)
-		}
+	if err := db.RemoveRole(user.ChatID); err != nil {
+		return b.SendMessage(chatID, fmt.Sprintf("у %s нет роли", username))
 	}
+	b.ReloadRoles()
+	log.Printf("admin %d revoked role of %d", update.Message.From.ID, user.ChatID)
 
-	return playerLine
+	return b.SendMessage(chatID, fmt.Sprintf("%s больше не админ. админам группы роль вернётся при следующей синхронизации", username))
 }
 
-func buildTournamentMessageForAdmin(b *bot.Bot) string {
-	message := "участники:\n"
-
-	count := 1
-	for _, player := range b.Tournament.List {
-		if player.State == types.StateInTournament {
-			message += formatPlayerLineForAdmin(count, player) + "\n"
-			count++
-		}
+func handleTournamentJSON(b *bot.Bot, update tgbotapi.Update) error {
+	jsonStr, err := b.Tournament.GetTournamentJSON()
+	if err != nil {
+		return err
 	}
+	return b.SendMessageWithMarkdown(update.Message.Chat.ID, fmt.Sprintf("```json\n%s```", jsonStr), true)
+}
 
-	if count == 1 {
-		message += "пока никого нет\n"
+func handleWhy(b *bot.Bot, update tgbotapi.Update) error {
+	ctx := b.Context(update)
+	chatID := update.Message.Chat.ID
+
+	username := strings.TrimPrefix(strings.TrimSpace(update.Message.CommandArguments()), "@")
+	if username == "" {
+		return b.SendMessage(chatID, "использование: /why <username>")
 	}
 
-	queuedPlayers := []types.Player{}
 	for _, player := range b.Tournament.List {
-		if player.State == types.StateQueued {
-			queuedPlayers = append(queuedPlayers, player)
+		if strings.EqualFold(player.Username, username) && player.Eligibility != nil {
+			return b.SendMessage(chatID, fmt.Sprintf("%s (@%s), статус в турнире: %s\n\n%s", player.SavedName, player.Username, player.State, eligibility.Format(player.Eligibility)))
 		}
 	}
 
-	if len(queuedPlayers) > 0 {
-		message += "\nочередь:\n"
-		for i, player := range queuedPlayers {
-			message += formatPlayerLineForAdmin(i+1, player) + "\n"
-		}
+	user, err := db.GetByUsername(username)
+	if err != nil {
+		return b.SendMessage(chatID, fmt.Sprintf("пользователь с юзернеймом %s не найден", username))
+	}
+
+	snapshot, err := redis.GetLastEligibility(ctx, user.ChatID)
+	if err != nil {
+		return fmt.Errorf("failed to get eligibility snapshot: %w", err)
+	}
+	if snapshot == nil {
+		return b.SendMessage(chatID, fmt.Sprintf("%s не записывался на турниры за последнюю неделю", username))
 	}
 
-	return message
+	return b.SendMessage(chatID, fmt.Sprintf("%s (@%s), последняя попытка записи\n\n%s", user.SavedName, user.Username, eligibility.Format(snapshot)))
 }
 
-func handleCreateTournament(b *bot.Bot, update tgbotapi.Update) error {
-	ctx := context.Background()
-	if b.Tournament.Metadata.Exists {
-		return b.SendMessage(update.Message.Chat.ID, "турнир уже создан")
+func handleTournament(b *bot.Bot, update tgbotapi.Update) error {
+	if !b.Tournament.Metadata.Exists {
+		return b.SendMessage(update.Message.Chat.ID, "турнир не создан")
 	}
-	if err := b.Tournament.CreateTournament(ctx, 26, 0, 0, "ТУРНИР НАЧАЛСЯ!!!"); err != nil {
+
+	message, err := render.RenderAdminList(render.HTML, b.Tournament.List)
+	if err != nil {
 		return err
 	}
-	return b.GiveReaction(update.Message.Chat.ID, update.Message.MessageID, utils.ApproveEmoji())
+	return b.SendMessageWithHTML(update.Message.Chat.ID, message, true)
 }
 
 func handleRemoveTournament(b *bot.Bot, update tgbotapi.Update) error {
-	ctx := context.Background()
+	ctx := b.Context(update)
 	if !b.Tournament.Metadata.Exists {
-		return b.SendMessage(update.Message.Chat.ID, "его и так нет")
-	}
-	announcementMessageID := b.Tournament.Metadata.AnnouncementMessageID
-	if announcementMessageID != 0 {
-		if err := b.UnpinMessage(b.GetMainGroupID(), announcementMessageID); err != nil {
-			log.Printf("failed to unpin message: %v", err)
+		planned, err := redis.GetPlannedTournament(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get planned tournament: %w", err)
+		}
+		if planned == nil {
+			return b.SendMessage(update.Message.Chat.ID, "его и так нет")
 		}
+		if err := redis.ClearPlannedTournament(ctx); err != nil {
+			return fmt.Errorf("failed to clear planned tournament: %w", err)
+		}
+		log.Printf("admin %d cancelled the tournament planned for %s", update.Message.From.ID, planned.OpenAt.Format("2006-01-02 15:04"))
+		return b.SendMessage(update.Message.Chat.ID, "запланированный турнир отменён")
 	}
-	if err := b.Tournament.RemoveTournament(ctx); err != nil {
+	if err := scheduler.FinishTournament(ctx); err != nil {
 		return err
 	}
+	log.Printf("admin %d ended tournament", update.Message.From.ID)
 	return b.GiveReaction(update.Message.Chat.ID, update.Message.MessageID, utils.ApproveEmoji())
 }
 
@@ -166,32 +241,42 @@ func handleAdminMessage(b *bot.Bot, update tgbotapi.Update) error {
 		return nil
 	}
 
-	adminChatID := update.Message.From.ID
+	ctx := b.Context(update)
+	chatID := update.Message.Chat.ID
+	adminID := update.Message.From.ID
 
-	process, exists := b.GetAdminProcess(adminChatID)
-	if !exists {
+	process, err := conversation.GetFlow(ctx, chatID, adminID, flowUserAction)
+	if err != nil {
+		return err
+	}
+	if process == nil || process.Step != userActionStepUsername {
 		log.Printf("admin group message: %s", update.Message.Text)
 		return nil
 	}
 
+	// every answer finishes the action, successful or not
+	defer func() {
+		if err := conversation.EndFlow(ctx, chatID, adminID, flowUserAction); err != nil {
+			log.Printf("failed to end admin action: %v", err)
+		}
+	}()
+
 	username := strings.TrimPrefix(strings.TrimSpace(update.Message.Text), "@")
 	if username == "" {
-		b.ClearAdminProcess(adminChatID)
 		return b.SendMessage(update.Message.Chat.ID, "юзернейм не может быть пустым")
 	}
 
 	user, err := db.GetByUsername(username)
 	if err != nil {
-		b.ClearAdminProcess(adminChatID)
 		return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("пользователь с юзернеймом %s не найден", username))
 	}
 
 	var until *time.Time
 	now := time.Now().UTC()
 
-	switch process.Type {
-	case bot.ProcessTypeSuspension:
-		switch process.Duration {
+	switch process.Data["type"] {
+	case actionSuspension:
+		switch process.Data["duration"] {
 		case "month":
 			t := now.AddDate(0, 1, 0)
 			until = &t
@@ -199,26 +284,22 @@ func handleAdminMessage(b *bot.Bot, update tgbotapi.Update) error {
 			t := now.AddDate(100, 0, 0)
 			until = &t
 		default:
-			b.ClearAdminProcess(adminChatID)
 			return b.SendMessage(update.Message.Chat.ID, "неизвестная длительность")
 		}
 
 		if err := db.SetNotGreenUntil(user.ChatID, until); err != nil {
-			b.ClearAdminProcess(adminChatID)
 			return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("ошибка при обновлении статуса: %v", err))
 		}
 
-		b.ClearAdminProcess(adminChatID)
-
 		durationText := "навсегда"
-		if process.Duration == "month" {
+		if process.Data["duration"] == "month" {
 			durationText = "на месяц"
 		}
 
 		return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("пользователь %s отстранён от зелёных %s", username, durationText))
 
-	case bot.ProcessTypeBan:
-		switch process.Duration {
+	case actionBan:
+		switch process.Data["duration"] {
 		case "month":
 			t := now.AddDate(0, 1, 0)
 			until = &t
@@ -226,155 +307,155 @@ func handleAdminMessage(b *bot.Bot, update tgbotapi.Update) error {
 			t := now.AddDate(100, 0, 0)
 			until = &t
 		default:
-			b.ClearAdminProcess(adminChatID)
 			return b.SendMessage(update.Message.Chat.ID, "неизвестная длительность")
 		}
 
 		if err := db.SetBannedUntil(user.ChatID, until); err != nil {
-			b.ClearAdminProcess(adminChatID)
 			return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("ошибка при обновлении статуса: %v", err))
 		}
 
-		b.ClearAdminProcess(adminChatID)
-
 		durationText := "навсегда"
-		if process.Duration == "month" {
+		if process.Data["duration"] == "month" {
 			durationText = "на месяц"
 		}
 
 		return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("пользователь %s забанен %s", username, durationText))
 
-	case bot.ProcessTypeUnban:
+	case actionUnban:
 		if err := db.SetBannedUntil(user.ChatID, nil); err != nil {
-			b.ClearAdminProcess(adminChatID)
 			return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("ошибка при обновлении статуса: %v", err))
 		}
 
-		b.ClearAdminProcess(adminChatID)
-
 		return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("пользователь %s разбанен", username))
 
-	case bot.ProcessTypeAdmitToGreen:
+	case actionAdmitToGreen:
 		if err := db.SetNotGreenUntil(user.ChatID, nil); err != nil {
-			b.ClearAdminProcess(adminChatID)
 			return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("ошибка при обновлении статуса: %v", err))
 		}
 
-		b.ClearAdminProcess(adminChatID)
-
 		return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("пользователь %s допущен к зелёным турнирам", username))
 	}
 
 	return nil
 }
 
-func handleSuspendFromGreen(b *bot.Bot, update tgbotapi.Update) error {
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+// admin actions that wait for a telegram username
+const (
+	flowUserAction = "admin_user_action"
+
+	actionSuspension   = "suspension"
+	actionBan          = "ban"
+	actionUnban        = "unban"
+	actionAdmitToGreen = "admit_to_green"
+)
+
+// a suspension or a ban first waits for the duration button, the other actions go straight to the username
+const (
+	userActionStepDuration = "duration"
+	userActionStepUsername = "username"
+)
+
+func startUserAction(chatID, adminID int64, action, step string) (*conversation.Conversation, error) {
+	data := map[string]string{"type": action}
+	return conversation.Start(context.Background(), chatID, adminID, flowUserAction, step, data, conversation.DefaultTimeout)
+}
+
+// durationKeyboard offers the durations of a suspension or a ban for the flow that was just started
+func durationKeyboard(route string, process *conversation.Conversation) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("месяц", "suspend_duration:month"),
-			tgbotapi.NewInlineKeyboardButtonData("навсегда", "suspend_duration:forever"),
-			tgbotapi.NewInlineKeyboardButtonData("отмена", "suspend_duration:cancel"),
+			tgbotapi.NewInlineKeyboardButtonData("месяц", callback.Encode(route, process.Version, "month")),
+			tgbotapi.NewInlineKeyboardButtonData("навсегда", callback.Encode(route, process.Version, "forever")),
+			tgbotapi.NewInlineKeyboardButtonData("отмена", callback.Encode(route, process.Version, "cancel")),
 		),
 	)
-
-	msg := tgbotapi.NewMessage(update.Message.Chat.ID, "выберите длительность отстранения:")
-	msg.ReplyMarkup = keyboard
-
-	_, err := b.Client.Send(msg)
-	return err
 }
 
-func handleSuspendDuration(b *bot.Bot, update tgbotapi.Update) error {
-	callback := tgbotapi.NewCallback(update.CallbackQuery.ID, "")
-	if _, err := b.Request(callback); err != nil {
+// handleDuration takes the pressed duration of a suspension or a ban and asks for the username
+func handleDuration(b *bot.Bot, update tgbotapi.Update) error {
+	if _, err := b.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, "")); err != nil {
 		log.Printf("failed to answer callback: %v", err)
 	}
 
-	adminChatID := update.CallbackQuery.From.ID
-	data := update.CallbackQuery.Data
+	ctx := b.Context(update)
+	chatID := update.CallbackQuery.Message.Chat.ID
+	messageID := update.CallbackQuery.Message.MessageID
+	adminID := update.CallbackQuery.From.ID
 
+	data := update.CallbackQuery.Data
 	parts := strings.Split(data, ":")
 	if len(parts) < 2 {
 		return fmt.Errorf("invalid callback data: %s", data)
 	}
-
 	duration := parts[1]
 
 	if duration == "cancel" {
-		b.ClearAdminProcess(adminChatID)
-		if err := b.EditMessage(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, "отменено"); err != nil {
+		if err := conversation.EndFlow(ctx, chatID, adminID, flowUserAction); err != nil {
+			log.Printf("failed to end admin action: %v", err)
+		}
+		if err := b.EditMessage(chatID, messageID, "отменено"); err != nil {
 			return fmt.Errorf("failed to edit message: %w", err)
 		}
 		return nil
 	}
 
-	b.SetAdminProcess(adminChatID, bot.ProcessTypeSuspension, duration)
+	process, err := conversation.GetFlow(ctx, chatID, adminID, flowUserAction)
+	if err != nil {
+		return err
+	}
+	if process == nil || process.Step != userActionStepDuration {
+		return b.EditMessage(chatID, messageID, "действие устарело, начните заново")
+	}
 
-	if err := b.EditMessage(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, "введите telegram username пользователя:"); err != nil {
-		return fmt.Errorf("failed to edit message: %w", err)
+	process.Data["duration"] = duration
+	if err := conversation.Advance(ctx, process, userActionStepUsername); err != nil {
+		return err
 	}
 
+	if err := b.EditMessage(chatID, messageID, "введите telegram username пользователя:"); err != nil {
+		return fmt.Errorf("failed to edit message: %w", err)
+	}
 	return nil
 }
 
-func handleBanPlayer(b *bot.Bot, update tgbotapi.Update) error {
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("месяц", "ban_duration:month"),
-			tgbotapi.NewInlineKeyboardButtonData("навсегда", "ban_duration:forever"),
-			tgbotapi.NewInlineKeyboardButtonData("отмена", "ban_duration:cancel"),
-		),
-	)
-
-	msg := tgbotapi.NewMessage(update.Message.Chat.ID, "выберите длительность бана:")
-	msg.ReplyMarkup = keyboard
-
-	_, err := b.Client.Send(msg)
-	return err
-}
-
-func handleBanDuration(b *bot.Bot, update tgbotapi.Update) error {
-	callback := tgbotapi.NewCallback(update.CallbackQuery.ID, "")
-	if _, err := b.Request(callback); err != nil {
-		log.Printf("failed to answer callback: %v", err)
+func handleCancel(b *bot.Bot, update tgbotapi.Update) error {
+	cancelled, err := conversation.Cancel(b.Context(update), update.Message.Chat.ID, update.Message.From.ID)
+	if err != nil {
+		return err
 	}
-
-	adminChatID := update.CallbackQuery.From.ID
-	data := update.CallbackQuery.Data
-
-	parts := strings.Split(data, ":")
-	if len(parts) < 2 {
-		return fmt.Errorf("invalid callback data: %s", data)
+	if !cancelled {
+		return b.SendMessage(update.Message.Chat.ID, "нечего отменять")
 	}
+	return b.GiveReaction(update.Message.Chat.ID, update.Message.MessageID, utils.ApproveEmoji())
+}
 
-	duration := parts[1]
-
-	if duration == "cancel" {
-		b.ClearAdminProcess(adminChatID)
-		if err := b.EditMessage(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, "отменено"); err != nil {
-			return fmt.Errorf("failed to edit message: %w", err)
-		}
-		return nil
+func handleSuspendFromGreen(b *bot.Bot, update tgbotapi.Update) error {
+	process, err := startUserAction(update.Message.Chat.ID, update.Message.From.ID, actionSuspension, userActionStepDuration)
+	if err != nil {
+		return err
 	}
+	return b.SendMessageWithButtons(update.Message.Chat.ID, "выберите длительность отстранения:", durationKeyboard("suspend_duration", process))
+}
 
-	b.SetAdminProcess(adminChatID, bot.ProcessTypeBan, duration)
-
-	if err := b.EditMessage(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, "введите telegram username пользователя:"); err != nil {
-		return fmt.Errorf("failed to edit message: %w", err)
+func handleBanPlayer(b *bot.Bot, update tgbotapi.Update) error {
+	process, err := startUserAction(update.Message.Chat.ID, update.Message.From.ID, actionBan, userActionStepDuration)
+	if err != nil {
+		return err
 	}
-
-	return nil
+	return b.SendMessageWithButtons(update.Message.Chat.ID, "выберите длительность бана:", durationKeyboard("ban_duration", process))
 }
 
 func handleUnbanPlayer(b *bot.Bot, update tgbotapi.Update) error {
-	adminChatID := update.Message.From.ID
-	b.SetAdminProcess(adminChatID, bot.ProcessTypeUnban, "")
+	if _, err := startUserAction(update.Message.Chat.ID, update.Message.From.ID, actionUnban, userActionStepUsername); err != nil {
+		return err
+	}
 	return b.SendMessage(update.Message.Chat.ID, "введите telegram username пользователя для разбана:")
 }
 
 func handleAdmitToGreen(b *bot.Bot, update tgbotapi.Update) error {
-	adminChatID := update.Message.From.ID
-	b.SetAdminProcess(adminChatID, bot.ProcessTypeAdmitToGreen, "")
+	if _, err := startUserAction(update.Message.Chat.ID, update.Message.From.ID, actionAdmitToGreen, userActionStepUsername); err != nil {
+		return err
+	}
 	return b.SendMessage(update.Message.Chat.ID, "учтите, игрок всё равно может не пройти по рейтингу. эта команда просто снимет внутрней бан.\n\nвведите telegram_username пользователя для допуска к зелёным турнирам:")
 }
 
@@ -402,7 +483,7 @@ func handleTransliterateAll(b *bot.Bot, update tgbotapi.Update) error {
 
 	for _, user := range changedUsers {
 		notificationMessage := fmt.Sprintf("я автоматически убрал из никнеймов заглавные буквы и перевёл все на русский. ваш новый никнейм: %s\n\nесли вам не нравится, что у меня получилось, поменять псевдоним можно командой /change_nickname", user.NewName)
-		if err := b.SendMessage(user.ChatID, notificationMessage); err != nil {
+		if err := b.SendBulkMessage(user.ChatID, notificationMessage); err != nil {
 			log.Printf("failed to notify user %d: %v", user.ChatID, err)
 			failCount++
 		} else {
@@ -418,7 +499,7 @@ func handleSendSchedule(b *bot.Bot, update tgbotapi.Update) error {
 	scheduler.ScheduleManager.InitWeekSchedule()
 
 	message := scheduler.ScheduleManager.FormatScheduleMessage()
-	keyboard := cron.GetScheduleMainKeyboard()
+	keyboard := scheduler.ScheduleManager.GetScheduleMainKeyboard()
 
 	messageID, err := b.SendMessageWithButtonsAndGetID(update.Message.Chat.ID, message, keyboard)
 	if err != nil {
@@ -429,6 +510,11 @@ func handleSendSchedule(b *bot.Bot, update tgbotapi.Update) error {
 	return nil
 }
 
+// scheduleVersion makes schedule buttons go stale once the schedule they were drawn for changes
+func scheduleVersion(b *bot.Bot) uint64 {
+	return scheduler.ScheduleManager.Version()
+}
+
 func handleScheduleCallback(b *bot.Bot, update tgbotapi.Update) error {
 	callback := tgbotapi.NewCallback(update.CallbackQuery.ID, "")
 	if _, err := b.Request(callback); err != nil {
@@ -437,6 +523,7 @@ func handleScheduleCallback(b *bot.Bot, update tgbotapi.Update) error {
 
 	chatID := update.CallbackQuery.Message.Chat.ID
 	messageID := update.CallbackQuery.Message.MessageID
+	adminID := update.CallbackQuery.From.ID
 	data := update.CallbackQuery.Data
 
 	if scheduler.ScheduleManager.GetCurrentSchedule() == nil {
@@ -452,13 +539,13 @@ func handleScheduleCallback(b *bot.Bot, update tgbotapi.Update) error {
 
 	switch action {
 	case "approve":
-		return handleScheduleApprove(b, chatID, messageID)
+		return handleScheduleApprove(b, chatID, messageID, adminID)
 	case "edit":
 		return handleScheduleShowEditEvents(b, chatID, messageID)
 	case "delete":
 		return handleScheduleShowDeleteEvents(b, chatID, messageID)
 	case "back":
-		return handleScheduleBack(b, chatID, messageID)
+		return handleScheduleBack(b, chatID, messageID, adminID)
 	case "edit_event":
 		if len(parts) < 3 {
 			return fmt.Errorf("missing event id")
@@ -473,7 +560,7 @@ func handleScheduleCallback(b *bot.Bot, update tgbotapi.Update) error {
 		if len(parts) < 4 {
 			return fmt.Errorf("missing event id or field")
 		}
-		return handleScheduleSelectField(b, chatID, messageID, parts[2], parts[3])
+		return handleScheduleSelectField(b, chatID, messageID, adminID, parts[2], parts[3])
 	case "save_defaults":
 		return handleScheduleSaveDefaults(b, chatID, messageID)
 	}
@@ -481,9 +568,9 @@ func handleScheduleCallback(b *bot.Bot, update tgbotapi.Update) error {
 	return nil
 }
 
-func handleScheduleApprove(b *bot.Bot, chatID int64, messageID int) error {
+func handleScheduleApprove(b *bot.Bot, chatID int64, messageID int, adminID int64) error {
 	scheduler.ScheduleManager.SetApproved(true)
-	scheduler.ScheduleManager.ClearEditingState()
+	endScheduleEdit(chatID, adminID)
 
 	message := scheduler.ScheduleManager.FormatScheduleMessage()
 	return b.EditMessage(chatID, messageID, message)
@@ -496,7 +583,7 @@ func handleScheduleSaveDefaults(b *bot.Bot, chatID int64, messageID int) error {
 
 	message := scheduler.ScheduleManager.FormatScheduleMessage()
 	message += "\n\n*текущие настройки сохранены как дефолт*"
-	keyboard := cron.GetScheduleMainKeyboard()
+	keyboard := scheduler.ScheduleManager.GetScheduleMainKeyboard()
 
 	return b.EditMessageWithButtons(chatID, messageID, message, keyboard)
 }
@@ -504,7 +591,7 @@ func handleScheduleSaveDefaults(b *bot.Bot, chatID int64, messageID int) error {
 func handleScheduleShowEditEvents(b *bot.Bot, chatID int64, messageID int) error {
 	message := scheduler.ScheduleManager.FormatScheduleMessage()
 	message += "\n\n*выберите турнир для редактирования:*"
-	keyboard := cron.GetScheduleSelectEventKeyboard("edit_event")
+	keyboard := scheduler.ScheduleManager.GetScheduleSelectEventKeyboard("edit_event")
 
 	return b.EditMessageWithButtons(chatID, messageID, message, keyboard)
 }
@@ -517,11 +604,11 @@ func handleScheduleShowDeleteEvents(b *bot.Bot, chatID int64, messageID int) err
 	return b.EditMessageWithButtons(chatID, messageID, message, keyboard)
 }
 
-func handleScheduleBack(b *bot.Bot, chatID int64, messageID int) error {
-	scheduler.ScheduleManager.ClearEditingState()
+func handleScheduleBack(b *bot.Bot, chatID int64, messageID int, adminID int64) error {
+	endScheduleEdit(chatID, adminID)
 
 	message := scheduler.ScheduleManager.FormatScheduleMessage()
-	keyboard := cron.GetScheduleMainKeyboard()
+	keyboard := scheduler.ScheduleManager.GetScheduleMainKeyboard()
 
 	return b.EditMessageWithButtons(chatID, messageID, message, keyboard)
 }
@@ -534,7 +621,7 @@ func handleScheduleSelectEditEvent(b *bot.Bot, chatID int64, messageID int, even
 
 	message := scheduler.ScheduleManager.FormatScheduleMessage()
 	message += fmt.Sprintf("\n\n*редактирование: %s*\nвыберите поле:", event.Day)
-	keyboard := cron.GetScheduleEditFieldKeyboard(eventID)
+	keyboard := scheduler.ScheduleManager.GetScheduleEditFieldKeyboard(eventID)
 
 	return b.EditMessageWithButtons(chatID, messageID, message, keyboard)
 }
@@ -558,13 +645,16 @@ func handleScheduleDeleteEvent(b *bot.Bot, chatID int64, messageID int, eventID
 	return b.EditMessageWithButtons(chatID, messageID, message, keyboard)
 }
 
-func handleScheduleSelectField(b *bot.Bot, chatID int64, messageID int, eventID, field string) error {
+func handleScheduleSelectField(b *bot.Bot, chatID int64, messageID int, adminID int64, eventID, field string) error {
 	event := scheduler.ScheduleManager.GetEvent(eventID)
 	if event == nil {
 		return b.EditMessage(chatID, messageID, "турнир не найден")
 	}
 
-	scheduler.ScheduleManager.SetEditingEvent(eventID, field)
+	data := map[string]string{"event_id": eventID, "field": field}
+	if _, err := conversation.Start(context.Background(), chatID, adminID, flowScheduleEdit, "value", data, conversation.DefaultTimeout); err != nil {
+		return err
+	}
 
 	var fieldName string
 	var currentValue string
@@ -579,15 +669,36 @@ func handleScheduleSelectField(b *bot.Bot, chatID int64, messageID int, eventID,
 	case "chesscom_limit":
 		fieldName = "лимит рейтинга chess.com"
 		currentValue = fmt.Sprintf("%d", event.ChesscomLimit)
+	case "otb_limit":
+		fieldName = "лимит рейтинга фиде/фшр"
+		currentValue = fmt.Sprintf("%d", event.OTBLimit)
+	case "start_hour":
+		fieldName = fmt.Sprintf("час открытия записи (до %02d:00, когда начинаются игры)", event.GameHour)
+		currentValue = fmt.Sprintf("%d", event.StartHour)
+	case "game_hour":
+		fieldName = fmt.Sprintf("час начала игр, в это время закрывается запись (до %02d:00, когда турнир заканчивается)", event.EndHour)
+		currentValue = fmt.Sprintf("%d", event.GameHour)
+	case "unverified_policy":
+		fieldName = "что делать, если сайт с рейтингом не отвечает (allow — пускать с пометкой, pending — ждать проверки, reject — отказывать)"
+		currentValue = event.UnverifiedPolicy
+		if currentValue == "" {
+			currentValue = types.UnverifiedAllow
+		}
 	case "intro":
 		fieldName = "текст объявления"
 		currentValue = event.Intro
+	case "template":
+		fieldName = "шаблон списка в объявлении (text/template с html-разметкой: {{.Intro}}, {{.Limit}}, {{.Free}}, {{range .Players}}{{.Number}}. {{.Name}} @{{.Username}}{{end}}, то же для .Queue; bold, italic, link, plural. отправьте - чтобы вернуть стандартный)"
+		currentValue = event.Template
+		if currentValue == "" {
+			currentValue = render.DefaultAnnouncementTemplates[tournament.AnnouncementMode]
+		}
 	default:
 		return fmt.Errorf("unknown field: %s", field)
 	}
 
 	message := fmt.Sprintf("*редактирование %s*\n\nполе: %s\nтекущее значение: `%s`\n\nотправьте новое значение:", event.Day, fieldName, currentValue)
-	keyboard := cron.GetScheduleBackKeyboard()
+	keyboard := scheduler.ScheduleManager.GetScheduleBackKeyboard()
 
 	return b.EditMessageWithButtons(chatID, messageID, message, keyboard)
 }
@@ -597,10 +708,17 @@ func handleScheduleFieldInput(b *bot.Bot, update tgbotapi.Update) error {
 		return nil
 	}
 
-	eventID, field := scheduler.ScheduleManager.GetEditingState()
-	if eventID == "" || field == "" {
+	chatID := update.Message.Chat.ID
+	adminID := update.Message.From.ID
+
+	edit, err := conversation.GetFlow(b.Context(update), chatID, adminID, flowScheduleEdit)
+	if err != nil {
+		return err
+	}
+	if edit == nil {
 		return nil
 	}
+	eventID, field := edit.Data["event_id"], edit.Data["field"]
 
 	text := strings.TrimSpace(update.Message.Text)
 	if text == "" {
@@ -608,10 +726,9 @@ func handleScheduleFieldInput(b *bot.Bot, update tgbotapi.Update) error {
 	}
 
 	var value interface{}
-	var err error
 
 	switch field {
-	case "limit", "lichess_limit", "chesscom_limit":
+	case "limit", "lichess_limit", "chesscom_limit", "otb_limit":
 		intVal, parseErr := strconv.Atoi(text)
 		if parseErr != nil {
 			return b.SendMessage(update.Message.Chat.ID, "введите число")
@@ -620,8 +737,50 @@ func handleScheduleFieldInput(b *bot.Bot, update tgbotapi.Update) error {
 			return b.SendMessage(update.Message.Chat.ID, "число должно быть положительным")
 		}
 		value = intVal
+	case "start_hour":
+		hour, parseErr := strconv.Atoi(text)
+		if parseErr != nil {
+			return b.SendMessage(update.Message.Chat.ID, "введите час числом")
+		}
+		event := scheduler.ScheduleManager.GetEvent(eventID)
+		if event == nil {
+			return b.SendMessage(update.Message.Chat.ID, "турнир не найден")
+		}
+		if hour < 0 || hour >= event.GameHour {
+			return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("час должен быть раньше начала игр (%02d:00)", event.GameHour))
+		}
+		value = hour
+	case "game_hour":
+		hour, parseErr := strconv.Atoi(text)
+		if parseErr != nil {
+			return b.SendMessage(update.Message.Chat.ID, "введите час числом")
+		}
+		event := scheduler.ScheduleManager.GetEvent(eventID)
+		if event == nil {
+			return b.SendMessage(update.Message.Chat.ID, "турнир не найден")
+		}
+		if hour <= event.StartHour || hour > event.EndHour {
+			return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("час должен быть после открытия записи (%02d:00) и не позже конца турнира (%02d:00)", event.StartHour, event.EndHour))
+		}
+		value = hour
+	case "unverified_policy":
+		switch text {
+		case types.UnverifiedAllow, types.UnverifiedPending, types.UnverifiedReject:
+			value = text
+		default:
+			return b.SendMessage(update.Message.Chat.ID, "введите allow, pending или reject")
+		}
 	case "intro":
 		value = text
+	case "template":
+		if text == "-" {
+			value = ""
+			break
+		}
+		if err := render.ValidateAnnouncement(tournament.AnnouncementMode, text); err != nil {
+			return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("шаблон не подходит: %v", err))
+		}
+		value = text
 	default:
 		return nil
 	}
@@ -630,12 +789,12 @@ func handleScheduleFieldInput(b *bot.Bot, update tgbotapi.Update) error {
 		return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("ошибка: %v", err))
 	}
 
-	scheduler.ScheduleManager.ClearEditingState()
+	endScheduleEdit(chatID, adminID)
 
 	scheduleMessageID := scheduler.ScheduleManager.GetMessageID()
 	if scheduleMessageID != 0 {
 		message := scheduler.ScheduleManager.FormatScheduleMessage()
-		keyboard := cron.GetScheduleMainKeyboard()
+		keyboard := scheduler.ScheduleManager.GetScheduleMainKeyboard()
 		if err := b.EditMessageWithButtons(update.Message.Chat.ID, scheduleMessageID, message, keyboard); err != nil {
 			log.Printf("failed to update schedule message: %v", err)
 		}
@@ -643,3 +802,11 @@ func handleScheduleFieldInput(b *bot.Bot, update tgbotapi.Update) error {
 
 	return b.GiveReaction(update.Message.Chat.ID, update.Message.MessageID, utils.ApproveEmoji())
 }
+
+const flowScheduleEdit = "schedule_edit"
+
+func endScheduleEdit(chatID, adminID int64) {
+	if err := conversation.EndFlow(context.Background(), chatID, adminID, flowScheduleEdit); err != nil {
+		log.Printf("failed to end schedule editing: %v", err)
+	}
+}
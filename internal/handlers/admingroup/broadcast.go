@@ -0,0 +1,338 @@
+package admingroup
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/callback"
+	"github.com/sukalov/mshkbot/internal/conversation"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/eligibility"
+	"github.com/sukalov/mshkbot/internal/i18n"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// /broadcast <segment> asks for the text, shows a preview with the number of recipients and sends
+// after confirmation. buttons: broadcast:send and broadcast:cancel
+const (
+	flowBroadcast  = "broadcast"
+	broadcastRoute = "broadcast"
+
+	broadcastStepText    = "text"
+	broadcastStepConfirm = "confirm"
+
+	// broadcastWorkers is how many messages wait in the outbox at once, the outbox keeps the rate limits
+	broadcastWorkers = 8
+	// greenLookback is how many archived tournaments the green segment looks through
+	greenLookback = 100
+)
+
+// broadcast segments
+const (
+	segmentAll          = "all"
+	segmentParticipants = "participants"
+	segmentQueue        = "queue"
+	segmentRecent       = "recent"
+	segmentGreen        = "green"
+)
+
+const broadcastUsage = `использование: /broadcast <кому>
+all — все зарегистрированные
+participants — участники текущего турнира
+queue — очередь текущего турнира
+recent <n> — игроки последних n турниров
+green — допущенные к зелёным турнирам`
+
+var segmentNames = map[string]string{
+	segmentAll:          "все зарегистрированные",
+	segmentParticipants: "участники текущего турнира",
+	segmentQueue:        "очередь текущего турнира",
+	segmentRecent:       "игроки последних турниров",
+	segmentGreen:        "допущенные к зелёным турнирам",
+}
+
+func handleBroadcast(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) == 0 {
+		return b.SendMessage(chatID, broadcastUsage)
+	}
+
+	segment := strings.ToLower(args[0])
+	if _, ok := segmentNames[segment]; !ok {
+		return b.SendMessage(chatID, fmt.Sprintf("неизвестный сегмент %s\n\n%s", args[0], broadcastUsage))
+	}
+
+	data := map[string]string{"segment": segment}
+	if segment == segmentRecent {
+		if len(args) < 2 {
+			return b.SendMessage(chatID, "укажите число турниров: /broadcast recent <n>")
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return b.SendMessage(chatID, "число турниров должно быть положительным")
+		}
+		data["tournaments"] = strconv.Itoa(n)
+	}
+
+	if _, err := conversation.Start(b.Context(update), chatID, update.Message.From.ID, flowBroadcast, broadcastStepText, data, conversation.DefaultTimeout); err != nil {
+		return err
+	}
+	return b.SendMessage(chatID, "напишите текст рассылки. /cancel — отменить")
+}
+
+// handleBroadcastInput takes the text of the broadcast and shows the preview
+func handleBroadcastInput(b *bot.Bot, update tgbotapi.Update) error {
+	if update.Message == nil || update.Message.IsCommand() {
+		return nil
+	}
+
+	ctx := b.Context(update)
+	chatID := update.Message.Chat.ID
+
+	process, err := conversation.GetFlow(ctx, chatID, update.Message.From.ID, flowBroadcast)
+	if err != nil {
+		return err
+	}
+	if process == nil || process.Step != broadcastStepText {
+		return nil
+	}
+
+	text := strings.TrimSpace(update.Message.Text)
+	if text == "" {
+		return b.SendMessage(chatID, "рассылать можно только текст")
+	}
+
+	recipients, skipped, err := broadcastRecipients(b, process.Data)
+	if err != nil {
+		return fmt.Errorf("failed to collect broadcast recipients: %w", err)
+	}
+
+	process.Data["text"] = text
+	if err := conversation.Advance(ctx, process, broadcastStepConfirm); err != nil {
+		return err
+	}
+
+	preview := fmt.Sprintf("кому: %s\nполучателей: %d\nотписались от рассылок: %d\n\n%s", describeSegment(process.Data), len(recipients), skipped, text)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("отправить", callback.Encode(broadcastRoute, process.Version, "send")),
+			tgbotapi.NewInlineKeyboardButtonData("отмена", callback.Encode(broadcastRoute, process.Version, "cancel")),
+		),
+	)
+	return b.SendPlainMessageWithButtons(chatID, preview, keyboard)
+}
+
+func handleBroadcastCallback(b *bot.Bot, update tgbotapi.Update) error {
+	ctx := b.Context(update)
+	chatID := update.CallbackQuery.Message.Chat.ID
+	messageID := update.CallbackQuery.Message.MessageID
+	adminID := update.CallbackQuery.From.ID
+
+	if _, err := b.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, "")); err != nil {
+		log.Printf("failed to answer callback: %v", err)
+	}
+
+	_, action, _ := strings.Cut(update.CallbackQuery.Data, ":")
+
+	process, err := conversation.GetFlow(ctx, chatID, adminID, flowBroadcast)
+	if err != nil {
+		return err
+	}
+	if process == nil || process.Step != broadcastStepConfirm {
+		return b.EditMessage(chatID, messageID, "рассылка не начата или устарела, начните заново с /broadcast")
+	}
+	if err := conversation.EndFlow(ctx, chatID, adminID, flowBroadcast); err != nil {
+		log.Printf("failed to end broadcast: %v", err)
+	}
+
+	if action == "cancel" {
+		return b.EditMessage(chatID, messageID, "рассылка отменена")
+	}
+	if action != "send" {
+		return fmt.Errorf("unknown broadcast action: %s", action)
+	}
+
+	recipients, skipped, err := broadcastRecipients(b, process.Data)
+	if err != nil {
+		return fmt.Errorf("failed to collect broadcast recipients: %w", err)
+	}
+
+	log.Printf("admin %d started a broadcast to %s, %d recipients", adminID, describeSegment(process.Data), len(recipients))
+	if err := b.EditMessage(chatID, messageID, fmt.Sprintf("отправляю %d получателям, пришлю отчёт, когда закончу", len(recipients))); err != nil {
+		log.Printf("failed to edit broadcast preview: %v", err)
+	}
+
+	go sendBroadcast(b, chatID, process.Data["text"], recipients, skipped)
+	return nil
+}
+
+// sendBroadcast delivers the text to every recipient and reports the counts to the admin chat
+func sendBroadcast(b *bot.Bot, reportChatID int64, text string, recipients []db.User, skipped int) {
+	started := time.Now()
+	jobs := make(chan db.User)
+
+	var mu sync.Mutex
+	delivered, failed := 0, 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < broadcastWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for user := range jobs {
+				lang := i18n.Match(user.Language, "")
+				keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+					tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "broadcasts.opt_out"), callback.Encode(bot.BroadcastsRoute, 0, bot.BroadcastsOff)),
+				))
+				err := b.SendBulkMessageWithButtons(user.ChatID, text, keyboard)
+
+				mu.Lock()
+				if err != nil {
+					log.Printf("failed to deliver broadcast to user %d: %v", user.ChatID, err)
+					failed++
+				} else {
+					delivered++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, user := range recipients {
+		jobs <- user
+	}
+	close(jobs)
+	wg.Wait()
+
+	log.Printf("broadcast finished in %v: %d delivered, %d failed", time.Since(started).Round(time.Second), delivered, failed)
+
+	summary := fmt.Sprintf("рассылка завершена:\n\nполучателей: %d\nдоставлено: %d\nне удалось доставить: %d\nотписались от рассылок: %d", len(recipients), delivered, failed, skipped)
+	if err := b.SendMessage(reportChatID, summary); err != nil {
+		log.Printf("failed to send broadcast report: %v", err)
+	}
+}
+
+// broadcastRecipients resolves the segment to registered users. users who turned broadcasts off
+// are left out and counted
+func broadcastRecipients(b *bot.Bot, data map[string]string) ([]db.User, int, error) {
+	users, err := db.GetAll()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var ids map[int64]bool
+	switch data["segment"] {
+	case segmentParticipants:
+		ids = tournamentIDs(b, types.StateInTournament)
+	case segmentQueue:
+		ids = tournamentIDs(b, types.StateQueued)
+	case segmentRecent:
+		n, _ := strconv.Atoi(data["tournaments"])
+		if ids, err = recentPlayerIDs(n); err != nil {
+			return nil, 0, err
+		}
+	case segmentGreen:
+		if ids, err = greenPlayerIDs(); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var recipients []db.User
+	skipped := 0
+	for _, user := range users {
+		if user.State != db.StateCompleted {
+			continue
+		}
+		if ids != nil && !ids[user.ChatID] {
+			continue
+		}
+		if data["segment"] == segmentGreen && user.NotGreenUntil != nil && time.Now().Before(*user.NotGreenUntil) {
+			continue
+		}
+		if user.NoBroadcasts {
+			skipped++
+			continue
+		}
+		recipients = append(recipients, user)
+	}
+	return recipients, skipped, nil
+}
+
+func tournamentIDs(b *bot.Bot, state string) map[int64]bool {
+	ids := make(map[int64]bool)
+	for _, player := range playersIn(b, state) {
+		if !player.IsGuest() {
+			ids[int64(player.ID)] = true
+		}
+	}
+	return ids
+}
+
+// recentPlayerIDs collects everyone who took part in the last n archived tournaments
+func recentPlayerIDs(n int) (map[int64]bool, error) {
+	archives, err := db.GetRecentArchives(n)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[int64]bool)
+	for _, archive := range archives {
+		_, players, err := archive.Decode()
+		if err != nil {
+			log.Printf("skipping archived tournament: %v", err)
+			continue
+		}
+		for _, player := range players {
+			if !player.IsGuest() {
+				ids[int64(player.ID)] = true
+			}
+		}
+	}
+	return ids, nil
+}
+
+// greenPlayerIDs collects players whose latest check-in into a green tournament was admitted.
+// ratings are not fetched again, suspensions are applied by the caller
+func greenPlayerIDs() (map[int64]bool, error) {
+	archives, err := db.GetRecentArchives(greenLookback)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[int64]bool)
+	seen := make(map[int64]bool)
+	for _, archive := range archives {
+		metadata, players, err := archive.Decode()
+		if err != nil {
+			log.Printf("skipping archived tournament: %v", err)
+			continue
+		}
+		if !eligibility.IsGreen(metadata) {
+			continue
+		}
+		for _, player := range players {
+			id := int64(player.ID)
+			if player.IsGuest() || seen[id] || player.Eligibility == nil {
+				continue
+			}
+			seen[id] = true
+			ids[id] = player.Eligibility.Decision != types.DecisionRejected
+		}
+	}
+	return ids, nil
+}
+
+func describeSegment(data map[string]string) string {
+	if data["segment"] == segmentRecent {
+		return fmt.Sprintf("игроки последних турниров (%s)", data["tournaments"])
+	}
+	return segmentNames[data["segment"]]
+}
@@ -0,0 +1,349 @@
+package admingroup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/callback"
+	"github.com/sukalov/mshkbot/internal/conversation"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// /create_tournament asks for the tournament settings one by one, or takes them from a saved
+// event, then for the opening, game start and close times. buttons: create:template:<event id>, create:manual,
+// create:confirm and create:cancel
+const (
+	flowCreateTournament = "create_tournament"
+	createRoute          = "create"
+
+	createStepTemplate = "template"
+	createStepConfirm  = "confirm"
+)
+
+// createSteps are the questions in the order they are asked. a template fills everything before start
+var createSteps = []string{"limit", "lichess_limit", "chesscom_limit", "otb_limit", "intro", "start", "games", "close"}
+
+var createPrompts = map[string]string{
+	"limit":          "сколько мест? 0 — без лимита",
+	"lichess_limit":  "ограничение по рейтингу lichess? 0 — без ограничения",
+	"chesscom_limit": "ограничение по рейтингу chess.com? 0 — без ограничения",
+	"otb_limit":      "ограничение по классическому рейтингу fide/ршф? 0 — без ограничения",
+	"intro":          "текст анонса:",
+	"start":          "когда открыть запись? время чч:мм (если оно уже прошло — завтра) или «сейчас»",
+	"games":          "во сколько начинаются игры? время чч:мм, в это время закроется запись, или «-», чтобы запись не закрывалась",
+	"close":          "когда закрыть турнир? время чч:мм или «-», чтобы закрыть вручную через /remove_tournament",
+}
+
+func handleCreateTournament(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+
+	if b.Tournament.Metadata.Exists {
+		return b.SendMessage(chatID, "турнир уже создан")
+	}
+
+	process, err := conversation.Start(b.Context(update), chatID, update.Message.From.ID, flowCreateTournament, createStepTemplate, nil, conversation.DefaultTimeout)
+	if err != nil {
+		return err
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, event := range scheduler.ScheduleManager.GetDefaultEvents() {
+		if event.Deleted {
+			continue
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(event.Day, callback.Encode(createRoute, process.Version, createStepTemplate, event.ID)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("вручную", callback.Encode(createRoute, process.Version, "manual")),
+		tgbotapi.NewInlineKeyboardButtonData("отмена", callback.Encode(createRoute, process.Version, "cancel")),
+	))
+
+	return b.SendMessageWithButtons(chatID, "взять настройки из события расписания или ввести вручную?", tgbotapi.NewInlineKeyboardMarkup(rows...))
+}
+
+func handleCreateCallback(b *bot.Bot, update tgbotapi.Update) error {
+	ctx := b.Context(update)
+	chatID := update.CallbackQuery.Message.Chat.ID
+	messageID := update.CallbackQuery.Message.MessageID
+	adminID := update.CallbackQuery.From.ID
+
+	if _, err := b.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, "")); err != nil {
+		log.Printf("failed to answer callback: %v", err)
+	}
+
+	parts := strings.Split(update.CallbackQuery.Data, ":")
+	if len(parts) < 2 {
+		return fmt.Errorf("invalid callback data: %s", update.CallbackQuery.Data)
+	}
+
+	process, err := conversation.GetFlow(ctx, chatID, adminID, flowCreateTournament)
+	if err != nil {
+		return err
+	}
+	if process == nil {
+		return b.EditMessage(chatID, messageID, "создание турнира не начато или устарело, начните заново с /create_tournament")
+	}
+
+	switch parts[1] {
+	case "cancel":
+		if err := conversation.EndFlow(ctx, chatID, adminID, flowCreateTournament); err != nil {
+			log.Printf("failed to end tournament creation: %v", err)
+		}
+		return b.EditMessage(chatID, messageID, "отменено")
+
+	case "manual":
+		if err := conversation.Advance(ctx, process, createSteps[0]); err != nil {
+			return err
+		}
+		return b.EditMessage(chatID, messageID, createPrompts[createSteps[0]])
+
+	case createStepTemplate:
+		if len(parts) < 3 {
+			return fmt.Errorf("invalid callback data: %s", update.CallbackQuery.Data)
+		}
+		for _, e := range scheduler.ScheduleManager.GetDefaultEvents() {
+			if e.ID != parts[2] {
+				continue
+			}
+			process.Data["template_day"] = e.Day
+			process.Data["event_id"] = e.ID
+			process.Data["limit"] = strconv.Itoa(e.Limit)
+			process.Data["lichess_limit"] = strconv.Itoa(e.LichessLimit)
+			process.Data["chesscom_limit"] = strconv.Itoa(e.ChesscomLimit)
+			process.Data["otb_limit"] = strconv.Itoa(e.OTBLimit)
+			process.Data["intro"] = e.Intro
+			process.Data["template"] = e.Template
+			process.Data["unverified_policy"] = e.UnverifiedPolicy
+			if err := conversation.Advance(ctx, process, "start"); err != nil {
+				return err
+			}
+			return b.EditMessage(chatID, messageID, fmt.Sprintf("настройки взяты из события «%s»\n\n%s", e.Day, createPrompts["start"]))
+		}
+		return b.EditMessage(chatID, messageID, "такого события больше нет, начните заново с /create_tournament")
+
+	case createStepConfirm:
+		if process.Step != createStepConfirm {
+			return nil
+		}
+		if err := conversation.EndFlow(ctx, chatID, adminID, flowCreateTournament); err != nil {
+			log.Printf("failed to end tournament creation: %v", err)
+		}
+		return b.EditMessage(chatID, messageID, createTournament(ctx, adminID, process))
+	}
+
+	return fmt.Errorf("unknown create action: %s", parts[1])
+}
+
+// handleCreateTournamentInput takes the answer to the current question of /create_tournament
+func handleCreateTournamentInput(b *bot.Bot, update tgbotapi.Update) error {
+	if update.Message == nil || update.Message.IsCommand() {
+		return nil
+	}
+
+	ctx := b.Context(update)
+	chatID := update.Message.Chat.ID
+
+	process, err := conversation.GetFlow(ctx, chatID, update.Message.From.ID, flowCreateTournament)
+	if err != nil {
+		return err
+	}
+	if process == nil || process.Step == createStepTemplate || process.Step == createStepConfirm {
+		return nil
+	}
+
+	text := strings.TrimSpace(update.Message.Text)
+	if text == "" {
+		return nil
+	}
+
+	now := time.Now().In(scheduler.Timezone())
+
+	switch process.Step {
+	case "limit", "lichess_limit", "chesscom_limit", "otb_limit":
+		n, err := strconv.Atoi(text)
+		if err != nil || n < 0 {
+			return b.SendMessage(chatID, "введите неотрицательное число")
+		}
+		process.Data[process.Step] = strconv.Itoa(n)
+	case "intro":
+		process.Data["intro"] = text
+	case "start":
+		if strings.EqualFold(text, "сейчас") {
+			process.Data["start"] = ""
+			break
+		}
+		start, ok := parseClock(text, now)
+		if !ok {
+			return b.SendMessage(chatID, "введите время как чч:мм или «сейчас»")
+		}
+		process.Data["start"] = start.Format(time.RFC3339)
+	case "games":
+		if text == "-" {
+			process.Data["games"] = ""
+			break
+		}
+		games, ok := parseClock(text, storedTime(process.Data["start"], now))
+		if !ok {
+			return b.SendMessage(chatID, "введите время как чч:мм или «-»")
+		}
+		process.Data["games"] = games.Format(time.RFC3339)
+	case "close":
+		if text == "-" {
+			process.Data["close"] = ""
+			break
+		}
+		after := storedTime(process.Data["start"], now)
+		if process.Data["games"] != "" {
+			after = storedTime(process.Data["games"], after)
+		}
+		closes, ok := parseClock(text, after)
+		if !ok {
+			return b.SendMessage(chatID, "введите время как чч:мм или «-»")
+		}
+		process.Data["close"] = closes.Format(time.RFC3339)
+	}
+
+	next := createStepConfirm
+	for i, step := range createSteps {
+		if step == process.Step && i+1 < len(createSteps) {
+			next = createSteps[i+1]
+		}
+	}
+	if err := conversation.Advance(ctx, process, next); err != nil {
+		return err
+	}
+
+	if next != createStepConfirm {
+		return b.SendMessage(chatID, createPrompts[next])
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("создать", callback.Encode(createRoute, process.Version, createStepConfirm)),
+			tgbotapi.NewInlineKeyboardButtonData("отмена", callback.Encode(createRoute, process.Version, "cancel")),
+		),
+	)
+	return b.SendPlainMessageWithButtons(chatID, describeCreation(process), keyboard)
+}
+
+// createTournament opens or plans the tournament collected by the wizard and returns the answer for the admin
+func createTournament(ctx context.Context, adminID int64, process *conversation.Conversation) string {
+	metadata, openAt, err := creationMetadata(process)
+	if err != nil {
+		return fmt.Sprintf("не получилось создать турнир: %v", err)
+	}
+
+	if err := scheduler.PlanTournament(ctx, openAt, metadata); err != nil {
+		log.Printf("failed to create tournament: %v", err)
+		return fmt.Sprintf("не получилось создать турнир: %v", err)
+	}
+
+	if openAt.After(time.Now()) {
+		log.Printf("admin %d planned a tournament for %s", adminID, openAt.Format("2006-01-02 15:04"))
+		return fmt.Sprintf("турнир откроется %s. отменить можно через /remove_tournament", openAt.Format("02.01 в 15:04"))
+	}
+	log.Printf("admin %d created a tournament", adminID)
+	return "турнир создан, анонс опубликован и закреплён"
+}
+
+func creationMetadata(process *conversation.Conversation) (types.TournamentMetadata, time.Time, error) {
+	number := func(key string) int {
+		n, _ := strconv.Atoi(process.Data[key])
+		return n
+	}
+
+	metadata := types.TournamentMetadata{
+		EventID:              process.Data["event_id"],
+		Limit:                number("limit"),
+		LichessRatingLimit:   number("lichess_limit"),
+		ChesscomRatingLimit:  number("chesscom_limit"),
+		OTBRatingLimit:       number("otb_limit"),
+		AnnouncementIntro:    process.Data["intro"],
+		AnnouncementTemplate: process.Data["template"],
+		UnverifiedPolicy:     process.Data["unverified_policy"],
+	}
+
+	openAt := time.Now()
+	if start := process.Data["start"]; start != "" {
+		t, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			return metadata, openAt, fmt.Errorf("invalid start time: %w", err)
+		}
+		openAt = t
+	}
+	if games := process.Data["games"]; games != "" {
+		t, err := time.Parse(time.RFC3339, games)
+		if err != nil {
+			return metadata, openAt, fmt.Errorf("invalid game start time: %w", err)
+		}
+		metadata.StartsAt = &t
+	}
+	if closes := process.Data["close"]; closes != "" {
+		t, err := time.Parse(time.RFC3339, closes)
+		if err != nil {
+			return metadata, openAt, fmt.Errorf("invalid close time: %w", err)
+		}
+		metadata.CloseAt = &t
+	}
+	return metadata, openAt, nil
+}
+
+func describeCreation(process *conversation.Conversation) string {
+	metadata, openAt, err := creationMetadata(process)
+	if err != nil {
+		return err.Error()
+	}
+
+	var builder strings.Builder
+	builder.WriteString("создать турнир?\n\n")
+	if day := process.Data["template_day"]; day != "" {
+		builder.WriteString(fmt.Sprintf("по событию: %s\n", day))
+	}
+	builder.WriteString(describeLimits(metadata))
+	builder.WriteString(fmt.Sprintf("\nанонс: %s\n", metadata.AnnouncementIntro))
+	if process.Data["start"] == "" {
+		builder.WriteString("открыть: сейчас\n")
+	} else {
+		builder.WriteString(fmt.Sprintf("открыть: %s\n", openAt.Format("02.01 в 15:04")))
+	}
+	if metadata.StartsAt == nil {
+		builder.WriteString("игры: без времени, запись до закрытия\n")
+	} else {
+		builder.WriteString(fmt.Sprintf("игры: %s, тогда же закроется запись\n", metadata.StartsAt.Format("02.01 в 15:04")))
+	}
+	if metadata.CloseAt == nil {
+		builder.WriteString("закрыть: вручную")
+	} else {
+		builder.WriteString(fmt.Sprintf("закрыть: %s", metadata.CloseAt.Format("02.01 в 15:04")))
+	}
+	return builder.String()
+}
+
+// storedTime reads a time the wizard saved, the fallback covers «сейчас» and «-»
+func storedTime(value string, fallback time.Time) time.Time {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t
+	}
+	return fallback
+}
+
+// parseClock reads hh:mm as the first such moment after the given time
+func parseClock(text string, after time.Time) (time.Time, bool) {
+	clock, err := time.Parse("15:04", strings.ReplaceAll(text, ".", ":"))
+	if err != nil {
+		return time.Time{}, false
+	}
+	t := time.Date(after.Year(), after.Month(), after.Day(), clock.Hour(), clock.Minute(), 0, 0, after.Location())
+	if !t.After(after) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, true
+}
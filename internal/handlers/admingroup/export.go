@@ -0,0 +1,146 @@
+package admingroup
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/export"
+	"github.com/sukalov/mshkbot/internal/types"
+	"github.com/sukalov/mshkbot/internal/utils"
+)
+
+// exportStates are the list states /export writes, checked-out players are left out
+var exportStates = map[string]string{
+	types.StateInTournament: "participant",
+	types.StateQueued:       "queue",
+	types.StatePending:      "pending",
+}
+
+// handleExport sends the participants and the queue of the running tournament as a document:
+// /export [csv|xlsx]
+func handleExport(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+
+	if !b.Tournament.Metadata.Exists {
+		return b.SendMessage(chatID, "сейчас нет турнира")
+	}
+
+	format, ok := exportFormat(update.Message.CommandArguments())
+	if !ok {
+		return b.SendMessage(chatID, "использование: /export [csv|xlsx], по умолчанию csv")
+	}
+
+	table := export.Table{Header: []string{
+		"no", "status", "name", "name_latin", "username",
+		"peak_site", "peak_account", "peak_blitz",
+		"otb_source", "otb_id", "otb_standard", "otb_rapid", "otb_blitz",
+		"checked_in_at",
+	}}
+	number := 0
+	for _, player := range b.Tournament.List {
+		status, ok := exportStates[player.State]
+		if !ok {
+			continue
+		}
+		number++
+
+		row := []string{strconv.Itoa(number), status, player.SavedName, utils.Romanize(player.SavedName), player.Username}
+		if peak := player.PeakRating; peak != nil {
+			row = append(row, peak.Site, peak.SiteUsername, strconv.Itoa(peak.BlitzPeak))
+		} else {
+			row = append(row, "", "", "")
+		}
+		if otb := player.OTBRating; otb != nil {
+			row = append(row, otb.Source, otb.ID, strconv.Itoa(otb.Standard), strconv.Itoa(otb.Rapid), strconv.Itoa(otb.Blitz))
+		} else {
+			row = append(row, "", "", "", "", "")
+		}
+		row = append(row, exportTime(player.TimeAdded))
+		table.Rows = append(table.Rows, row)
+	}
+
+	data, err := export.Write(table, format)
+	if err != nil {
+		return fmt.Errorf("failed to export tournament: %w", err)
+	}
+
+	log.Printf("admin %d exported the tournament list as %s", update.Message.From.ID, format)
+	name := fmt.Sprintf("tournament-%s.%s", b.Tournament.Metadata.ID, format)
+	return b.SendDocument(chatID, name, data, fmt.Sprintf("игроков: %d", number))
+}
+
+// handleExportUsers sends the users table as a document: /export_users [csv|xlsx]
+func handleExportUsers(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+
+	format, ok := exportFormat(update.Message.CommandArguments())
+	if !ok {
+		return b.SendMessage(chatID, "использование: /export_users [csv|xlsx], по умолчанию csv")
+	}
+
+	users, err := db.GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to get users for export: %w", err)
+	}
+
+	optional := func(value *string) string {
+		if value == nil {
+			return ""
+		}
+		return *value
+	}
+	optionalTime := func(value *time.Time) string {
+		if value == nil {
+			return ""
+		}
+		return exportTime(*value)
+	}
+
+	table := export.Table{Header: []string{
+		"chat_id", "username", "tg_name", "saved_name", "name_latin",
+		"lichess", "lichess_verified", "chesscom", "fide", "rcf",
+		"banned_until", "not_green_until", "times_played", "language", "no_broadcasts", "state", "added_at",
+	}}
+	for _, user := range users {
+		table.Rows = append(table.Rows, []string{
+			strconv.FormatInt(user.ChatID, 10), user.Username, user.TgName, user.SavedName, utils.Romanize(user.SavedName),
+			optional(user.Lichess), strconv.FormatBool(user.LichessVerified), optional(user.ChessCom), optional(user.Fide), optional(user.Rcf),
+			optionalTime(user.BannedUntil), optionalTime(user.NotGreenUntil), strconv.Itoa(user.TimesPlayed), user.Language,
+			strconv.FormatBool(user.NoBroadcasts), string(user.State), exportTime(user.AddedAt),
+		})
+	}
+
+	data, err := export.Write(table, format)
+	if err != nil {
+		return fmt.Errorf("failed to export users: %w", err)
+	}
+
+	log.Printf("admin %d exported %d users as %s", update.Message.From.ID, len(users), format)
+	name := fmt.Sprintf("users-%s.%s", time.Now().In(scheduler.Timezone()).Format("20060102"), format)
+	return b.SendDocument(chatID, name, data, fmt.Sprintf("пользователей: %d", len(users)))
+}
+
+// exportFormat reads the optional format argument, csv when it is empty
+func exportFormat(arg string) (string, bool) {
+	switch format := strings.ToLower(strings.TrimSpace(arg)); format {
+	case "":
+		return export.FormatCSV, true
+	case export.FormatCSV, export.FormatXLSX:
+		return format, true
+	default:
+		return "", false
+	}
+}
+
+func exportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(scheduler.Timezone()).Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,204 @@
+package admingroup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/callback"
+	"github.com/sukalov/mshkbot/internal/eligibility"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// limitRoute confirms lowering the limit: limit:set:<n> or limit:cancel
+const limitRoute = "limit"
+
+// handleSetLimit changes the player limit of the running tournament: /set_limit <n>, 0 for no limit.
+// raising it promotes queued players right away, lowering it below the number of seated players asks first
+func handleSetLimit(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+
+	if !b.Tournament.Metadata.Exists {
+		return b.SendMessage(chatID, "сейчас нет турнира")
+	}
+
+	arg := strings.TrimSpace(update.Message.CommandArguments())
+	if arg == "" {
+		return b.SendMessage(chatID, describeLimits(b.Tournament.Metadata)+"\n\nиспользование: /set_limit <число мест>, 0 — без лимита")
+	}
+
+	limit, err := strconv.Atoi(arg)
+	if err != nil || limit < 0 {
+		return b.SendMessage(chatID, "лимит должен быть неотрицательным числом")
+	}
+
+	overflow := playersIn(b, types.StateInTournament)
+	if limit == 0 || len(overflow) <= limit {
+		return b.SendMessage(chatID, applyLimit(b.Context(update), b, update.Message.From.ID, limit))
+	}
+	seated := len(overflow)
+	overflow = overflow[limit:]
+
+	version := bot.TournamentVersion(b)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("уменьшить", callback.Encode(limitRoute, version, "set", strconv.Itoa(limit))),
+			tgbotapi.NewInlineKeyboardButtonData("отмена", callback.Encode(limitRoute, version, "cancel")),
+		),
+	)
+
+	message := fmt.Sprintf("лимит %d меньше числа участников (%d). в начало очереди уйдут записавшиеся последними:\n%s",
+		limit, seated, labels(overflow))
+	return b.SendPlainMessageWithButtons(chatID, message, keyboard)
+}
+
+// handleLimitCallback applies a lowered limit after the admin confirmed it
+func handleLimitCallback(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.CallbackQuery.Message.Chat.ID
+	messageID := update.CallbackQuery.Message.MessageID
+
+	if _, err := b.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, "")); err != nil {
+		log.Printf("failed to answer callback: %v", err)
+	}
+
+	parts := strings.Split(update.CallbackQuery.Data, ":")
+	if len(parts) < 2 {
+		return fmt.Errorf("invalid callback data: %s", update.CallbackQuery.Data)
+	}
+
+	if parts[1] == "cancel" {
+		return b.EditMessage(chatID, messageID, "отменено")
+	}
+	if parts[1] != "set" || len(parts) < 3 {
+		return fmt.Errorf("invalid callback data: %s", update.CallbackQuery.Data)
+	}
+
+	limit, err := strconv.Atoi(parts[2])
+	if err != nil || limit < 0 {
+		return fmt.Errorf("invalid limit: %s", parts[2])
+	}
+
+	return b.EditMessage(chatID, messageID, applyLimit(b.Context(update), b, update.CallbackQuery.From.ID, limit))
+}
+
+// applyLimit sets the limit, rebalances the list and returns the answer for the admin
+func applyLimit(ctx context.Context, b *bot.Bot, adminID int64, limit int) string {
+	promoted, demoted, err := b.Tournament.ApplyLimit(ctx, limit)
+	if err != nil {
+		log.Printf("failed to apply limit %d: %v", limit, err)
+		return fmt.Sprintf("не получилось изменить лимит: %v", err)
+	}
+	log.Printf("admin %d set the tournament limit to %d, promoted %d, demoted %d", adminID, limit, len(promoted), len(demoted))
+	b.Tournament.MarkAnnouncementDirty()
+
+	reply := fmt.Sprintf("лимит: %d", limit)
+	if limit == 0 {
+		reply = "лимит снят"
+	}
+	if len(promoted) > 0 {
+		reply += "\n\nиз очереди в турнир:\n" + labels(promoted)
+	}
+	if len(demoted) > 0 {
+		reply += "\n\nв начало очереди:\n" + labels(demoted)
+	}
+	return reply
+}
+
+// ratingCaps maps the names /set_rating_limit accepts to the caps, fide and rcf share the otb one
+var ratingCaps = map[string]string{
+	types.SiteLichess:  types.SiteLichess,
+	types.SiteChesscom: types.SiteChesscom,
+	"otb":              "otb",
+	types.SiteFide:     "otb",
+	types.SiteRcf:      "otb",
+}
+
+// handleSetRatingLimit changes a rating cap of the running tournament: /set_rating_limit <site> <rating>, 0 removes the cap.
+// caps apply to check-ins from now on, players already in the list stay
+func handleSetRatingLimit(b *bot.Bot, update tgbotapi.Update) error {
+	ctx := b.Context(update)
+	chatID := update.Message.Chat.ID
+
+	if !b.Tournament.Metadata.Exists {
+		return b.SendMessage(chatID, "сейчас нет турнира")
+	}
+
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) != 2 {
+		return b.SendMessage(chatID, describeLimits(b.Tournament.Metadata)+"\n\nиспользование: /set_rating_limit <lichess|chesscom|otb> <рейтинг>, 0 — без ограничения")
+	}
+
+	field, ok := ratingCaps[strings.ToLower(args[0])]
+	if !ok {
+		return b.SendMessage(chatID, fmt.Sprintf("неизвестный сайт %s, можно lichess, chesscom или otb", args[0]))
+	}
+	rating, err := strconv.Atoi(args[1])
+	if err != nil || rating < 0 {
+		return b.SendMessage(chatID, "рейтинг должен быть неотрицательным числом")
+	}
+
+	switch field {
+	case types.SiteLichess:
+		err = b.Tournament.SetLichessRatingLimit(ctx, rating)
+	case types.SiteChesscom:
+		err = b.Tournament.SetChesscomRatingLimit(ctx, rating)
+	default:
+		err = b.Tournament.SetOTBRatingLimit(ctx, rating)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set %s rating limit: %w", field, err)
+	}
+
+	log.Printf("admin %d set the %s rating limit to %d", update.Message.From.ID, field, rating)
+	b.Tournament.MarkAnnouncementDirty()
+
+	return b.SendMessage(chatID, describeLimits(b.Tournament.Metadata)+"\n\nигроки, которые уже в списке, остаются")
+}
+
+// handleSetUnverifiedPolicy changes what happens to check-ins of the running tournament whose ratings
+// can't be fetched: /set_unverified_policy <allow|pending|reject>. players already in the list stay
+func handleSetUnverifiedPolicy(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+
+	if !b.Tournament.Metadata.Exists {
+		return b.SendMessage(chatID, "сейчас нет турнира")
+	}
+
+	policy := strings.ToLower(strings.TrimSpace(update.Message.CommandArguments()))
+	switch policy {
+	case types.UnverifiedAllow, types.UnverifiedPending, types.UnverifiedReject:
+	default:
+		return b.SendMessage(chatID, describeLimits(b.Tournament.Metadata)+"\n\nиспользование: /set_unverified_policy <allow|pending|reject>: allow — пускать с пометкой, pending — ждать проверки, reject — отказывать")
+	}
+
+	if err := b.Tournament.SetUnverifiedPolicy(b.Context(update), policy); err != nil {
+		return fmt.Errorf("failed to set unverified policy: %w", err)
+	}
+	log.Printf("admin %d set the unverified policy to %s", update.Message.From.ID, policy)
+
+	return b.SendMessage(chatID, describeLimits(b.Tournament.Metadata)+"\n\nигроки, которые уже в списке, остаются")
+}
+
+func describeLimits(metadata types.TournamentMetadata) string {
+	value := func(n int) string {
+		if n == 0 {
+			return "нет"
+		}
+		return strconv.Itoa(n)
+	}
+	return fmt.Sprintf("мест: %s\nlichess: %s\nchesscom: %s\notb: %s\nесли сайт лежит: %s",
+		value(metadata.Limit), value(metadata.LichessRatingLimit), value(metadata.ChesscomRatingLimit), value(metadata.OTBRatingLimit),
+		eligibility.Policy(metadata))
+}
+
+func labels(players []types.Player) string {
+	names := make([]string, 0, len(players))
+	for _, player := range players {
+		names = append(names, playerLabel(player))
+	}
+	return strings.Join(names, "\n")
+}
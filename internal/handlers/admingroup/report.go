@@ -0,0 +1,47 @@
+package admingroup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/stats"
+)
+
+const reportUsage = "использование: /report <с> <по>, даты как дд.мм или дд.мм.гггг, обе включительно"
+
+// handleReport sends the analytics report for tournaments opened between two dates
+func handleReport(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) != 2 {
+		return b.SendMessage(chatID, reportUsage)
+	}
+
+	now := time.Now().In(scheduler.Timezone())
+	from, ok := stats.ParseDay(args[0], now)
+	if !ok {
+		return b.SendMessage(chatID, fmt.Sprintf("не понимаю дату %s\n\n%s", args[0], reportUsage))
+	}
+	to, ok := stats.ParseDay(args[1], now)
+	if !ok {
+		return b.SendMessage(chatID, fmt.Sprintf("не понимаю дату %s\n\n%s", args[1], reportUsage))
+	}
+	if to.Before(from) {
+		return b.SendMessage(chatID, "конец периода раньше начала")
+	}
+
+	report, err := scheduler.Report(from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return fmt.Errorf("failed to build report: %w", err)
+	}
+	for _, message := range report {
+		if err := b.SendMessage(chatID, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,429 @@
+package admingroup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/callback"
+	"github.com/sukalov/mshkbot/internal/checkin"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// roster actions change the tournament list by hand. the commands take a player as
+// @username or saved name, without one they show a menu of the players the action applies to
+const (
+	rosterRoute = "roster"
+
+	rosterKick    = "kick"
+	rosterPromote = "promote"
+	rosterDemote  = "demote"
+	rosterSwap    = "swap"
+	rosterNoShow  = "no_show"
+)
+
+// rosterPrompts are the menu titles of the actions
+var rosterPrompts = map[string]string{
+	rosterKick:    "кого убрать из списка?",
+	rosterPromote: "кого перевести из очереди в турнир?",
+	rosterDemote:  "кого перевести из турнира в начало очереди?",
+	rosterSwap:    "кого из очереди поменять местами?",
+	rosterNoShow:  "кто не пришёл? повторный выбор снимает отметку",
+}
+
+func handleAddPlayer(b *bot.Bot, update tgbotapi.Update) error {
+	ctx := b.Context(update)
+	chatID := update.Message.Chat.ID
+
+	arg := strings.TrimSpace(update.Message.CommandArguments())
+	if arg == "" {
+		return b.SendMessage(chatID, guestUsage)
+	}
+
+	var result checkin.Result
+	var addErr error
+	if username, ok := strings.CutPrefix(arg, "@"); ok {
+		user, err := db.GetByUsername(username)
+		if err != nil {
+			return b.SendMessage(chatID, fmt.Sprintf("пользователь с юзернеймом %s не найден. гостя без телеграма добавьте по имени без @", username))
+		}
+		if user.State != db.StateCompleted {
+			return b.SendMessage(chatID, fmt.Sprintf("%s не закончил регистрацию", username))
+		}
+		result, addErr = checkin.Add(ctx, b, user)
+	} else {
+		name, peak, otb, err := parseGuest(arg)
+		if err != nil {
+			return b.SendMessage(chatID, fmt.Sprintf("%v\n\n%s", err, guestUsage))
+		}
+		result, addErr = checkin.AddGuest(ctx, b, name, peak, otb)
+	}
+	if addErr != nil {
+		log.Printf("failed to add player: %v", addErr)
+		return b.SendMessage(chatID, "не получилось добавить, попробуйте ещё раз")
+	}
+
+	switch result.Outcome {
+	case checkin.NoTournament:
+		return b.SendMessage(chatID, "сейчас нет турнира")
+	case checkin.Already:
+		return b.SendMessage(chatID, fmt.Sprintf("%s уже в списке", playerLabel(result.Player)))
+	}
+
+	log.Printf("admin %d added player %d (%s) as %s", update.Message.From.ID, result.Player.ID, result.Player.SavedName, result.Player.State)
+
+	if result.Outcome == checkin.Queued {
+		return b.SendMessage(chatID, fmt.Sprintf("%s добавлен в очередь, мест нет", playerLabel(result.Player)))
+	}
+	return b.SendMessage(chatID, fmt.Sprintf("%s добавлен в турнир", playerLabel(result.Player)))
+}
+
+const guestUsage = "использование: /add <@username> или /add <имя гостя без телеграма> [lichess=1850] [chesscom=1700] [fide=1600] [rcf=1500]"
+
+// parseGuest splits /add arguments into the guest's name and the ratings given as site=value at the end.
+// lichess and chess.com are blitz peaks, fide and rcf are standard ratings; one online and one otb rating at most
+func parseGuest(arg string) (string, *types.PeakRating, *types.OTBRating, error) {
+	fields := strings.Fields(arg)
+
+	var peak *types.PeakRating
+	var otb *types.OTBRating
+	for len(fields) > 0 {
+		site, value, ok := strings.Cut(fields[len(fields)-1], "=")
+		if !ok {
+			break
+		}
+		site = strings.ToLower(site)
+		rating, err := strconv.Atoi(value)
+		if err != nil || rating <= 0 {
+			return "", nil, nil, fmt.Errorf("рейтинг %s должен быть положительным числом", site)
+		}
+		switch site {
+		case types.SiteLichess, types.SiteChesscom:
+			if peak != nil {
+				return "", nil, nil, fmt.Errorf("у гостя может быть только один онлайн-рейтинг")
+			}
+			peak = &types.PeakRating{Site: site, BlitzPeak: rating}
+		case types.SiteFide, types.SiteRcf:
+			if otb != nil {
+				return "", nil, nil, fmt.Errorf("у гостя может быть только один классический рейтинг")
+			}
+			otb = &types.OTBRating{Source: site, Standard: rating}
+		default:
+			return "", nil, nil, fmt.Errorf("неизвестный сайт %s", site)
+		}
+		fields = fields[:len(fields)-1]
+	}
+
+	if len(fields) == 0 {
+		return "", nil, nil, fmt.Errorf("не указано имя гостя")
+	}
+	return strings.Join(fields, " "), peak, otb, nil
+}
+
+func handleKick(b *bot.Bot, update tgbotapi.Update) error {
+	return handleRosterCommand(b, update, rosterKick)
+}
+
+func handlePromote(b *bot.Bot, update tgbotapi.Update) error {
+	return handleRosterCommand(b, update, rosterPromote)
+}
+
+func handleDemote(b *bot.Bot, update tgbotapi.Update) error {
+	return handleRosterCommand(b, update, rosterDemote)
+}
+
+// handleNoShow marks a seated player who did not come, the mark goes to the archive and /stats
+func handleNoShow(b *bot.Bot, update tgbotapi.Update) error {
+	return handleRosterCommand(b, update, rosterNoShow)
+}
+
+// handleRosterCommand runs the action on the player given as the argument, or shows the menu
+func handleRosterCommand(b *bot.Bot, update tgbotapi.Update, action string) error {
+	chatID := update.Message.Chat.ID
+
+	if !b.Tournament.Metadata.Exists {
+		return b.SendMessage(chatID, "сейчас нет турнира")
+	}
+
+	query := strings.TrimSpace(update.Message.CommandArguments())
+	if query == "" {
+		return sendRosterMenu(b, chatID, action, 0)
+	}
+
+	player, ok := findPlayer(b, query)
+	if !ok {
+		return b.SendMessage(chatID, fmt.Sprintf("%s нет в списке", query))
+	}
+
+	return b.SendMessage(chatID, runRosterAction(b.Context(update), b, update.Message.From.ID, action, player))
+}
+
+// handleSwap exchanges two places of the queue: /swap <n> <m>
+func handleSwap(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+
+	if !b.Tournament.Metadata.Exists {
+		return b.SendMessage(chatID, "сейчас нет турнира")
+	}
+
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) == 0 {
+		return sendRosterMenu(b, chatID, rosterSwap, 0)
+	}
+	if len(args) != 2 {
+		return b.SendMessage(chatID, "использование: /swap <место в очереди> <место в очереди>")
+	}
+
+	queue := playersIn(b, types.StateQueued)
+	var picked []types.Player
+	for _, arg := range args {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > len(queue) {
+			return b.SendMessage(chatID, fmt.Sprintf("в очереди нет места %s", arg))
+		}
+		picked = append(picked, queue[n-1])
+	}
+
+	return b.SendMessage(chatID, swapPlayers(b.Context(update), b, update.Message.From.ID, picked[0], picked[1]))
+}
+
+// handleRosterCallback handles menu buttons: roster:<action>:<player id>[:<second player id>]
+func handleRosterCallback(b *bot.Bot, update tgbotapi.Update) error {
+	ctx := b.Context(update)
+	chatID := update.CallbackQuery.Message.Chat.ID
+	messageID := update.CallbackQuery.Message.MessageID
+	adminID := update.CallbackQuery.From.ID
+
+	if _, err := b.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, "")); err != nil {
+		log.Printf("failed to answer callback: %v", err)
+	}
+
+	parts := strings.Split(update.CallbackQuery.Data, ":")
+	if len(parts) < 3 {
+		return fmt.Errorf("invalid callback data: %s", update.CallbackQuery.Data)
+	}
+	action := parts[1]
+
+	var players []types.Player
+	for _, arg := range parts[2:] {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid player id: %s", arg)
+		}
+		player, ok := playerByID(b, id)
+		if !ok {
+			return b.EditMessage(chatID, messageID, "этого игрока уже нет в списке")
+		}
+		players = append(players, player)
+	}
+
+	if action == rosterSwap {
+		if len(players) == 1 {
+			return editRosterMenu(b, chatID, messageID, action, players[0].ID)
+		}
+		return b.EditMessage(chatID, messageID, swapPlayers(ctx, b, adminID, players[0], players[1]))
+	}
+
+	return b.EditMessage(chatID, messageID, runRosterAction(ctx, b, adminID, action, players[0]))
+}
+
+// runRosterAction applies kick, promote or demote to the player and returns the answer for the admin
+func runRosterAction(ctx context.Context, b *bot.Bot, adminID int64, action string, player types.Player) string {
+	label := playerLabel(player)
+
+	switch action {
+	case rosterKick:
+		if err := b.Tournament.RemovePlayer(ctx, player.ID); err != nil {
+			log.Printf("failed to kick player %d: %v", player.ID, err)
+			return fmt.Sprintf("не получилось убрать %s: %v", label, err)
+		}
+		if !player.IsGuest() && player.State != types.StateCheckedOut {
+			if err := db.DecrementTimesPlayed(int64(player.ID)); err != nil {
+				log.Printf("failed to decrement times played for user %d: %v", player.ID, err)
+			}
+		}
+		log.Printf("admin %d kicked player %d (%s)", adminID, player.ID, player.SavedName)
+
+		reply := fmt.Sprintf("%s убран из списка", label)
+		if player.State == types.StateInTournament {
+			promoted, err := b.Tournament.PromoteQueuedPlayer(ctx)
+			if err != nil {
+				log.Printf("failed to promote queued player: %v", err)
+			} else if promoted != nil {
+				log.Printf("promoted player %d (%s) from queue to tournament", promoted.ID, promoted.Username)
+				reply += fmt.Sprintf(", на его место из очереди прошёл %s", playerLabel(*promoted))
+			}
+		}
+		b.Tournament.MarkAnnouncementDirty()
+		return reply
+
+	case rosterPromote:
+		if player.State != types.StateQueued {
+			return fmt.Sprintf("%s не в очереди", label)
+		}
+		player.State = types.StateInTournament
+		if err := b.Tournament.EditPlayer(ctx, player.ID, player); err != nil {
+			log.Printf("failed to promote player %d: %v", player.ID, err)
+			return fmt.Sprintf("не получилось перевести %s: %v", label, err)
+		}
+		log.Printf("admin %d promoted player %d (%s)", adminID, player.ID, player.SavedName)
+		b.Tournament.MarkAnnouncementDirty()
+
+		reply := fmt.Sprintf("%s переведён в турнир", label)
+		if limit := b.Tournament.Metadata.Limit; limit > 0 && len(playersIn(b, types.StateInTournament)) > limit {
+			reply += fmt.Sprintf(". участников теперь больше лимита (%d)", limit)
+		}
+		return reply
+
+	case rosterDemote:
+		if player.State != types.StateInTournament {
+			return fmt.Sprintf("%s не в турнире", label)
+		}
+		if err := b.Tournament.DemotePlayer(ctx, player.ID); err != nil {
+			log.Printf("failed to demote player %d: %v", player.ID, err)
+			return fmt.Sprintf("не получилось перевести %s: %v", label, err)
+		}
+		log.Printf("admin %d demoted player %d (%s)", adminID, player.ID, player.SavedName)
+		b.Tournament.MarkAnnouncementDirty()
+		return fmt.Sprintf("%s переведён в начало очереди. освободившееся место никому не отдано, используйте /promote", label)
+
+	case rosterNoShow:
+		if player.State != types.StateInTournament {
+			return fmt.Sprintf("%s не в турнире", label)
+		}
+		player.NoShow = !player.NoShow
+		if err := b.Tournament.EditPlayer(ctx, player.ID, player); err != nil {
+			log.Printf("failed to mark no-show of player %d: %v", player.ID, err)
+			return fmt.Sprintf("не получилось отметить %s: %v", label, err)
+		}
+		log.Printf("admin %d set no-show of player %d (%s) to %v", adminID, player.ID, player.SavedName, player.NoShow)
+		if player.NoShow {
+			return fmt.Sprintf("%s отмечен как не пришедший", label)
+		}
+		return fmt.Sprintf("с %s снята отметка о неявке", label)
+	}
+
+	return fmt.Sprintf("неизвестное действие: %s", action)
+}
+
+func swapPlayers(ctx context.Context, b *bot.Bot, adminID int64, first, second types.Player) string {
+	if first.State != types.StateQueued || second.State != types.StateQueued {
+		return "менять местами можно только игроков в очереди"
+	}
+	if first.ID == second.ID {
+		return "выберите двух разных игроков"
+	}
+	if err := b.Tournament.SwapPlayers(ctx, first.ID, second.ID); err != nil {
+		log.Printf("failed to swap players %d and %d: %v", first.ID, second.ID, err)
+		return fmt.Sprintf("не получилось поменять местами: %v", err)
+	}
+	log.Printf("admin %d swapped queued players %d (%s) and %d (%s)", adminID, first.ID, first.SavedName, second.ID, second.SavedName)
+	b.Tournament.MarkAnnouncementDirty()
+	return fmt.Sprintf("%s и %s поменялись местами в очереди", playerLabel(first), playerLabel(second))
+}
+
+// rosterCandidates lists the players an action can be applied to
+func rosterCandidates(b *bot.Bot, action string) []types.Player {
+	switch action {
+	case rosterPromote, rosterSwap:
+		return playersIn(b, types.StateQueued)
+	case rosterDemote, rosterNoShow:
+		return playersIn(b, types.StateInTournament)
+	default:
+		var players []types.Player
+		for _, player := range b.Tournament.List {
+			if player.State != types.StateCheckedOut {
+				players = append(players, player)
+			}
+		}
+		return players
+	}
+}
+
+// rosterKeyboard has a button per candidate, one per row. picked is the first player of a swap, 0 if none
+func rosterKeyboard(b *bot.Bot, action string, picked int) (tgbotapi.InlineKeyboardMarkup, bool) {
+	version := bot.TournamentVersion(b)
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, player := range rosterCandidates(b, action) {
+		if player.ID == picked {
+			continue
+		}
+		args := []string{action, strconv.Itoa(player.ID)}
+		if picked != 0 {
+			args = []string{action, strconv.Itoa(picked), strconv.Itoa(player.ID)}
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(playerLabel(player), callback.Encode(rosterRoute, version, args...)),
+		))
+	}
+	if len(rows) == 0 {
+		return tgbotapi.InlineKeyboardMarkup{}, false
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...), true
+}
+
+func sendRosterMenu(b *bot.Bot, chatID int64, action string, picked int) error {
+	keyboard, ok := rosterKeyboard(b, action, picked)
+	if !ok {
+		return b.SendMessage(chatID, "подходящих игроков нет")
+	}
+	return b.SendMessageWithButtons(chatID, rosterPrompts[action], keyboard)
+}
+
+func editRosterMenu(b *bot.Bot, chatID int64, messageID int, action string, picked int) error {
+	keyboard, ok := rosterKeyboard(b, action, picked)
+	if !ok {
+		return b.EditMessage(chatID, messageID, "подходящих игроков нет")
+	}
+	return b.EditMessageWithButtons(chatID, messageID, "с кем поменять местами?", keyboard)
+}
+
+// findPlayer looks a player up by @username or saved name
+func findPlayer(b *bot.Bot, query string) (types.Player, bool) {
+	username, byUsername := strings.CutPrefix(query, "@")
+	for _, player := range b.Tournament.List {
+		if byUsername && player.Username != "" && strings.EqualFold(player.Username, username) {
+			return player, true
+		}
+		if !byUsername && strings.EqualFold(player.SavedName, query) {
+			return player, true
+		}
+	}
+	return types.Player{}, false
+}
+
+func playerByID(b *bot.Bot, id int) (types.Player, bool) {
+	for _, player := range b.Tournament.List {
+		if player.ID == id {
+			return player, true
+		}
+	}
+	return types.Player{}, false
+}
+
+// playersIn returns the players in a state in list order
+func playersIn(b *bot.Bot, state string) []types.Player {
+	var players []types.Player
+	for _, player := range b.Tournament.List {
+		if player.State == state {
+			players = append(players, player)
+		}
+	}
+	return players
+}
+
+func playerLabel(player types.Player) string {
+	if player.Username != "" {
+		return fmt.Sprintf("%s (@%s)", player.SavedName, player.Username)
+	}
+	if player.IsGuest() {
+		return player.SavedName + " (гость)"
+	}
+	return player.SavedName
+}
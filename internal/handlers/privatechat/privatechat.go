@@ -4,44 +4,71 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/callback"
+	"github.com/sukalov/mshkbot/internal/checkin"
+	"github.com/sukalov/mshkbot/internal/conversation"
+	"github.com/sukalov/mshkbot/internal/cron"
 	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/i18n"
+	"github.com/sukalov/mshkbot/internal/lichessauth"
+	"github.com/sukalov/mshkbot/internal/redis"
 	"github.com/sukalov/mshkbot/internal/types"
 	"github.com/sukalov/mshkbot/internal/utils"
 )
 
-// GetHandlers returns handler set for private messages
-func GetHandlers() bot.HandlerSet {
+var lichessAuth *lichessauth.Provider
+
+// scheduler lists the events players can subscribe to and keeps the club timezone
+var scheduler *cron.Scheduler
+
+// GetHandlers returns handler set for private messages. lichess oauth login is offered when auth is not nil
+func GetHandlers(auth *lichessauth.Provider, s *cron.Scheduler) bot.HandlerSet {
+	lichessAuth = auth
+	scheduler = s
 	return bot.HandlerSet{
-		Commands: map[string]func(b *bot.Bot, update tgbotapi.Update) error{
-			"start":           handleStart,
-			"help":            handleHelp,
-			"me":              handleMe,
-			"myratings":       handleMyRatings,
-			"change_nickname": handleChangeNickname,
-			"change_platform": handleChangePlatform,
-			"checkin":         handleCheckinInPrivate,
-			"checkout":        handleCheckinInPrivate,
+		Scope: bot.ScopePrivate,
+		Commands: []bot.Command{
+			{Name: "start", Handler: handleStart},
+			{Name: "help", Handler: bot.Help, Description: "command.help"},
+			{Name: "me", Handler: bot.RequireRegistered(handleMe), Description: "command.me"},
+			{Name: "myratings", Handler: bot.RequireRegistered(handleMyRatings), Description: "command.myratings"},
+			{Name: "change_nickname", Handler: bot.RequireRegistered(handleChangeNickname), Description: "command.change_nickname"},
+			{Name: "change_platform", Handler: bot.RequireRegistered(handleChangePlatform), Description: "command.change_platform"},
+			{Name: "language", Handler: handleLanguage, Description: "command.language"},
+			{Name: "stats", Handler: bot.RequireRegistered(handleStats), Description: "command.stats"},
+			{Name: "subscribe", Handler: bot.RequireRegistered(handleSubscribe), Description: "command.subscribe"},
+			{Name: "broadcasts", Handler: bot.RequireRegistered(handleBroadcasts), Description: "command.broadcasts"},
+			{Name: "cancel", Handler: handleCancel, Description: "command.cancel"},
+			{Name: "checkin", Handler: handleCheckinInPrivate},
+			{Name: "checkout", Handler: handleCheckinInPrivate},
 		},
 		Messages: []func(b *bot.Bot, update tgbotapi.Update) error{
 			handlePrivateMessage,
 		},
-		Callbacks: map[string]func(b *bot.Bot, update tgbotapi.Update) error{
-			"register":        handleRegister,
-			"change_platform": handleChangePlatformCallback,
+		Callbacks: []bot.Callback{
+			{Name: "register", Handler: handleRegister},
+			{Name: "change_platform", Handler: bot.RequireRegistered(handleChangePlatformCallback)},
+			{Name: "language", Handler: handleLanguageCallback},
+			{Name: bot.BroadcastsRoute, Handler: bot.RequireRegistered(handleBroadcastsCallback)},
+			{Name: subscribeRoute, Handler: bot.RequireRegistered(handleSubscribeCallback)},
+			{Name: bot.EntryRoute, Handler: bot.RequireRegistered(handleEntryInPrivate), Version: bot.TournamentVersion},
 		},
 	}
 }
 
 func handleCheckinInPrivate(b *bot.Bot, update tgbotapi.Update) error {
-	return b.SendMessage(update.Message.Chat.ID, "записываться можно только в чате @moscowchessclub")
+	return b.SendMessage(update.Message.Chat.ID, i18n.T(b.Lang(update), "checkin.private_only"))
 }
 
 func handleStart(b *bot.Bot, update tgbotapi.Update) error {
 	chatID := update.Message.Chat.ID
+	lang := b.Lang(update)
 
 	// Get or create user in one operation
 	user, isNew, err := db.GetOrCreateUser(update)
@@ -50,34 +77,101 @@ func handleStart(b *bot.Bot, update tgbotapi.Update) error {
 		return err
 	}
 
+	// the group gives unregistered players a link with the tournament they tried to join
+	tournamentID, fromCheckinLink := checkin.ParsePayload(update.Message.CommandArguments())
+	if fromCheckinLink {
+		if user.State == db.StateCompleted {
+			return b.SendMessage(chatID, checkinFromLink(b.Context(update), b, user, tournamentID, lang))
+		}
+		if err := redis.SetPendingCheckin(b.Context(update), chatID, tournamentID, registrationTimeout); err != nil {
+			log.Printf("failed to remember check-in of user %d: %v", chatID, err)
+		}
+	}
+
 	if !isNew {
-		// User exists, check their state
-		switch user.State {
-		case db.StateCompleted:
-			return b.SendMessage(chatID, "вы уже зарегистрированы!")
-		case db.StateAskedLichess:
-			return b.SendMessage(chatID, "введите ваш никнейм на lichess:")
-		case db.StateAskedChessCom:
-			return b.SendMessage(chatID, "введите ваш никнейм на chess.com:")
-		case db.StateAskedSavedName:
-			return b.SendMessage(chatID, "введите ваш никнейм для турниров:")
+		if user.State == db.StateCompleted {
+			return b.SendMessage(chatID, i18n.T(lang, "start.already_registered"))
+		}
+
+		// registration in progress, repeat the current question
+		c, err := conversation.GetFlow(b.Context(update), chatID, update.Message.From.ID, flowRegistration)
+		if err != nil {
+			log.Printf("failed to get registration: %v", err)
+		}
+		if c == nil {
+			c = legacyConversation(b.Context(update), chatID)
+		}
+		if c != nil {
+			switch c.Step {
+			case stepLichess:
+				return b.SendMessage(chatID, i18n.T(lang, "ask.lichess"))
+			case stepChessCom:
+				return b.SendMessage(chatID, i18n.T(lang, "ask.chesscom"))
+			case stepSavedName:
+				return b.SendMessage(chatID, i18n.T(lang, "ask.saved_name"))
+			}
 		}
 	}
 
 	// Show registration options for new users
 	row := []tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardButtonData("lichess", "register:lichess"),
-		tgbotapi.NewInlineKeyboardButtonData("chess.com", "register:chess.com"),
+		tgbotapi.NewInlineKeyboardButtonData("lichess", callback.Encode("register", 0, "lichess")),
+		tgbotapi.NewInlineKeyboardButtonData("chess.com", callback.Encode("register", 0, "chess.com")),
 	}
 	row2 := []tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardButtonData("нигде не играю (честное слово)", "register:none"),
+		tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "start.no_platform"), callback.Encode("register", 0, "none")),
+	}
+	rows := [][]tgbotapi.InlineKeyboardButton{row, row2}
+
+	if loginRow := lichessLoginRow(chatID, lang); loginRow != nil {
+		rows = append([][]tgbotapi.InlineKeyboardButton{loginRow}, rows...)
 	}
 
-	return b.SendMessageWithButtons(chatID, "привет! чтобы записываться на турниры нужно показать свой шахматный уровень. где вы играете?", tgbotapi.NewInlineKeyboardMarkup(row, row2))
+	welcome := i18n.T(lang, "start.welcome")
+	if fromCheckinLink {
+		welcome += "\n\n" + i18n.T(lang, "start.checkin_after")
+	}
+	return b.SendMessageWithButtons(chatID, welcome, tgbotapi.NewInlineKeyboardMarkup(rows...))
+}
+
+// checkinFromLink checks the user into the tournament of a /start link if it is still the current one
+func checkinFromLink(ctx context.Context, b *bot.Bot, user db.User, tournamentID string, lang i18n.Lang) string {
+	if !b.Tournament.Metadata.Exists || b.Tournament.Metadata.ID != tournamentID {
+		return i18n.T(lang, "checkin.link_expired")
+	}
+	result, err := checkin.Enter(ctx, b, user, checkin.Origin{})
+	if err != nil {
+		log.Printf("failed to check in player: %v", err)
+		return i18n.T(lang, "checkin.failed")
+	}
+	return result.Message(lang)
+}
+
+// finishPendingCheckin checks a freshly registered user into the tournament they came from the group for
+func finishPendingCheckin(ctx context.Context, b *bot.Bot, chatID int64, lang i18n.Lang) {
+	tournamentID, err := redis.TakePendingCheckin(ctx, chatID)
+	if err != nil {
+		log.Printf("failed to get pending check-in of user %d: %v", chatID, err)
+		return
+	}
+	if tournamentID == "" {
+		return
+	}
+
+	user, err := db.GetByChatID(chatID)
+	if err != nil {
+		log.Printf("failed to get user %d for pending check-in: %v", chatID, err)
+		return
+	}
+
+	if err := b.SendMessage(chatID, checkinFromLink(ctx, b, user, tournamentID, lang)); err != nil {
+		log.Printf("failed to answer pending check-in of user %d: %v", chatID, err)
+	}
 }
 
 func handleRegister(b *bot.Bot, update tgbotapi.Update) error {
 	chatID := update.CallbackQuery.Message.Chat.ID
+	lang := b.Lang(update)
 	data := update.CallbackQuery.Data
 
 	// answer callback query to remove loading state
@@ -96,27 +190,27 @@ func handleRegister(b *bot.Bot, update tgbotapi.Update) error {
 
 	switch option {
 	case "lichess":
-		if err := b.EditMessage(chatID, update.CallbackQuery.Message.MessageID, "введите ваш никнейм на lichess:"); err != nil {
+		if err := b.EditMessage(chatID, update.CallbackQuery.Message.MessageID, i18n.T(lang, "ask.lichess")); err != nil {
 			return fmt.Errorf("failed to edit message: %w", err)
 		}
-		if err := db.UpdateState(chatID, db.StateAskedLichess); err != nil {
-			return fmt.Errorf("failed to update state: %w", err)
+		if _, err := conversation.Start(b.Context(update), chatID, update.CallbackQuery.From.ID, flowRegistration, stepLichess, nil, registrationTimeout); err != nil {
+			return err
 		}
 
 	case "chess.com":
-		if err := b.EditMessage(chatID, update.CallbackQuery.Message.MessageID, "введите ваш никнейм на chess.com:"); err != nil {
+		if err := b.EditMessage(chatID, update.CallbackQuery.Message.MessageID, i18n.T(lang, "ask.chesscom")); err != nil {
 			return fmt.Errorf("failed to edit message: %w", err)
 		}
-		if err := db.UpdateState(chatID, db.StateAskedChessCom); err != nil {
-			return fmt.Errorf("failed to update state: %w", err)
+		if _, err := conversation.Start(b.Context(update), chatID, update.CallbackQuery.From.ID, flowRegistration, stepChessCom, nil, registrationTimeout); err != nil {
+			return err
 		}
 
 	case "none":
-		if err := b.EditMessage(chatID, update.CallbackQuery.Message.MessageID, "введите ваш псевдоним для турниров:"); err != nil {
+		if err := b.EditMessage(chatID, update.CallbackQuery.Message.MessageID, i18n.T(lang, "ask.alias")); err != nil {
 			return fmt.Errorf("failed to edit message: %w", err)
 		}
-		if err := db.UpdateState(chatID, db.StateAskedSavedName); err != nil {
-			return fmt.Errorf("failed to update state: %w", err)
+		if _, err := conversation.Start(b.Context(update), chatID, update.CallbackQuery.From.ID, flowRegistration, stepSavedName, nil, registrationTimeout); err != nil {
+			return err
 		}
 
 	default:
@@ -126,84 +220,82 @@ func handleRegister(b *bot.Bot, update tgbotapi.Update) error {
 	return nil
 }
 
-func handleHelp(b *bot.Bot, update tgbotapi.Update) error {
-	return b.SendMessage(update.Message.Chat.ID, "/help — показать это сообщение\n\n/me — показать вашу информацию\n\n/myratings — показать пиковые рейтинги\n\n/change_nickname — изменить никнейм для турниров\n\n/change_platform — изменить или добавить аккаунт lichess/chess.com")
-}
-
 func handleMe(b *bot.Bot, update tgbotapi.Update) error {
-	chatID := update.Message.Chat.ID
-
-	if user, err := db.GetByChatID(chatID); err != nil {
-		return fmt.Errorf("failed to get user: %w", err)
-	} else {
-		return b.SendMessageWithMarkdown(chatID, db.Stringify(user), true)
-	}
+	user, _ := b.RegisteredUser(update)
+	return b.SendMessageWithMarkdown(update.Message.Chat.ID, db.Stringify(user, b.Lang(update)), true)
 }
 
 func handleMyRatings(b *bot.Bot, update tgbotapi.Update) error {
 	chatID := update.Message.Chat.ID
+	lang := b.Lang(update)
 	var lichess, chesscom string
-	if user, err := db.GetByChatID(chatID); err != nil {
-		return fmt.Errorf("failed to get user: %w", err)
-	} else {
+	user, _ := b.RegisteredUser(update)
 
-		if user.Lichess == nil || *user.Lichess == "" {
-			lichess = "личес не указан"
+	if user.Lichess == nil || *user.Lichess == "" {
+		lichess = i18n.T(lang, "ratings.lichess_missing")
+	}
+	if user.ChessCom == nil || *user.ChessCom == "" {
+		chesscom = i18n.T(lang, "ratings.chesscom_missing")
+	}
+
+	if user.Lichess != nil {
+		lichessTopRatings, err := utils.GetLichessAllTimeHigh(*user.Lichess)
+		if err != nil {
+			log.Printf("failed to get lichess ratings for user %d: %v", chatID, err)
+			lichess = i18n.T(lang, "ratings.lichess_down")
+		} else {
+			lichess = i18n.T(lang, "ratings.lichess", lichessTopRatings.Blitz, lichessTopRatings.Rapid, lichessTopRatings.Classical)
 		}
-		if user.ChessCom == nil || *user.ChessCom == "" {
-			chesscom = "чесском не указан"
+	}
+	if user.ChessCom != nil {
+		chesscomTopRatings, err := utils.GetChessComAllTimeHigh(*user.ChessCom)
+		if err != nil {
+			log.Printf("failed to get chesscom ratings for user %d: %v", chatID, err)
+			chesscom = i18n.T(lang, "ratings.chesscom_down")
+		} else {
+			chesscom = i18n.T(lang, "ratings.chesscom", chesscomTopRatings.Blitz, chesscomTopRatings.Rapid, chesscomTopRatings.Classical)
 		}
+	}
 
-		if user.Lichess != nil {
-			lichessTopRatings, err := utils.GetLichessAllTimeHigh(*user.Lichess)
-			if err != nil {
-				return fmt.Errorf("ошибка при запросе к базе личеса: %w", err)
-			}
-
-			lichess = fmt.Sprintf("пиковые рейтинги на личесе: блиц %d, рапид %d, классика %d", lichessTopRatings.Blitz, lichessTopRatings.Rapid, lichessTopRatings.Classical)
+	message := fmt.Sprintf("%s\n%s", lichess, chesscom)
+	if user.Fide != nil {
+		if ratings, ok := utils.GetFideRatings(*user.Fide); ok {
+			message += "\n" + i18n.T(lang, "ratings.fide", ratings.Standard, ratings.Rapid, ratings.Blitz)
+		} else {
+			message += "\n" + i18n.T(lang, "ratings.fide_missing")
 		}
-		if user.ChessCom != nil {
-			chesscomTopRatings, err := utils.GetChessComAllTimeHigh(*user.ChessCom)
-			if err != nil {
-				return fmt.Errorf("ошибка при запросе к базе чесскома: %w", err)
-			}
-			chesscom = fmt.Sprintf("пиковые рейтинги на чесскоме: блиц %d, рапид %d, классика %d", chesscomTopRatings.Blitz, chesscomTopRatings.Rapid, chesscomTopRatings.Classical)
+	}
+	if user.Rcf != nil {
+		if ratings, ok := utils.GetRcfRatings(*user.Rcf); ok {
+			message += "\n" + i18n.T(lang, "ratings.rcf", ratings.Standard, ratings.Rapid, ratings.Blitz)
+		} else {
+			message += "\n" + i18n.T(lang, "ratings.rcf_missing")
 		}
-
-		return b.SendMessage(chatID, fmt.Sprintf("%s\n%s", lichess, chesscom))
 	}
+
+	return b.SendMessage(chatID, message)
 }
 
 func handleChangeNickname(b *bot.Bot, update tgbotapi.Update) error {
 	chatID := update.Message.Chat.ID
-
-	user, err := db.GetByChatID(chatID)
-	if err != nil {
-		return fmt.Errorf("failed to get user: %w", err)
-	}
+	lang := b.Lang(update)
+	user, _ := b.RegisteredUser(update)
 
 	if user.SavedName == "" {
-		return b.SendMessage(chatID, "у вас ещё нет сохранённого никнейма")
+		return b.SendMessage(chatID, i18n.T(lang, "nickname.none"))
 	}
 
-	if err := db.UpdateState(chatID, db.StateEditingSavedName); err != nil {
-		return fmt.Errorf("failed to update state: %w", err)
+	if _, err := conversation.Start(b.Context(update), chatID, update.Message.From.ID, flowEditProfile, stepSavedName, nil, conversation.DefaultTimeout); err != nil {
+		return err
 	}
 
-	return b.SendMessage(chatID, fmt.Sprintf("ваш текущий никнейм: %s\n\nвведите новый никнейм:", user.SavedName))
+	return b.SendMessage(chatID, i18n.T(lang, "nickname.ask", user.SavedName))
 }
 
 func handleChangePlatform(b *bot.Bot, update tgbotapi.Update) error {
 	chatID := update.Message.Chat.ID
-
-	user, err := db.GetByChatID(chatID)
-	if err != nil {
-		return b.SendMessage(chatID, "вы ещё не зарегистрированы. напишите /start для регистрации")
-	}
-
-	if user.State != db.StateCompleted {
-		return b.SendMessage(chatID, "сначала завершите регистрацию")
-	}
+	lang := b.Lang(update)
+	user, _ := b.RegisteredUser(update)
 
 	var currentInfo string
 	if user.Lichess != nil && *user.Lichess != "" {
@@ -212,20 +304,36 @@ func handleChangePlatform(b *bot.Bot, update tgbotapi.Update) error {
 	if user.ChessCom != nil && *user.ChessCom != "" {
 		currentInfo += fmt.Sprintf("chess.com: %s\n", *user.ChessCom)
 	}
+	if user.Fide != nil && *user.Fide != "" {
+		currentInfo += fmt.Sprintf("fide: %s\n", *user.Fide)
+	}
+	if user.Rcf != nil && *user.Rcf != "" {
+		currentInfo += fmt.Sprintf("%s: %s\n", i18n.T(lang, "platform.rcf"), *user.Rcf)
+	}
 	if currentInfo == "" {
-		currentInfo = "платформы не указаны\n"
+		currentInfo = i18n.T(lang, "platform.none") + "\n"
 	}
 
 	row := []tgbotapi.InlineKeyboardButton{
-		tgbotapi.NewInlineKeyboardButtonData("lichess", "change_platform:lichess"),
-		tgbotapi.NewInlineKeyboardButtonData("chess.com", "change_platform:chesscom"),
+		tgbotapi.NewInlineKeyboardButtonData("lichess", callback.Encode("change_platform", 0, "lichess")),
+		tgbotapi.NewInlineKeyboardButtonData("chess.com", callback.Encode("change_platform", 0, "chesscom")),
+	}
+	row2 := []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData("fide id", callback.Encode("change_platform", 0, "fide")),
+		tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "platform.rcf_id"), callback.Encode("change_platform", 0, "rcf")),
 	}
 
-	return b.SendMessageWithButtons(chatID, fmt.Sprintf("текущие аккаунты:\n%s\nвыберите платформу для изменения:", currentInfo), tgbotapi.NewInlineKeyboardMarkup(row))
+	rows := [][]tgbotapi.InlineKeyboardButton{row, row2}
+	if loginRow := lichessLoginRow(chatID, lang); loginRow != nil {
+		rows = append(rows, loginRow)
+	}
+
+	return b.SendMessageWithButtons(chatID, i18n.T(lang, "platform.choose", currentInfo), tgbotapi.NewInlineKeyboardMarkup(rows...))
 }
 
 func handleChangePlatformCallback(b *bot.Bot, update tgbotapi.Update) error {
 	chatID := update.CallbackQuery.Message.Chat.ID
+	lang := b.Lang(update)
 	data := update.CallbackQuery.Data
 
 	callback := tgbotapi.NewCallback(update.CallbackQuery.ID, "")
@@ -242,19 +350,35 @@ func handleChangePlatformCallback(b *bot.Bot, update tgbotapi.Update) error {
 
 	switch platform {
 	case "lichess":
-		if err := b.EditMessage(chatID, update.CallbackQuery.Message.MessageID, "введите новый никнейм на lichess:"); err != nil {
+		if err := b.EditMessage(chatID, update.CallbackQuery.Message.MessageID, i18n.T(lang, "ask.new_lichess")); err != nil {
 			return fmt.Errorf("failed to edit message: %w", err)
 		}
-		if err := db.UpdateState(chatID, db.StateEditingLichess); err != nil {
-			return fmt.Errorf("failed to update state: %w", err)
+		if _, err := conversation.Start(b.Context(update), chatID, update.CallbackQuery.From.ID, flowEditProfile, stepLichess, nil, conversation.DefaultTimeout); err != nil {
+			return err
 		}
 
 	case "chesscom":
-		if err := b.EditMessage(chatID, update.CallbackQuery.Message.MessageID, "введите новый никнейм на chess.com:"); err != nil {
+		if err := b.EditMessage(chatID, update.CallbackQuery.Message.MessageID, i18n.T(lang, "ask.new_chesscom")); err != nil {
 			return fmt.Errorf("failed to edit message: %w", err)
 		}
-		if err := db.UpdateState(chatID, db.StateEditingChessCom); err != nil {
-			return fmt.Errorf("failed to update state: %w", err)
+		if _, err := conversation.Start(b.Context(update), chatID, update.CallbackQuery.From.ID, flowEditProfile, stepChessCom, nil, conversation.DefaultTimeout); err != nil {
+			return err
+		}
+
+	case "fide":
+		if err := b.EditMessage(chatID, update.CallbackQuery.Message.MessageID, i18n.T(lang, "ask.fide")); err != nil {
+			return fmt.Errorf("failed to edit message: %w", err)
+		}
+		if _, err := conversation.Start(b.Context(update), chatID, update.CallbackQuery.From.ID, flowEditProfile, stepFide, nil, conversation.DefaultTimeout); err != nil {
+			return err
+		}
+
+	case "rcf":
+		if err := b.EditMessage(chatID, update.CallbackQuery.Message.MessageID, i18n.T(lang, "ask.rcf")); err != nil {
+			return fmt.Errorf("failed to edit message: %w", err)
+		}
+		if _, err := conversation.Start(b.Context(update), chatID, update.CallbackQuery.From.ID, flowEditProfile, stepRcf, nil, conversation.DefaultTimeout); err != nil {
+			return err
 		}
 
 	default:
@@ -264,99 +388,249 @@ func handleChangePlatformCallback(b *bot.Bot, update tgbotapi.Update) error {
 	return nil
 }
 
+func handleLanguage(b *bot.Bot, update tgbotapi.Update) error {
+	if _, _, err := db.GetOrCreateUser(update); err != nil {
+		return err
+	}
+
+	var row []tgbotapi.InlineKeyboardButton
+	for _, lang := range i18n.Languages() {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "language.name"), callback.Encode("language", 0, string(lang))))
+	}
+	return b.SendMessageWithButtons(update.Message.Chat.ID, i18n.T(b.Lang(update), "language.ask"), tgbotapi.NewInlineKeyboardMarkup(row))
+}
+
+func handleLanguageCallback(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.CallbackQuery.Message.Chat.ID
+
+	callback := tgbotapi.NewCallback(update.CallbackQuery.ID, "")
+	if _, err := b.Request(callback); err != nil {
+		log.Printf("failed to answer callback: %v", err)
+	}
+
+	parts := strings.Split(update.CallbackQuery.Data, ":")
+	if len(parts) < 2 {
+		return fmt.Errorf("invalid callback data: %s", update.CallbackQuery.Data)
+	}
+	lang, ok := i18n.Parse(parts[1])
+	if !ok {
+		return fmt.Errorf("unknown language: %s", parts[1])
+	}
+
+	if err := db.SetLanguage(update.CallbackQuery.From.ID, string(lang)); err != nil {
+		return err
+	}
+	log.Printf("user %d switched language to %s", update.CallbackQuery.From.ID, lang)
+
+	return b.EditMessage(chatID, update.CallbackQuery.Message.MessageID, i18n.T(lang, "language.set"))
+}
+
+// handleBroadcasts shows whether club broadcasts are on with a button to switch them
+func handleBroadcasts(b *bot.Bot, update tgbotapi.Update) error {
+	user, _ := b.RegisteredUser(update)
+	lang := b.Lang(update)
+
+	text := i18n.T(lang, "broadcasts.on")
+	if user.NoBroadcasts {
+		text = i18n.T(lang, "broadcasts.off")
+	}
+	return b.SendMessageWithButtons(update.Message.Chat.ID, text, broadcastsKeyboard(lang, user.NoBroadcasts))
+}
+
+// handleBroadcastsCallback switches broadcasts off or on, from /broadcasts or from under a broadcast
+func handleBroadcastsCallback(b *bot.Bot, update tgbotapi.Update) error {
+	lang := b.Lang(update)
+	chatID := update.CallbackQuery.Message.Chat.ID
+
+	_, action, _ := strings.Cut(update.CallbackQuery.Data, ":")
+	off := action == bot.BroadcastsOff
+
+	if err := db.SetNoBroadcasts(update.CallbackQuery.From.ID, off); err != nil {
+		return err
+	}
+	log.Printf("user %d turned broadcasts %s", update.CallbackQuery.From.ID, action)
+
+	text := i18n.T(lang, "broadcasts.on")
+	if off {
+		text = i18n.T(lang, "broadcasts.off")
+	}
+	if _, err := b.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, text)); err != nil {
+		log.Printf("failed to answer callback: %v", err)
+	}
+
+	return b.EditButtons(chatID, update.CallbackQuery.Message.MessageID, broadcastsKeyboard(lang, off))
+}
+
+func broadcastsKeyboard(lang i18n.Lang, off bool) tgbotapi.InlineKeyboardMarkup {
+	button := tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "broadcasts.opt_out"), callback.Encode(bot.BroadcastsRoute, 0, bot.BroadcastsOff))
+	if off {
+		button = tgbotapi.NewInlineKeyboardButtonData(i18n.T(lang, "broadcasts.opt_in"), callback.Encode(bot.BroadcastsRoute, 0, bot.BroadcastsOn))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(button))
+}
+
+// conversation flows of the private chat
+const (
+	flowRegistration = "registration"
+	flowEditProfile  = "edit_profile"
+
+	stepLichess   = "lichess"
+	stepChessCom  = "chesscom"
+	stepSavedName = "saved_name"
+	stepFide      = "fide"
+	stepRcf       = "rcf"
+)
+
+// registration can be finished the next day, profile edits expire with the default timeout
+const registrationTimeout = 24 * time.Hour
+
+func handleCancel(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+	lang := b.Lang(update)
+
+	cancelled, err := conversation.Cancel(b.Context(update), chatID, update.Message.From.ID)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return b.SendMessage(chatID, i18n.T(lang, "cancel.nothing"))
+	}
+	return b.SendMessage(chatID, i18n.T(lang, "cancel.done"))
+}
+
 func handlePrivateMessage(b *bot.Bot, update tgbotapi.Update) error {
 	if update.Message == nil {
 		return nil
 	}
 
+	ctx := b.Context(update)
 	chatID := update.Message.Chat.ID
 
-	user, err := db.GetUser(chatID) // DB CALL 1
+	c, err := conversation.Get(ctx, chatID, update.Message.From.ID)
 	if err != nil {
-		log.Printf("failed to get user state: %v", err)
+		log.Printf("failed to get conversation: %v", err)
 		return nil
 	}
+	if c == nil {
+		c = legacyConversation(ctx, chatID)
+	}
 
-	switch user.State {
-	case db.StateAskedLichess:
+	if c != nil {
+		switch c.Flow {
+		case flowRegistration:
+			return handleRegistrationStep(ctx, b, update, c)
+		case flowEditProfile:
+			return handleEditProfileStep(ctx, b, update, c)
+		default:
+			// admin flows started from private chat are handled by admin handlers
+			return nil
+		}
+	}
+
+	log.Printf("private message from %d: %s", update.Message.From.ID, update.Message.Text)
+	forwardUnparsableMessage(b, update)
+	return nil
+}
+
+func handleRegistrationStep(ctx context.Context, b *bot.Bot, update tgbotapi.Update, c *conversation.Conversation) error {
+	chatID := update.Message.Chat.ID
+	lang := b.Lang(update)
+
+	switch c.Step {
+	case stepLichess:
 		username := strings.TrimPrefix(strings.TrimSpace(update.Message.Text), "@")
 		if username == "" {
-			return b.SendMessage(chatID, "юзернейм не может быть пустым")
+			return b.SendMessage(chatID, i18n.T(lang, "platform.username_empty"))
 		}
 
 		allTimeHigh, err := utils.GetLichessAllTimeHigh(username)
 		if err != nil {
-			return b.SendMessage(chatID, "произошла ошибка, попробуйте ещё раз")
+			return b.SendMessage(chatID, i18n.T(lang, "error.retry"))
 		}
 		log.Printf("all time high: %d", allTimeHigh)
 
 		// save the username
-		if err := db.UpdateLichess(chatID, username); err != nil { // DB CALL 2
+		if err := db.UpdateLichess(chatID, username); err != nil {
 			log.Printf("failed to update lichess username: %v", err)
-			return b.SendMessage(chatID, fmt.Sprintf("произошла ошибка, попробуйте ещё раз: %v", err))
+			return b.SendMessage(chatID, i18n.T(lang, "error.retry_details", err))
 		}
 
 		// ask for saved name
-		if err := db.UpdateState(chatID, db.StateAskedSavedName); err != nil { // DB CALL 3
-			return fmt.Errorf("failed to update state: %w", err)
+		if err := conversation.Advance(ctx, c, stepSavedName); err != nil {
+			return err
 		}
 
-		return b.SendMessage(chatID, "введите ваш никнейм для турниров:")
+		return b.SendMessage(chatID, i18n.T(lang, "ask.saved_name"))
 
-	case db.StateAskedChessCom:
+	case stepChessCom:
 		username := strings.TrimPrefix(strings.TrimSpace(update.Message.Text), "@")
 		if username == "" {
-			return b.SendMessage(chatID, "юзернейм не может быть пустым")
+			return b.SendMessage(chatID, i18n.T(lang, "platform.username_empty"))
 		}
 
 		// save the username
 		if err := db.UpdateChessCom(chatID, username); err != nil {
 			log.Printf("failed to update lichess username: %v", err)
-			return b.SendMessage(chatID, "произошла ошибка, попробуйте еще раз")
+			return b.SendMessage(chatID, i18n.T(lang, "error.retry"))
 		}
 
 		// ask for saved name
-		if err := db.UpdateState(chatID, db.StateAskedSavedName); err != nil {
-			return fmt.Errorf("failed to update state: %w", err)
+		if err := conversation.Advance(ctx, c, stepSavedName); err != nil {
+			return err
 		}
 
-		return b.SendMessage(chatID, "введите ваш никнейм для турниров:")
+		return b.SendMessage(chatID, i18n.T(lang, "ask.saved_name"))
 
-	case db.StateAskedSavedName:
+	case stepSavedName:
 		savedName := utils.Transliterate(update.Message.Text)
 
 		if savedName == "" {
-			return b.SendMessage(chatID, "никнейм не может быть пустым")
+			return b.SendMessage(chatID, i18n.T(lang, "nickname.empty"))
 		}
 
 		if err := db.UpdateSavedName(chatID, savedName); err != nil {
 			log.Printf("failed to update saved name: %v", err)
-			return b.SendMessage(chatID, "произошла ошибка, попробуйте еще раз")
+			return b.SendMessage(chatID, i18n.T(lang, "error.retry"))
 		}
 
 		if err := db.UpdateState(chatID, db.StateCompleted); err != nil {
 			return fmt.Errorf("failed to update state: %w", err)
 		}
 
-		return b.SendMessage(chatID, fmt.Sprintf("отлично! регистрация завершена. ваш никнейм: %s\n\nтеперь можете записываться на турниры в чате @moscowchessclub\n\n для записи на турнир нажмите /checkin в чате!!", savedName))
+		if err := conversation.EndFlow(ctx, c.ChatID, c.UserID, flowRegistration); err != nil {
+			log.Printf("failed to end registration: %v", err)
+		}
 
-	case db.StateEditingSavedName:
+		if err := b.SendMessage(chatID, i18n.T(lang, "registration.done", savedName)); err != nil {
+			return err
+		}
+		finishPendingCheckin(ctx, b, chatID, lang)
+		return nil
+	}
+
+	return fmt.Errorf("unknown registration step: %s", c.Step)
+}
+
+func handleEditProfileStep(ctx context.Context, b *bot.Bot, update tgbotapi.Update, c *conversation.Conversation) error {
+	chatID := update.Message.Chat.ID
+	lang := b.Lang(update)
+
+	switch c.Step {
+	case stepSavedName:
 		newName := utils.Transliterate(update.Message.Text)
 
 		if newName == "" {
-			return b.SendMessage(chatID, "никнейм не может быть пустым")
+			return b.SendMessage(chatID, i18n.T(lang, "nickname.empty"))
 		}
 
 		if err := db.UpdateSavedName(chatID, newName); err != nil {
 			log.Printf("failed to update saved name: %v", err)
-			return b.SendMessage(chatID, "произошла ошибка, попробуйте еще раз")
+			return b.SendMessage(chatID, i18n.T(lang, "error.retry"))
 		}
 
-		if err := db.UpdateState(chatID, db.StateCompleted); err != nil {
-			return fmt.Errorf("failed to update state: %w", err)
-		}
+		endEditing(ctx, c)
 
-		if err := b.SendMessage(chatID, fmt.Sprintf("никнейм успешно изменён на: %s", newName)); err != nil {
+		if err := b.SendMessage(chatID, i18n.T(lang, "nickname.changed", newName)); err != nil {
 			return err
 		}
 
@@ -366,70 +640,186 @@ func handlePrivateMessage(b *bot.Bot, update tgbotapi.Update) error {
 
 		return nil
 
-	case db.StateEditingLichess:
+	case stepLichess:
 		newUsername := strings.TrimPrefix(strings.TrimSpace(update.Message.Text), "@")
 		if newUsername == "" {
-			return b.SendMessage(chatID, "юзернейм не может быть пустым")
+			return b.SendMessage(chatID, i18n.T(lang, "platform.username_empty"))
 		}
 
 		_, err := utils.GetLichessAllTimeHigh(newUsername)
 		if err != nil {
-			return b.SendMessage(chatID, "пользователь не найден на lichess. проверьте никнейм и попробуйте ещё раз")
+			return b.SendMessage(chatID, i18n.T(lang, "platform.lichess_not_found"))
 		}
 
 		fullUser, err := db.GetByChatID(chatID)
 		if err != nil {
-			return b.SendMessage(chatID, "произошла ошибка, попробуйте ещё раз")
+			return b.SendMessage(chatID, i18n.T(lang, "error.retry"))
 		}
 
 		previousUsername := fullUser.Lichess
 
 		if err := db.UpdateLichessAndState(chatID, newUsername, db.StateCompleted); err != nil {
 			log.Printf("failed to update lichess username: %v", err)
-			return b.SendMessage(chatID, "произошла ошибка, попробуйте ещё раз")
+			return b.SendMessage(chatID, i18n.T(lang, "error.retry"))
 		}
 
+		endEditing(ctx, c)
+
 		if previousUsername != nil && *previousUsername != "" {
-			notifyAdminAboutPlatformChange(b, update, "lichess", *previousUsername, newUsername, fullUser)
+			notifyAdminAboutPlatformChange(b, update.Message.From, "lichess", *previousUsername, newUsername, fullUser)
 		}
 
-		return b.SendMessage(chatID, fmt.Sprintf("lichess аккаунт успешно изменён на: %s", newUsername))
+		return b.SendMessage(chatID, i18n.T(lang, "platform.lichess_changed", newUsername))
 
-	case db.StateEditingChessCom:
+	case stepChessCom:
 		newUsername := strings.TrimPrefix(strings.TrimSpace(update.Message.Text), "@")
 		if newUsername == "" {
-			return b.SendMessage(chatID, "юзернейм не может быть пустым")
+			return b.SendMessage(chatID, i18n.T(lang, "platform.username_empty"))
 		}
 
 		_, err := utils.GetChessComAllTimeHigh(newUsername)
 		if err != nil {
-			return b.SendMessage(chatID, "пользователь не найден на chess.com. проверьте никнейм и попробуйте ещё раз")
+			return b.SendMessage(chatID, i18n.T(lang, "platform.chesscom_not_found"))
 		}
 
 		fullUser, err := db.GetByChatID(chatID)
 		if err != nil {
-			return b.SendMessage(chatID, "произошла ошибка, попробуйте ещё раз")
+			return b.SendMessage(chatID, i18n.T(lang, "error.retry"))
 		}
 
 		previousUsername := fullUser.ChessCom
 
 		if err := db.UpdateChessComAndState(chatID, newUsername, db.StateCompleted); err != nil {
 			log.Printf("failed to update chesscom username: %v", err)
-			return b.SendMessage(chatID, "произошла ошибка, попробуйте ещё раз")
+			return b.SendMessage(chatID, i18n.T(lang, "error.retry"))
 		}
 
+		endEditing(ctx, c)
+
 		if previousUsername != nil && *previousUsername != "" {
-			notifyAdminAboutPlatformChange(b, update, "chess.com", *previousUsername, newUsername, fullUser)
+			notifyAdminAboutPlatformChange(b, update.Message.From, "chess.com", *previousUsername, newUsername, fullUser)
+		}
+
+		return b.SendMessage(chatID, i18n.T(lang, "platform.chesscom_changed", newUsername))
+
+	case stepFide:
+		fideID := strings.TrimSpace(update.Message.Text)
+		if _, err := strconv.Atoi(fideID); err != nil {
+			return b.SendMessage(chatID, i18n.T(lang, "platform.fide_digits"))
+		}
+
+		if utils.FideListLoaded() {
+			if _, ok := utils.GetFideRatings(fideID); !ok {
+				return b.SendMessage(chatID, i18n.T(lang, "platform.fide_not_listed"))
+			}
+		}
+
+		fullUser, err := db.GetByChatID(chatID)
+		if err != nil {
+			return b.SendMessage(chatID, i18n.T(lang, "error.retry"))
 		}
 
-		return b.SendMessage(chatID, fmt.Sprintf("chess.com аккаунт успешно изменён на: %s", newUsername))
+		previousID := fullUser.Fide
+
+		if err := db.UpdateFideAndState(chatID, fideID, db.StateCompleted); err != nil {
+			log.Printf("failed to update fide id: %v", err)
+			return b.SendMessage(chatID, i18n.T(lang, "error.retry"))
+		}
+
+		endEditing(ctx, c)
+
+		if previousID != nil && *previousID != "" {
+			notifyAdminAboutPlatformChange(b, update.Message.From, "fide", *previousID, fideID, fullUser)
+		}
+
+		return b.SendMessage(chatID, i18n.T(lang, "platform.fide_changed", fideID))
+
+	case stepRcf:
+		rcfID := strings.TrimSpace(update.Message.Text)
+		if _, err := strconv.Atoi(rcfID); err != nil {
+			return b.SendMessage(chatID, i18n.T(lang, "platform.rcf_digits"))
+		}
 
+		if utils.RcfListLoaded() {
+			if _, ok := utils.GetRcfRatings(rcfID); !ok {
+				return b.SendMessage(chatID, i18n.T(lang, "platform.rcf_not_listed"))
+			}
+		}
+
+		fullUser, err := db.GetByChatID(chatID)
+		if err != nil {
+			return b.SendMessage(chatID, i18n.T(lang, "error.retry"))
+		}
+
+		previousID := fullUser.Rcf
+
+		if err := db.UpdateRcfAndState(chatID, rcfID, db.StateCompleted); err != nil {
+			log.Printf("failed to update rcf id: %v", err)
+			return b.SendMessage(chatID, i18n.T(lang, "error.retry"))
+		}
+
+		endEditing(ctx, c)
+
+		if previousID != nil && *previousID != "" {
+			notifyAdminAboutPlatformChange(b, update.Message.From, "фшр", *previousID, rcfID, fullUser)
+		}
+
+		return b.SendMessage(chatID, i18n.T(lang, "platform.rcf_changed", rcfID))
+	}
+
+	return fmt.Errorf("unknown edit step: %s", c.Step)
+}
+
+func endEditing(ctx context.Context, c *conversation.Conversation) {
+	if err := conversation.EndFlow(ctx, c.ChatID, c.UserID, flowEditProfile); err != nil {
+		log.Printf("failed to end profile editing: %v", err)
+	}
+}
+
+// legacyConversation picks up a flow that was stored in the user state before conversations existed
+func legacyConversation(ctx context.Context, chatID int64) *conversation.Conversation {
+	user, err := db.GetUser(chatID)
+	if err != nil {
+		return nil
+	}
+
+	flow, step, timeout := flowRegistration, "", registrationTimeout
+	switch user.State {
+	case db.StateAskedLichess:
+		step = stepLichess
+	case db.StateAskedChessCom:
+		step = stepChessCom
+	case db.StateAskedSavedName:
+		step = stepSavedName
+	case db.StateEditingSavedName:
+		flow, step, timeout = flowEditProfile, stepSavedName, conversation.DefaultTimeout
+	case db.StateEditingLichess:
+		flow, step, timeout = flowEditProfile, stepLichess, conversation.DefaultTimeout
+	case db.StateEditingChessCom:
+		flow, step, timeout = flowEditProfile, stepChessCom, conversation.DefaultTimeout
+	case db.StateEditingFide:
+		flow, step, timeout = flowEditProfile, stepFide, conversation.DefaultTimeout
+	case db.StateEditingRcf:
+		flow, step, timeout = flowEditProfile, stepRcf, conversation.DefaultTimeout
 	default:
-		log.Printf("private message from %d: %s", update.Message.From.ID, update.Message.Text)
-		forwardUnparsableMessage(b, update)
+		return nil
 	}
 
-	return nil
+	// editing only happens after registration, so those users are completed
+	newState := db.State("")
+	if flow == flowEditProfile {
+		newState = db.StateCompleted
+	}
+	if err := db.UpdateState(chatID, newState); err != nil {
+		log.Printf("failed to reset legacy state for %d: %v", chatID, err)
+	}
+
+	c, err := conversation.Start(ctx, chatID, chatID, flow, step, nil, timeout)
+	if err != nil {
+		log.Printf("failed to migrate legacy state for %d: %v", chatID, err)
+		return nil
+	}
+	return c
 }
 
 func forwardUnparsableMessage(b *bot.Bot, update tgbotapi.Update) {
@@ -469,23 +859,29 @@ func forwardUnparsableMessage(b *bot.Bot, update tgbotapi.Update) {
 	}
 }
 
-func notifyAdminAboutPlatformChange(b *bot.Bot, update tgbotapi.Update, platform, previousUsername, newUsername string, dbUser db.User) {
+func notifyAdminAboutPlatformChange(b *bot.Bot, tgUser *tgbotapi.User, platform, previousUsername, newUsername string, dbUser db.User) {
 	adminChatID := b.GetAdminGroupID()
 	if adminChatID == 0 {
 		return
 	}
 
-	tgUser := update.Message.From
 	userLink := fmt.Sprintf("[%s %s](tg://user?id=%d)", tgUser.FirstName, tgUser.LastName, tgUser.ID)
 	if tgUser.UserName != "" {
 		userLink = fmt.Sprintf("[%s %s](tg://user?id=%d) (@%s)", tgUser.FirstName, tgUser.LastName, tgUser.ID, tgUser.UserName)
 	}
 
 	var previousLink, newLink string
-	if platform == "lichess" {
+	switch platform {
+	case "lichess":
 		previousLink = fmt.Sprintf("[%s](https://lichess.org/@/%s)", previousUsername, previousUsername)
 		newLink = fmt.Sprintf("[%s](https://lichess.org/@/%s)", newUsername, newUsername)
-	} else {
+	case "fide":
+		previousLink = fmt.Sprintf("[%s](https://ratings.fide.com/profile/%s)", previousUsername, previousUsername)
+		newLink = fmt.Sprintf("[%s](https://ratings.fide.com/profile/%s)", newUsername, newUsername)
+	case "фшр":
+		previousLink = fmt.Sprintf("[%s](https://ratings.ruchess.ru/people/%s)", previousUsername, previousUsername)
+		newLink = fmt.Sprintf("[%s](https://ratings.ruchess.ru/people/%s)", newUsername, newUsername)
+	default:
 		previousLink = fmt.Sprintf("[%s](https://www.chess.com/member/%s)", previousUsername, previousUsername)
 		newLink = fmt.Sprintf("[%s](https://www.chess.com/member/%s)", newUsername, newUsername)
 	}
@@ -531,53 +927,58 @@ func updateTournamentPlayerName(b *bot.Bot, playerID int, newName string) error
 
 	log.Printf("updated player %d name to %s in tournament", playerID, newName)
 
-	announcementMessageID := b.Tournament.Metadata.AnnouncementMessageID
-	if announcementMessageID == 0 {
+	b.Tournament.MarkAnnouncementDirty()
+	return nil
+}
+
+// lichessLoginRow returns a button opening lichess login, or nil when oauth is not configured
+func lichessLoginRow(chatID int64, lang i18n.Lang) []tgbotapi.InlineKeyboardButton {
+	if lichessAuth == nil {
 		return nil
 	}
 
-	messageIntro := b.Tournament.Metadata.AnnouncementIntro
-	if messageIntro == "" {
-		messageIntro = "запись на турнир открыта"
+	authURL, err := lichessAuth.AuthURL(chatID)
+	if err != nil {
+		log.Printf("failed to build lichess login url: %v", err)
+		return nil
 	}
 
-	message := buildTournamentListMessage(b, messageIntro)
-	if err := b.EditMessage(b.GetMainGroupID(), announcementMessageID, message); err != nil {
-		return fmt.Errorf("failed to update announcement message: %w", err)
+	return []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonURL(i18n.T(lang, "start.lichess_login"), authURL),
 	}
-
-	log.Printf("updated announcement message after name change")
-	return nil
 }
 
-func buildTournamentListMessage(b *bot.Bot, messageIntro string) string {
-	message := fmt.Sprintf("%s\n\nучастники:\n", messageIntro)
-
-	count := 1
-	for _, player := range b.Tournament.List {
-		if player.State == types.StateInTournament {
-			message += fmt.Sprintf("%d. %s\n", count, player.SavedName)
-			count++
+// LichessVerifiedHandler saves accounts confirmed through lichess oauth and continues registration
+func LichessVerifiedHandler(b *bot.Bot) lichessauth.VerifiedHandler {
+	return func(chatID int64, username string) error {
+		user, err := db.GetByChatID(chatID)
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
 		}
-	}
 
-	if count == 1 {
-		message += "пока никого нет\n"
-	}
+		registered := user.State == db.StateCompleted
+		lang := i18n.Match(user.Language, "")
 
-	queuedPlayers := []types.Player{}
-	for _, player := range b.Tournament.List {
-		if player.State == types.StateQueued {
-			queuedPlayers = append(queuedPlayers, player)
+		if err := db.UpdateVerifiedLichessAndState(chatID, username, user.State); err != nil {
+			if sendErr := b.SendMessage(chatID, i18n.T(lang, "lichess.save_failed")); sendErr != nil {
+				log.Printf("failed to notify user %d: %v", chatID, sendErr)
+			}
+			return err
+		}
+		log.Printf("user %d verified lichess account %s", chatID, username)
+
+		if !registered {
+			if _, err := conversation.Start(context.Background(), chatID, chatID, flowRegistration, stepSavedName, nil, registrationTimeout); err != nil {
+				return err
+			}
+			return b.SendMessage(chatID, i18n.T(lang, "lichess.verified_continue", username))
 		}
-	}
 
-	if len(queuedPlayers) > 0 {
-		message += "\nочередь:\n"
-		for i, player := range queuedPlayers {
-			message += fmt.Sprintf("%d. %s &#9816;\n", i+1, player.SavedName)
+		if user.Lichess != nil && *user.Lichess != "" && !strings.EqualFold(*user.Lichess, username) {
+			tgUser := &tgbotapi.User{ID: chatID, FirstName: user.TgName, UserName: user.Username}
+			notifyAdminAboutPlatformChange(b, tgUser, "lichess", *user.Lichess, username, user)
 		}
-	}
 
-	return message
+		return b.SendMessage(chatID, i18n.T(lang, "lichess.verified", username))
+	}
 }
@@ -0,0 +1,67 @@
+package privatechat
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/i18n"
+	"github.com/sukalov/mshkbot/internal/stats"
+)
+
+// historyLength is how many recent tournaments /stats lists
+const historyLength = 5
+
+// handleStats shows the player's statistics computed from the archived tournaments
+func handleStats(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+	lang := b.Lang(update)
+
+	archives, err := db.GetArchives()
+	if err != nil {
+		return fmt.Errorf("failed to get archives for stats: %w", err)
+	}
+
+	tournaments := make([]stats.Tournament, 0, len(archives))
+	for _, archive := range archives {
+		metadata, players, err := archive.Decode()
+		if err != nil {
+			log.Printf("skipping archived tournament: %v", err)
+			continue
+		}
+		tournaments = append(tournaments, stats.Tournament{Metadata: metadata, Players: players})
+	}
+
+	player := stats.ForPlayer(int(update.Message.From.ID), tournaments, scheduler.Timezone())
+	if player.Entered == 0 {
+		return b.SendMessage(chatID, i18n.T(lang, "stats.none"))
+	}
+	return b.SendMessage(chatID, describeStats(lang, player))
+}
+
+func describeStats(lang i18n.Lang, player stats.Player) string {
+	lines := []string{
+		i18n.T(lang, "stats.entered", player.Entered),
+		i18n.T(lang, "stats.played", player.Played),
+		i18n.T(lang, "stats.queued", player.Queued),
+		i18n.T(lang, "stats.promoted", player.Promoted),
+		i18n.T(lang, "stats.withdrawals", player.Withdrawals),
+		i18n.T(lang, "stats.no_shows", player.NoShows),
+		i18n.T(lang, "stats.favourite_day", i18n.T(lang, fmt.Sprintf("weekday.%d", player.FavouriteDay))),
+		i18n.T(lang, "stats.streak", player.CurrentStreak, player.LongestStreak),
+	}
+
+	history := player.History
+	if len(history) > historyLength {
+		history = history[:historyLength]
+	}
+	lines = append(lines, "", i18n.T(lang, "stats.history"))
+	for _, entry := range history {
+		lines = append(lines, fmt.Sprintf("%s — %s", entry.Date.Format("02.01.2006"), i18n.T(lang, "stats.outcome."+entry.Outcome)))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,112 @@
+package privatechat
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/callback"
+	"github.com/sukalov/mshkbot/internal/checkin"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/i18n"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// subscribeRoute toggles a subscription topic: subscribe:<topic>
+const subscribeRoute = "subscribe"
+
+// handleSubscribe shows a toggle per schedule event and category
+func handleSubscribe(b *bot.Bot, update tgbotapi.Update) error {
+	keyboard, err := subscribeKeyboard(b.Lang(update), update.Message.From.ID)
+	if err != nil {
+		return err
+	}
+	return b.SendMessageWithButtons(update.Message.Chat.ID, i18n.T(b.Lang(update), "subscribe.ask"), keyboard)
+}
+
+func handleSubscribeCallback(b *bot.Bot, update tgbotapi.Update) error {
+	lang := b.Lang(update)
+	userID := update.CallbackQuery.From.ID
+
+	_, topic, _ := strings.Cut(update.CallbackQuery.Data, ":")
+	if topic == "" {
+		return fmt.Errorf("invalid callback data: %s", update.CallbackQuery.Data)
+	}
+
+	subscribed, err := db.ToggleSubscription(userID, topic)
+	if err != nil {
+		return err
+	}
+	log.Printf("user %d subscribed to %s: %v", userID, topic, subscribed)
+
+	answer := i18n.T(lang, "subscribe.off")
+	if subscribed {
+		answer = i18n.T(lang, "subscribe.on")
+	}
+	if _, err := b.Request(tgbotapi.NewCallback(update.CallbackQuery.ID, answer)); err != nil {
+		log.Printf("failed to answer callback: %v", err)
+	}
+
+	keyboard, err := subscribeKeyboard(lang, userID)
+	if err != nil {
+		return err
+	}
+	return b.EditButtons(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, keyboard)
+}
+
+// subscribeKeyboard marks the topics the user is subscribed to
+func subscribeKeyboard(lang i18n.Lang, userID int64) (tgbotapi.InlineKeyboardMarkup, error) {
+	topics, err := db.GetSubscriptions(userID)
+	if err != nil {
+		return tgbotapi.InlineKeyboardMarkup{}, err
+	}
+	subscribed := make(map[string]bool)
+	for _, topic := range topics {
+		subscribed[topic] = true
+	}
+
+	button := func(topic, text string) []tgbotapi.InlineKeyboardButton {
+		mark := "▫️ "
+		if subscribed[topic] {
+			mark = "✅ "
+		}
+		return tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(mark+text, callback.Encode(subscribeRoute, 0, topic)))
+	}
+
+	rows := [][]tgbotapi.InlineKeyboardButton{
+		button(types.TopicAll, i18n.T(lang, "subscribe.all")),
+		button(types.TopicGreen, i18n.T(lang, "subscribe.green")),
+	}
+	for _, event := range scheduler.ScheduleManager.GetDefaultEvents() {
+		if event.Deleted {
+			continue
+		}
+		rows = append(rows, button(types.EventTopic(event.ID), event.Day))
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...), nil
+}
+
+// handleEntryInPrivate answers the sign up button sent to subscribers
+func handleEntryInPrivate(b *bot.Bot, update tgbotapi.Update) error {
+	lang := b.Lang(update)
+	user, _ := b.RegisteredUser(update)
+
+	_, action, _ := strings.Cut(update.CallbackQuery.Data, ":")
+	if action != bot.EntryJoin {
+		return fmt.Errorf("unknown entry action: %s", action)
+	}
+
+	text := i18n.T(lang, "checkin.failed")
+	result, err := checkin.Enter(b.Context(update), b, user, checkin.Origin{})
+	if err != nil {
+		log.Printf("failed to check in player: %v", err)
+	} else {
+		text = result.Message(lang)
+	}
+	answer := tgbotapi.NewCallback(update.CallbackQuery.ID, text)
+	answer.ShowAlert = true
+	_, err = b.Request(answer)
+	return err
+}
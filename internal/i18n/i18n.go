@@ -0,0 +1,174 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"path"
+	"strings"
+)
+
+// Lang is a language the bot can talk in
+type Lang string
+
+const (
+	RU Lang = "ru"
+	EN Lang = "en"
+)
+
+// Default is used when nothing is known about the user
+const Default = RU
+
+// languages that get russian texts when the user has not chosen one, everyone else gets english
+var russianSpeaking = map[string]bool{"ru": true, "uk": true, "be": true, "kk": true}
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// message is a catalog entry: a text, random variants of it, or plural forms
+type message struct {
+	text     string
+	variants []string
+	plural   map[string]string
+}
+
+func (m *message) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &m.text); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &m.variants); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &m.plural); err != nil {
+		return fmt.Errorf("message must be a string, a list of variants or plural forms: %w", err)
+	}
+	return nil
+}
+
+var catalog = mustLoad()
+
+func mustLoad() map[Lang]map[string]message {
+	c, err := load()
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func load() (map[Lang]map[string]message, error) {
+	files, err := locales.ReadDir("locales")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read locales: %w", err)
+	}
+
+	c := make(map[Lang]map[string]message)
+	for _, file := range files {
+		data, err := locales.ReadFile(path.Join("locales", file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file.Name(), err)
+		}
+		var messages map[string]message
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file.Name(), err)
+		}
+		c[Lang(strings.TrimSuffix(file.Name(), ".json"))] = messages
+	}
+	return c, nil
+}
+
+// Languages lists the languages that have a catalog
+func Languages() []Lang {
+	return []Lang{RU, EN}
+}
+
+// Parse recognizes a language the bot has a catalog for
+func Parse(code string) (Lang, bool) {
+	lang := Lang(strings.ToLower(strings.TrimSpace(code)))
+	if _, ok := catalog[lang]; ok {
+		return lang, true
+	}
+	return "", false
+}
+
+// Match picks the language for a user: the stored preference first, then the language of their telegram client
+func Match(preferred, clientCode string) Lang {
+	if lang, ok := Parse(preferred); ok {
+		return lang
+	}
+	if clientCode == "" {
+		return Default
+	}
+	base := strings.ToLower(strings.SplitN(clientCode, "-", 2)[0])
+	if russianSpeaking[base] {
+		return RU
+	}
+	if lang, ok := Parse(base); ok {
+		return lang
+	}
+	return EN
+}
+
+// T returns the message for key formatted with args. variants are picked at random.
+// missing translations fall back to the default language and then to the key itself
+func T(lang Lang, key string, args ...interface{}) string {
+	m, ok := lookup(lang, key)
+	if !ok {
+		return key
+	}
+	text := m.text
+	if len(m.variants) > 0 {
+		text = m.variants[rand.Intn(len(m.variants))]
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// N returns the plural form of key for n. n is the first formatting argument
+func N(lang Lang, key string, n int, args ...interface{}) string {
+	m, ok := lookup(lang, key)
+	if !ok {
+		return key
+	}
+	if _, ok := catalog[lang][key]; !ok {
+		lang = Default
+	}
+	text, ok := m.plural[Plural(lang, n)]
+	if !ok {
+		text = m.plural["other"]
+	}
+	return fmt.Sprintf(text, append([]interface{}{n}, args...)...)
+}
+
+// Plural returns the cldr plural category of n: one, few, many or other
+func Plural(lang Lang, n int) string {
+	if n < 0 {
+		n = -n
+	}
+	switch lang {
+	case RU:
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	}
+}
+
+func lookup(lang Lang, key string) (message, bool) {
+	if m, ok := catalog[lang][key]; ok {
+		return m, true
+	}
+	m, ok := catalog[Default][key]
+	return m, ok
+}
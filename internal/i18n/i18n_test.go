@@ -0,0 +1,154 @@
+package i18n
+
+import (
+	"regexp"
+	"testing"
+)
+
+var verb = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z]`)
+
+// forms every plural entry needs in each language
+var pluralForms = map[Lang][]string{
+	RU: {"one", "few", "many"},
+	EN: {"one", "other"},
+}
+
+func verbs(m message) []string {
+	texts := append([]string{m.text}, m.variants...)
+	for _, form := range m.plural {
+		texts = append(texts, form)
+	}
+	var found []string
+	for _, text := range texts {
+		if text == "" {
+			continue
+		}
+		found = verb.FindAllString(text, -1)
+		break
+	}
+	return found
+}
+
+func TestCatalogsMatch(t *testing.T) {
+	for _, lang := range Languages() {
+		if _, ok := catalog[lang]; !ok {
+			t.Fatalf("no catalog for %s", lang)
+		}
+	}
+
+	for key, ru := range catalog[RU] {
+		for _, lang := range Languages() {
+			m, ok := catalog[lang][key]
+			if !ok {
+				t.Errorf("%s: missing %q", lang, key)
+				continue
+			}
+			if (m.plural != nil) != (ru.plural != nil) || (m.variants != nil) != (ru.variants != nil) {
+				t.Errorf("%s: %q is a different kind of message than in %s", lang, key, RU)
+				continue
+			}
+			if got, want := len(verbs(m)), len(verbs(ru)); got != want {
+				t.Errorf("%s: %q has %d formatting verbs, %s has %d", lang, key, got, RU, want)
+			}
+			for _, form := range m.variants {
+				if got, want := len(verb.FindAllString(form, -1)), len(verbs(ru)); got != want {
+					t.Errorf("%s: variant of %q has %d formatting verbs, expected %d", lang, key, got, want)
+				}
+			}
+			if m.plural != nil {
+				for _, form := range pluralForms[lang] {
+					if _, ok := m.plural[form]; !ok {
+						t.Errorf("%s: %q has no %q form", lang, key, form)
+					}
+				}
+			}
+		}
+	}
+
+	for _, lang := range Languages() {
+		for key := range catalog[lang] {
+			if _, ok := catalog[RU][key]; !ok {
+				t.Errorf("%s: %q is not in the %s catalog", lang, key, RU)
+			}
+		}
+	}
+}
+
+func TestPlural(t *testing.T) {
+	tests := []struct {
+		lang Lang
+		n    int
+		want string
+	}{
+		{RU, 1, "one"},
+		{RU, 21, "one"},
+		{RU, 11, "many"},
+		{RU, 2, "few"},
+		{RU, 24, "few"},
+		{RU, 12, "many"},
+		{RU, 5, "many"},
+		{RU, 0, "many"},
+		{RU, 111, "many"},
+		{RU, 101, "one"},
+		{EN, 1, "one"},
+		{EN, 0, "other"},
+		{EN, 2, "other"},
+	}
+	for _, tt := range tests {
+		if got := Plural(tt.lang, tt.n); got != tt.want {
+			t.Errorf("Plural(%s, %d) = %s, want %s", tt.lang, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestN(t *testing.T) {
+	tests := []struct {
+		lang Lang
+		n    int
+		want string
+	}{
+		{RU, 1, "перед вами 1 человек"},
+		{RU, 3, "перед вами 3 человека"},
+		{RU, 12, "перед вами 12 человек"},
+		{EN, 1, "1 person ahead of you"},
+		{EN, 4, "4 people ahead of you"},
+	}
+	for _, tt := range tests {
+		if got := N(tt.lang, "checkin.queue_ahead", tt.n); got != tt.want {
+			t.Errorf("N(%s, %d) = %q, want %q", tt.lang, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T(EN, "nickname.changed", "magnus"); got != "nickname changed to: magnus" {
+		t.Errorf("unexpected english text: %q", got)
+	}
+	if got := T(RU, "no.such.key"); got != "no.such.key" {
+		t.Errorf("expected missing key to be returned as is, got %q", got)
+	}
+	if got := T(Lang("de"), "cancel.done"); got != "отменено" {
+		t.Errorf("expected fallback to the default language, got %q", got)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		preferred, client string
+		want              Lang
+	}{
+		{"", "", RU},
+		{"", "ru", RU},
+		{"", "uk", RU},
+		{"", "en-US", EN},
+		{"", "de", EN},
+		{"en", "ru", EN},
+		{"ru", "en", RU},
+		{"xx", "en", EN},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.preferred, tt.client); got != tt.want {
+			t.Errorf("Match(%q, %q) = %s, want %s", tt.preferred, tt.client, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package lichessauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultBaseURL = "https://lichess.org"
+
+// CallbackPath is where lichess redirects the user after login
+const CallbackPath = "/oauth/lichess/callback"
+
+const loginTTL = 10 * time.Minute
+
+type Config struct {
+	BaseURL     string
+	ClientID    string
+	RedirectURL string
+}
+
+// VerifiedHandler is called once lichess confirmed which account the telegram user owns
+type VerifiedHandler func(chatID int64, username string) error
+
+type pendingLogin struct {
+	chatID    int64
+	verifier  string
+	createdAt time.Time
+}
+
+// Provider runs the lichess oauth2 pkce flow and serves the local callback endpoint
+type Provider struct {
+	config     Config
+	client     *http.Client
+	mu         sync.Mutex
+	pending    map[string]pendingLogin
+	onVerified VerifiedHandler
+	server     *http.Server
+}
+
+func New(config Config) *Provider {
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultBaseURL
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+
+	return &Provider{
+		config:  config,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		pending: make(map[string]pendingLogin),
+	}
+}
+
+func (p *Provider) SetVerifiedHandler(handler VerifiedHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onVerified = handler
+}
+
+// AuthURL starts a login for the telegram chat and returns the lichess authorization url
+func (p *Provider) AuthURL(chatID int64) (string, error) {
+	state, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	p.cleanupExpired()
+	p.pending[state] = pendingLogin{
+		chatID:    chatID,
+		verifier:  verifier,
+		createdAt: time.Now(),
+	}
+	p.mu.Unlock()
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("code_challenge_method", "S256")
+	query.Set("code_challenge", challenge(verifier))
+	query.Set("state", state)
+
+	return fmt.Sprintf("%s/oauth?%s", p.config.BaseURL, query.Encode()), nil
+}
+
+// ServeHTTP handles the redirect back from lichess
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if errCode := query.Get("error"); errCode != "" {
+		log.Printf("lichess oauth denied: %s", errCode)
+		writePage(w, http.StatusOK, "вход отменён. вернитесь в телеграм и попробуйте ещё раз")
+		return
+	}
+
+	p.mu.Lock()
+	login, ok := p.pending[query.Get("state")]
+	delete(p.pending, query.Get("state"))
+	handler := p.onVerified
+	p.mu.Unlock()
+
+	if !ok || time.Since(login.createdAt) > loginTTL {
+		writePage(w, http.StatusBadRequest, "ссылка устарела. запросите новую в телеграме")
+		return
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		writePage(w, http.StatusBadRequest, "lichess не прислал код авторизации")
+		return
+	}
+
+	username, err := p.verify(r.Context(), code, login.verifier)
+	if err != nil {
+		log.Printf("lichess oauth failed for chat %d: %v", login.chatID, err)
+		writePage(w, http.StatusBadGateway, "не получилось связаться с lichess. попробуйте ещё раз")
+		return
+	}
+
+	if handler != nil {
+		if err := handler(login.chatID, username); err != nil {
+			log.Printf("failed to save verified lichess account for chat %d: %v", login.chatID, err)
+			writePage(w, http.StatusInternalServerError, "не получилось сохранить аккаунт. попробуйте ещё раз")
+			return
+		}
+	}
+
+	writePage(w, http.StatusOK, fmt.Sprintf("аккаунт %s подтверждён. можно возвращаться в телеграм", username))
+}
+
+// ListenAndServe serves the callback endpoint until Shutdown is called
+func (p *Provider) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle(CallbackPath, p)
+
+	p.mu.Lock()
+	p.server = &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	server := p.server
+	p.mu.Unlock()
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (p *Provider) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	server := p.server
+	p.mu.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
+
+// verify exchanges the code for a token, reads the account and revokes the token again
+func (p *Provider) verify(ctx context.Context, code, verifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("code_verifier", verifier)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.config.BaseURL+"/api/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to obtain token: %s", resp.Status)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("empty access token")
+	}
+	defer p.revoke(token.AccessToken)
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, p.config.BaseURL+"/api/account", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	accountResp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request account: %w", err)
+	}
+	defer accountResp.Body.Close()
+
+	if accountResp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch account: %s", accountResp.Status)
+	}
+
+	var account struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(accountResp.Body).Decode(&account); err != nil {
+		return "", fmt.Errorf("failed to decode account: %w", err)
+	}
+	if account.Username == "" {
+		return "", fmt.Errorf("empty username in account")
+	}
+
+	return account.Username, nil
+}
+
+// revoke drops the token, the bot only needs it once to learn the username
+func (p *Provider) revoke(accessToken string) {
+	req, err := http.NewRequest(http.MethodDelete, p.config.BaseURL+"/api/token", nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		log.Printf("failed to revoke lichess token: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func (p *Provider) cleanupExpired() {
+	for state, login := range p.pending {
+		if time.Since(login.createdAt) > loginTTL {
+			delete(p.pending, state)
+		}
+	}
+}
+
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomString(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random string: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func writePage(w http.ResponseWriter, status int, text string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, text)
+}
@@ -0,0 +1,110 @@
+package lichessauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// newMockLichess emulates the lichess token and account endpoints for the pkce flow
+func newMockLichess(t *testing.T) (*httptest.Server, map[string]string) {
+	challenges := make(map[string]string)
+	revoked := false
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			revoked = true
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "bad form", http.StatusBadRequest)
+			return
+		}
+		if r.Form.Get("grant_type") != "authorization_code" || r.Form.Get("code") != "good-code" {
+			http.Error(w, "bad grant", http.StatusBadRequest)
+			return
+		}
+		if challenge(r.Form.Get("code_verifier")) != challenges["good-code"] {
+			http.Error(w, "bad verifier", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "token-123", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/api/account", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-123" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id": "magnus", "username": "Magnus"})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		server.Close()
+		if !revoked {
+			t.Errorf("token was not revoked")
+		}
+	})
+	return server, challenges
+}
+
+func TestLoginFlow(t *testing.T) {
+	mock, challenges := newMockLichess(t)
+
+	provider := New(Config{BaseURL: mock.URL, ClientID: "mshkbot", RedirectURL: "http://localhost" + CallbackPath})
+
+	var verifiedChat int64
+	var verifiedUsername string
+	provider.SetVerifiedHandler(func(chatID int64, username string) error {
+		verifiedChat, verifiedUsername = chatID, username
+		return nil
+	})
+
+	authURL, err := provider.AuthURL(42)
+	if err != nil {
+		t.Fatalf("failed to build auth url: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("invalid auth url: %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != "mshkbot" {
+		t.Fatalf("unexpected auth url: %s", authURL)
+	}
+
+	// the user approves on lichess, which remembers the challenge for the issued code
+	challenges["good-code"] = query.Get("code_challenge")
+
+	callback := httptest.NewRecorder()
+	provider.ServeHTTP(callback, httptest.NewRequest(http.MethodGet, CallbackPath+"?code=good-code&state="+url.QueryEscape(query.Get("state")), nil))
+
+	if callback.Code != http.StatusOK {
+		t.Fatalf("callback failed with %d: %s", callback.Code, callback.Body.String())
+	}
+	if verifiedChat != 42 || verifiedUsername != "Magnus" {
+		t.Errorf("unexpected verified account: %d %s", verifiedChat, verifiedUsername)
+	}
+
+	// a state can only be used once
+	replay := httptest.NewRecorder()
+	provider.ServeHTTP(replay, httptest.NewRequest(http.MethodGet, CallbackPath+"?code=good-code&state="+url.QueryEscape(query.Get("state")), nil))
+	if replay.Code != http.StatusBadRequest {
+		t.Errorf("expected replayed state to be rejected, got %d", replay.Code)
+	}
+}
+
+func TestUnknownState(t *testing.T) {
+	provider := New(Config{BaseURL: "http://127.0.0.1:0", ClientID: "mshkbot"})
+
+	recorder := httptest.NewRecorder()
+	provider.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, CallbackPath+"?code=x&state=unknown", nil))
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected unknown state to be rejected, got %d", recorder.Code)
+	}
+}
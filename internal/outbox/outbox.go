@@ -0,0 +1,390 @@
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Priority decides which queued request goes first when limits allow only some of them
+type Priority int
+
+const (
+	// PriorityBulk is for mass notifications and broadcasts
+	PriorityBulk Priority = iota
+	// PriorityNormal is for background updates such as announcement edits
+	PriorityNormal
+	// PriorityInteractive is for direct replies to what a user just did
+	PriorityInteractive
+)
+
+// ErrStopped is returned for requests that were still queued when the outbox stopped
+var ErrStopped = errors.New("outbox stopped")
+
+// SendFunc performs one telegram request
+type SendFunc func() (tgbotapi.Message, error)
+
+// Config holds telegram limits, see https://core.telegram.org/bots/faq#my-bot-is-hitting-limits-how-do-i-avoid-this
+type Config struct {
+	GlobalPerSecond  float64
+	GroupPerMinute   float64
+	PrivatePerSecond float64
+	PrivateBurst     float64
+	MaxRetries       int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		GlobalPerSecond:  30,
+		GroupPerMinute:   20,
+		PrivatePerSecond: 1,
+		PrivateBurst:     3,
+		MaxRetries:       5,
+	}
+}
+
+type result struct {
+	message tgbotapi.Message
+	err     error
+}
+
+type job struct {
+	chatID   int64
+	priority Priority
+	seq      uint64
+	send     SendFunc
+	editKey  string
+	attempts int
+	waiters  []chan result
+}
+
+type chatState struct {
+	bucket       *bucket
+	blockedUntil time.Time
+	busy         bool
+}
+
+// Outbox sends telegram requests within global and per-chat rate limits.
+// requests to one chat go out one at a time and in order of priority
+type Outbox struct {
+	config Config
+	now    func() time.Time
+
+	mu            sync.Mutex
+	queue         []*job
+	edits         map[string]*job
+	chats         map[int64]*chatState
+	global        *bucket
+	globalBlocked time.Time
+	seq           uint64
+	stopped       bool
+
+	wake chan struct{}
+	stop chan struct{}
+}
+
+// New creates an outbox and starts its dispatcher
+func New(config Config) *Outbox {
+	o := &Outbox{
+		config: config,
+		now:    time.Now,
+		edits:  make(map[string]*job),
+		chats:  make(map[int64]*chatState),
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+	o.global = newBucket(config.GlobalPerSecond, config.GlobalPerSecond, o.now())
+	go o.run()
+	return o
+}
+
+// Stop fails all queued requests and stops the dispatcher
+func (o *Outbox) Stop() {
+	o.mu.Lock()
+	if o.stopped {
+		o.mu.Unlock()
+		return
+	}
+	o.stopped = true
+	queued := o.queue
+	o.queue = nil
+	o.edits = make(map[string]*job)
+	o.mu.Unlock()
+
+	close(o.stop)
+	for _, j := range queued {
+		j.resolve(result{err: ErrStopped})
+	}
+}
+
+// Send queues a request to the chat and waits for its result
+func (o *Outbox) Send(chatID int64, priority Priority, send SendFunc) (tgbotapi.Message, error) {
+	done := make(chan result, 1)
+
+	o.mu.Lock()
+	if o.stopped {
+		o.mu.Unlock()
+		return tgbotapi.Message{}, ErrStopped
+	}
+	o.push(&job{chatID: chatID, priority: priority, send: send, waiters: []chan result{done}})
+	o.mu.Unlock()
+	o.signal()
+
+	r := <-done
+	return r.message, r.err
+}
+
+// Edit queues an edit of a message. while an edit of the same message is still
+// waiting in the queue, newer edits replace it instead of being sent one by one
+func (o *Outbox) Edit(chatID int64, messageID int, priority Priority, send SendFunc) error {
+	done := make(chan result, 1)
+	key := fmt.Sprintf("%d:%d", chatID, messageID)
+
+	o.mu.Lock()
+	if o.stopped {
+		o.mu.Unlock()
+		return ErrStopped
+	}
+	if queued, ok := o.edits[key]; ok {
+		queued.send = send
+		queued.waiters = append(queued.waiters, done)
+		if priority > queued.priority {
+			queued.priority = priority
+			o.sort()
+		}
+	} else {
+		j := &job{chatID: chatID, priority: priority, send: send, editKey: key, waiters: []chan result{done}}
+		o.edits[key] = j
+		o.push(j)
+	}
+	o.mu.Unlock()
+	o.signal()
+
+	return (<-done).err
+}
+
+// Pending returns the number of queued requests
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.queue)
+}
+
+func (o *Outbox) push(j *job) {
+	o.seq++
+	j.seq = o.seq
+	o.queue = append(o.queue, j)
+	o.sort()
+}
+
+func (o *Outbox) sort() {
+	sort.SliceStable(o.queue, func(i, k int) bool {
+		if o.queue[i].priority != o.queue[k].priority {
+			return o.queue[i].priority > o.queue[k].priority
+		}
+		return o.queue[i].seq < o.queue[k].seq
+	})
+}
+
+func (o *Outbox) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox) run() {
+	for {
+		o.mu.Lock()
+		j, wait := o.next()
+		o.mu.Unlock()
+
+		if j != nil {
+			go o.deliver(j)
+			continue
+		}
+
+		var timer <-chan time.Time
+		if wait > 0 {
+			timer = time.After(wait)
+		}
+		select {
+		case <-o.wake:
+		case <-timer:
+		case <-o.stop:
+			return
+		}
+	}
+}
+
+// next takes the first request whose chat is free and within limits.
+// when nothing can go yet it returns how long to wait, zero meaning until something is queued
+func (o *Outbox) next() (*job, time.Duration) {
+	now := o.now()
+	if len(o.queue) == 0 {
+		o.pruneChats(now)
+		return nil, 0
+	}
+
+	if now.Before(o.globalBlocked) {
+		return nil, o.globalBlocked.Sub(now)
+	}
+	if wait := o.global.wait(now); wait > 0 {
+		return nil, wait
+	}
+
+	var minWait time.Duration
+	for i, j := range o.queue {
+		chat := o.chat(j.chatID, now)
+		if chat.busy {
+			continue
+		}
+
+		wait := chat.bucket.wait(now)
+		if now.Before(chat.blockedUntil) {
+			wait = chat.blockedUntil.Sub(now)
+		}
+		if wait > 0 {
+			if minWait == 0 || wait < minWait {
+				minWait = wait
+			}
+			continue
+		}
+
+		o.global.take()
+		chat.bucket.take()
+		chat.busy = true
+		o.queue = append(o.queue[:i], o.queue[i+1:]...)
+		if j.editKey != "" && o.edits[j.editKey] == j {
+			delete(o.edits, j.editKey)
+		}
+		return j, 0
+	}
+
+	return nil, minWait
+}
+
+func (o *Outbox) deliver(j *job) {
+	message, err := j.send()
+
+	o.mu.Lock()
+	now := o.now()
+	chat := o.chat(j.chatID, now)
+	chat.busy = false
+
+	if retryAfter := RetryAfter(err); retryAfter > 0 && j.attempts < o.config.MaxRetries && !o.stopped {
+		j.attempts++
+		chat.blockedUntil = now.Add(retryAfter)
+		// flood control for the whole bot is reported the same way, so slow down everything a little
+		if o.globalBlocked.Before(now.Add(time.Second)) {
+			o.globalBlocked = now.Add(time.Second)
+		}
+		log.Printf("telegram asked to retry chat %d after %s (attempt %d)", j.chatID, retryAfter, j.attempts)
+
+		if newer, ok := o.edits[j.editKey]; ok && j.editKey != "" {
+			// a newer edit of the same message is queued, it already has the latest text
+			newer.waiters = append(newer.waiters, j.waiters...)
+		} else {
+			if j.editKey != "" {
+				o.edits[j.editKey] = j
+			}
+			o.queue = append(o.queue, j)
+			o.sort()
+		}
+		o.mu.Unlock()
+		o.signal()
+		return
+	}
+	o.mu.Unlock()
+	o.signal()
+
+	j.resolve(result{message: message, err: err})
+}
+
+func (o *Outbox) chat(chatID int64, now time.Time) *chatState {
+	chat, ok := o.chats[chatID]
+	if !ok {
+		perSecond, burst := o.config.PrivatePerSecond, o.config.PrivateBurst
+		if chatID < 0 {
+			perSecond, burst = o.config.GroupPerMinute/60, o.config.GroupPerMinute
+		}
+		chat = &chatState{bucket: newBucket(perSecond, burst, now)}
+		o.chats[chatID] = chat
+	}
+	return chat
+}
+
+// pruneChats forgets chats that are idle with a full bucket, they would start the same way again
+func (o *Outbox) pruneChats(now time.Time) {
+	for chatID, chat := range o.chats {
+		if !chat.busy && !now.Before(chat.blockedUntil) && chat.bucket.full(now) {
+			delete(o.chats, chatID)
+		}
+	}
+}
+
+func (j *job) resolve(r result) {
+	for _, waiter := range j.waiters {
+		waiter <- r
+	}
+}
+
+// RetryAfter extracts the delay telegram asks for in a 429 response
+func RetryAfter(err error) time.Duration {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == 429 && apiErr.RetryAfter > 0 {
+		return time.Duration(apiErr.RetryAfter) * time.Second
+	}
+	return 0
+}
+
+// bucket is a token bucket refilled continuously
+type bucket struct {
+	perSecond float64
+	capacity  float64
+	tokens    float64
+	last      time.Time
+}
+
+func newBucket(perSecond, capacity float64, now time.Time) *bucket {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &bucket{perSecond: perSecond, capacity: capacity, tokens: capacity, last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.perSecond
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+		b.last = now
+	}
+}
+
+// wait returns how long until a token is available
+func (b *bucket) wait(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	if b.perSecond <= 0 {
+		return time.Second
+	}
+	return time.Duration((1 - b.tokens) / b.perSecond * float64(time.Second))
+}
+
+func (b *bucket) take() {
+	b.tokens--
+}
+
+func (b *bucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.capacity
+}
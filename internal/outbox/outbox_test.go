@@ -0,0 +1,158 @@
+package outbox
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func fastConfig() Config {
+	return Config{
+		GlobalPerSecond:  1000,
+		GroupPerMinute:   60000,
+		PrivatePerSecond: 1000,
+		PrivateBurst:     1000,
+		MaxRetries:       3,
+	}
+}
+
+// waitPending blocks until the outbox has the expected number of queued requests
+func waitPending(t *testing.T, o *Outbox, expected int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for o.Pending() != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d pending requests, got %d", expected, o.Pending())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestInteractiveGoesBeforeBulk(t *testing.T) {
+	o := New(fastConfig())
+	defer o.Stop()
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) SendFunc {
+		return func() (tgbotapi.Message, error) {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return tgbotapi.Message{}, nil
+		}
+	}
+
+	// the first request keeps the chat busy while the others queue up
+	go o.Send(1, PriorityNormal, func() (tgbotapi.Message, error) {
+		<-release
+		return tgbotapi.Message{}, nil
+	})
+	waitPending(t, o, 0)
+	time.Sleep(10 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); o.Send(1, PriorityBulk, record("bulk")) }()
+	waitPending(t, o, 1)
+	go func() { defer wg.Done(); o.Send(1, PriorityInteractive, record("reply")) }()
+	waitPending(t, o, 2)
+
+	close(release)
+	wg.Wait()
+
+	if len(order) != 2 || order[0] != "reply" || order[1] != "bulk" {
+		t.Errorf("expected reply before bulk, got %v", order)
+	}
+}
+
+func TestEditsToSameMessageAreCoalesced(t *testing.T) {
+	o := New(fastConfig())
+	defer o.Stop()
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var sent []string
+	edit := func(text string) SendFunc {
+		return func() (tgbotapi.Message, error) {
+			mu.Lock()
+			sent = append(sent, text)
+			mu.Unlock()
+			return tgbotapi.Message{}, nil
+		}
+	}
+
+	go o.Edit(-100, 7, PriorityNormal, func() (tgbotapi.Message, error) {
+		<-release
+		mu.Lock()
+		sent = append(sent, "first")
+		mu.Unlock()
+		return tgbotapi.Message{}, nil
+	})
+	time.Sleep(10 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	for _, text := range []string{"second", "third", "fourth"} {
+		wg.Add(1)
+		go func(text string) {
+			defer wg.Done()
+			if err := o.Edit(-100, 7, PriorityNormal, edit(text)); err != nil {
+				t.Errorf("edit failed: %v", err)
+			}
+		}(text)
+		waitPending(t, o, 1)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(release)
+	wg.Wait()
+
+	if len(sent) != 2 || sent[0] != "first" || sent[1] != "fourth" {
+		t.Errorf("expected only the first and the latest edit to be sent, got %v", sent)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	o := New(fastConfig())
+	defer o.Stop()
+
+	attempts := 0
+	start := time.Now()
+	_, err := o.Send(1, PriorityInteractive, func() (tgbotapi.Message, error) {
+		attempts++
+		if attempts == 1 {
+			return tgbotapi.Message{}, &tgbotapi.Error{Code: 429, Message: "Too Many Requests", ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 1}}
+		}
+		return tgbotapi.Message{MessageID: 42}, nil
+	})
+	if err != nil {
+		t.Fatalf("expected retry to succeed, got %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d", attempts)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("expected to wait for retry_after, waited %s", elapsed)
+	}
+}
+
+func TestGroupLimit(t *testing.T) {
+	config := fastConfig()
+	config.GroupPerMinute = 120 // two per second after a burst of 120
+	o := New(config)
+	defer o.Stop()
+
+	now := time.Now()
+	o.mu.Lock()
+	chat := o.chat(-1, now)
+	chat.bucket.tokens = 0
+	wait := chat.bucket.wait(now)
+	o.mu.Unlock()
+
+	if wait < 400*time.Millisecond || wait > 600*time.Millisecond {
+		t.Errorf("expected about half a second until the next group message, got %s", wait)
+	}
+}
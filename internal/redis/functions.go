@@ -3,6 +3,8 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"time"
 
 	redisClient "github.com/go-redis/redis/v8"
 	"github.com/sukalov/mshkbot/internal/types"
@@ -53,3 +55,96 @@ func GetMetadata(ctx context.Context) (types.TournamentMetadata, error) {
 	}
 	return metadata, nil
 }
+
+// SetLastEligibility keeps the latest check-in eligibility snapshot of a user for a week
+func SetLastEligibility(ctx context.Context, userID int64, snapshot types.Eligibility) error {
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return Client.Set(ctx, fmt.Sprintf("eligibility:%d", userID), snapshotJSON, 7*24*time.Hour).Err()
+}
+
+func GetLastEligibility(ctx context.Context, userID int64) (*types.Eligibility, error) {
+	data, err := Client.Get(ctx, fmt.Sprintf("eligibility:%d", userID)).Bytes()
+	if err != nil {
+		if err == redisClient.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var snapshot types.Eligibility
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// SetPendingCheckin remembers the tournament a user wanted to join before registering
+func SetPendingCheckin(ctx context.Context, userID int64, tournamentID string, ttl time.Duration) error {
+	return Client.Set(ctx, fmt.Sprintf("pending_checkin:%d", userID), tournamentID, ttl).Err()
+}
+
+// TakePendingCheckin returns and forgets the tournament a user wanted to join, empty if none
+func TakePendingCheckin(ctx context.Context, userID int64) (string, error) {
+	tournamentID, err := Client.GetDel(ctx, fmt.Sprintf("pending_checkin:%d", userID)).Result()
+	if err != nil {
+		if err == redisClient.Nil {
+			return "", nil
+		}
+		return "", err
+	}
+	return tournamentID, nil
+}
+
+// SetPlannedTournament stores the tournament to open later, there is at most one
+func SetPlannedTournament(ctx context.Context, planned types.PlannedTournament) error {
+	plannedJSON, err := json.Marshal(planned)
+	if err != nil {
+		return err
+	}
+	return Client.Set(ctx, "planned_tournament", plannedJSON, 0).Err()
+}
+
+// GetPlannedTournament returns the tournament to open later, nil if none
+func GetPlannedTournament(ctx context.Context) (*types.PlannedTournament, error) {
+	data, err := Client.Get(ctx, "planned_tournament").Bytes()
+	if err != nil {
+		if err == redisClient.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var planned types.PlannedTournament
+	if err := json.Unmarshal(data, &planned); err != nil {
+		return nil, err
+	}
+	return &planned, nil
+}
+
+func ClearPlannedTournament(ctx context.Context) error {
+	return Client.Del(ctx, "planned_tournament").Err()
+}
+
+// KeyValue is plain key access for packages that keep their own data here, such as conversations
+type KeyValue struct{}
+
+func (KeyValue) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := Client.Get(ctx, key).Bytes()
+	if err != nil {
+		if err == redisClient.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (KeyValue) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return Client.Set(ctx, key, value, ttl).Err()
+}
+
+func (KeyValue) Del(ctx context.Context, key string) (bool, error) {
+	deleted, err := Client.Del(ctx, key).Result()
+	return deleted > 0, err
+}
@@ -0,0 +1,148 @@
+package render
+
+import (
+	"fmt"
+
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// AdminListTemplates lay out the tournament list for the admin group
+var AdminListTemplates = map[Mode]string{
+	HTML: `{{define "line"}}{{.Number}}. {{if .CheckinURL}}{{link .CheckinURL .Name}}{{else}}{{.Name}}{{end}}{{if .Username}} (@{{.Username}}){{end}}{{if .Guest}} (гость){{end}}{{if .Unverified}} ⚠️ без проверки{{end}}{{range .Ratings}} ({{if .URL}}{{link .URL .Site}}{{else}}{{.Site}}{{end}} {{.Value}}){{end}}{{end}}участники:
+{{range .Players}}{{template "line" .}}
+{{else}}пока никого нет
+{{end}}{{if .Queue}}
+очередь:
+{{range .Queue}}{{template "line" .}}
+{{end}}{{end}}{{if .Pending}}
+ждут проверки рейтинга:
+{{range .Pending}}{{template "line" .}}
+{{end}}{{end}}`,
+	MarkdownV2: `{{define "line"}}{{.Number}}\. {{if .CheckinURL}}{{link .CheckinURL .Name}}{{else}}{{.Name}}{{end}}{{if .Username}} \(@{{.Username}}\){{end}}{{if .Guest}} \(гость\){{end}}{{if .Unverified}} ⚠️ без проверки{{end}}{{range .Ratings}} \({{if .URL}}{{link .URL .Site}}{{else}}{{.Site}}{{end}} {{.Value}}\){{end}}{{end}}участники:
+{{range .Players}}{{template "line" .}}
+{{else}}пока никого нет
+{{end}}{{if .Queue}}
+очередь:
+{{range .Queue}}{{template "line" .}}
+{{end}}{{end}}{{if .Pending}}
+ждут проверки рейтинга:
+{{range .Pending}}{{template "line" .}}
+{{end}}{{end}}`,
+}
+
+// AdminRating is a rating shown next to a player, with a link to the profile when there is one
+type AdminRating struct {
+	Site  string
+	URL   string
+	Value string
+}
+
+// AdminLine is one player in the admin list. text is escaped, urls are escaped by link
+type AdminLine struct {
+	Number     int
+	Name       string
+	Username   string
+	CheckinURL string
+	Guest      bool
+	Unverified bool
+	Ratings    []AdminRating
+}
+
+// AdminList is what the admin list template is executed with
+type AdminList struct {
+	Players []AdminLine
+	Queue   []AdminLine
+	Pending []AdminLine
+}
+
+// NewAdminList collects the admin view of the tournament list
+func NewAdminList(mode Mode, list []types.Player) AdminList {
+	var l AdminList
+	for _, player := range list {
+		switch player.State {
+		case types.StateInTournament:
+			l.Players = append(l.Players, adminLine(mode, len(l.Players)+1, player))
+		case types.StateQueued:
+			l.Queue = append(l.Queue, adminLine(mode, len(l.Queue)+1, player))
+		case types.StatePending:
+			l.Pending = append(l.Pending, adminLine(mode, len(l.Pending)+1, player))
+		}
+	}
+	return l
+}
+
+// RenderAdminList renders the tournament list for the admin group
+func RenderAdminList(mode Mode, list []types.Player) (string, error) {
+	tmpl, err := Parse(mode, "admin_list", AdminListTemplates[mode])
+	if err != nil {
+		return "", err
+	}
+	return execute(tmpl, NewAdminList(mode, list))
+}
+
+func adminLine(mode Mode, num int, player types.Player) AdminLine {
+	line := AdminLine{
+		Number:     num,
+		Name:       Escape(mode, player.SavedName),
+		Username:   Escape(mode, player.Username),
+		Guest:      player.IsGuest(),
+		Unverified: player.Unverified,
+	}
+
+	if player.CheckinMessageID != 0 && player.CheckinChatID != 0 {
+		chatIDForLink := player.CheckinChatID
+		if chatIDForLink < 0 {
+			chatIDForLink = -chatIDForLink - 1000000000000
+		}
+		line.CheckinURL = fmt.Sprintf("https://t.me/c/%d/%d", chatIDForLink, player.CheckinMessageID)
+	}
+
+	rating := func(site, url, value string) AdminRating {
+		return AdminRating{Site: Escape(mode, site), URL: url, Value: Escape(mode, value)}
+	}
+
+	if player.Eligibility != nil {
+		for _, check := range player.Eligibility.Sites {
+			switch {
+			case check.Error != "":
+				line.Ratings = append(line.Ratings, rating(check.Site, "", "?"))
+			case check.Site == types.SiteLichess || check.Site == types.SiteChesscom:
+				line.Ratings = append(line.Ratings, rating(check.Site, profileURL(check.Site, check.Username), fmt.Sprintf("%d", check.Blitz)))
+			default:
+				line.Ratings = append(line.Ratings, rating(check.Site, "", fmt.Sprintf("%d/%d", check.Classical, check.Blitz)))
+			}
+		}
+		return line
+	}
+
+	// guest ratings are typed in by admins, there is no profile to link
+	if player.PeakRating != nil {
+		if url := profileURL(player.PeakRating.Site, player.PeakRating.SiteUsername); url != "" {
+			line.Ratings = append(line.Ratings, rating(player.PeakRating.Site, url, fmt.Sprintf("%d", player.PeakRating.BlitzPeak)))
+		} else if player.IsGuest() {
+			line.Ratings = append(line.Ratings, rating(player.PeakRating.Site, "", fmt.Sprintf("%d", player.PeakRating.BlitzPeak)))
+		}
+	}
+	if player.OTBRating != nil {
+		value := fmt.Sprintf("%d/%d", player.OTBRating.Standard, player.OTBRating.Blitz)
+		if player.IsGuest() {
+			value = fmt.Sprintf("%d", player.OTBRating.Standard)
+		}
+		line.Ratings = append(line.Ratings, rating(player.OTBRating.Source, "", value))
+	}
+
+	return line
+}
+
+func profileURL(site, username string) string {
+	if username == "" {
+		return ""
+	}
+	switch site {
+	case types.SiteLichess:
+		return fmt.Sprintf("https://lichess.org/@/%s", username)
+	case types.SiteChesscom:
+		return fmt.Sprintf("https://www.chess.com/member/%s", username)
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package render
+
+import (
+	"fmt"
+
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// DefaultAnnouncementTemplates are used for events without a template of their own
+var DefaultAnnouncementTemplates = map[Mode]string{
+	HTML: `{{.Intro}}
+
+участники:
+{{range .Players}}{{.Number}}. {{.Name}}
+{{else}}пока никого нет
+{{end}}{{if .Free}}
+свободно {{.Free}} {{plural .Free "место" "места" "мест"}}
+{{end}}{{if .Queue}}
+очередь:
+{{range .Queue}}{{.Number}}. {{.Name}} ♘
+{{end}}{{end}}`,
+	MarkdownV2: `{{.Intro}}
+
+участники:
+{{range .Players}}{{.Number}}\. {{.Name}}
+{{else}}пока никого нет
+{{end}}{{if .Free}}
+свободно {{.Free}} {{plural .Free "место" "места" "мест"}}
+{{end}}{{if .Queue}}
+очередь:
+{{range .Queue}}{{.Number}}\. {{.Name}} ♘
+{{end}}{{end}}`,
+}
+
+// AnnouncementLine is one player in the public list
+type AnnouncementLine struct {
+	Number   int
+	Name     string
+	Username string
+}
+
+// Announcement is what announcement templates are executed with. all text is already escaped
+type Announcement struct {
+	Intro   string
+	Limit   int
+	Free    int
+	Players []AnnouncementLine
+	Queue   []AnnouncementLine
+}
+
+// NewAnnouncement collects the public view of the tournament list
+func NewAnnouncement(mode Mode, intro string, limit int, list []types.Player) Announcement {
+	a := Announcement{Intro: Escape(mode, intro), Limit: limit}
+	for _, player := range list {
+		line := AnnouncementLine{Name: Escape(mode, player.SavedName), Username: Escape(mode, player.Username)}
+		switch player.State {
+		case types.StateInTournament:
+			line.Number = len(a.Players) + 1
+			a.Players = append(a.Players, line)
+		case types.StateQueued:
+			line.Number = len(a.Queue) + 1
+			a.Queue = append(a.Queue, line)
+		}
+	}
+	if limit > len(a.Players) {
+		a.Free = limit - len(a.Players)
+	}
+	return a
+}
+
+// RenderAnnouncement executes an announcement template, the default one when text is empty
+func RenderAnnouncement(mode Mode, text string, data Announcement) (string, error) {
+	if text == "" {
+		text = DefaultAnnouncementTemplates[mode]
+	}
+	tmpl, err := Parse(mode, "announcement", text)
+	if err != nil {
+		return "", err
+	}
+	return execute(tmpl, data)
+}
+
+// ValidateAnnouncement checks that an admin-written template parses and renders for a sample list
+// into a message telegram accepts
+func ValidateAnnouncement(mode Mode, text string) error {
+	sample := NewAnnouncement(mode, "турнир", 2, []types.Player{
+		{SavedName: "Игрок Один", Username: "one", State: types.StateInTournament},
+		{SavedName: "Игрок Два", Username: "two", State: types.StateInTournament},
+		{SavedName: "Игрок Три", Username: "three", State: types.StateQueued},
+	})
+	rendered, err := RenderAnnouncement(mode, text, sample)
+	if err != nil {
+		return err
+	}
+	if rendered == "" {
+		return fmt.Errorf("template renders an empty message")
+	}
+	if mode == HTML {
+		if err := CheckHTML(rendered); err != nil {
+			return fmt.Errorf("telegram would not accept the message: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+)
+
+// htmlTags are the tags telegram accepts in HTML messages
+var htmlTags = map[string]bool{
+	"b": true, "strong": true, "i": true, "em": true, "u": true, "ins": true,
+	"s": true, "strike": true, "del": true, "a": true, "code": true, "pre": true,
+	"span": true, "tg-spoiler": true, "tg-emoji": true, "blockquote": true,
+}
+
+// htmlEntities are the named entities telegram accepts, numeric ones are accepted too
+var htmlEntities = map[string]bool{"lt": true, "gt": true, "amp": true, "quot": true}
+
+// CheckHTML tells whether telegram would accept the text with the HTML parse mode:
+// only supported tags, every tag closed in order, no bare < > or & outside tags and entities
+func CheckHTML(text string) error {
+	var open []string
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '>':
+			return fmt.Errorf("unescaped > at position %d", i)
+		case '&':
+			end := strings.IndexByte(text[i:], ';')
+			if end < 0 || !validEntity(text[i+1:i+end]) {
+				return fmt.Errorf("unescaped & at position %d", i)
+			}
+			i += end
+		case '<':
+			end := strings.IndexByte(text[i:], '>')
+			if end < 0 {
+				return fmt.Errorf("unclosed tag at position %d", i)
+			}
+			tag := text[i+1 : i+end]
+			i += end
+
+			if name, ok := strings.CutPrefix(tag, "/"); ok {
+				name = strings.ToLower(strings.TrimSpace(name))
+				if len(open) == 0 || open[len(open)-1] != name {
+					return fmt.Errorf("unexpected closing tag </%s>", name)
+				}
+				open = open[:len(open)-1]
+				continue
+			}
+
+			fields := strings.Fields(tag)
+			if len(fields) == 0 {
+				return fmt.Errorf("empty tag at position %d", i-end)
+			}
+			name := strings.ToLower(fields[0])
+			if !htmlTags[name] {
+				return fmt.Errorf("unsupported tag <%s>", name)
+			}
+			if name == "span" && !strings.Contains(tag, `class="tg-spoiler"`) {
+				return fmt.Errorf(`<span> needs class="tg-spoiler"`)
+			}
+			open = append(open, name)
+		}
+	}
+	if len(open) > 0 {
+		return fmt.Errorf("tag <%s> is not closed", open[len(open)-1])
+	}
+	return nil
+}
+
+func validEntity(name string) bool {
+	if htmlEntities[name] {
+		return true
+	}
+	digits, ok := strings.CutPrefix(name, "#")
+	if !ok || digits == "" {
+		return false
+	}
+	if hex, ok := strings.CutPrefix(strings.ToLower(digits), "x"); ok {
+		return hex != "" && strings.Trim(hex, "0123456789abcdef") == ""
+	}
+	return strings.Trim(digits, "0123456789") == ""
+}
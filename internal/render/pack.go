@@ -0,0 +1,73 @@
+package render
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// MaxMessageLength is the most characters telegram takes in one message, counted in UTF-16 code units
+// the way telegram counts them, so an emoji outside the basic plane takes two
+const MaxMessageLength = 4096
+
+// Length is the length of the text as telegram counts it
+func Length(text string) int {
+	n := 0
+	for _, r := range text {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// Pack joins blocks with blank lines into as few messages of at most limit characters as it can.
+// a block longer than the limit is split between its lines and a line longer than the limit is cut
+func Pack(blocks []string, limit int) []string {
+	var messages []string
+	current := ""
+	add := func(part, separator string) {
+		if current != "" && Length(current)+Length(separator)+Length(part) > limit {
+			messages = append(messages, current)
+			current = ""
+		}
+		if current == "" {
+			current = part
+			return
+		}
+		current += separator + part
+	}
+
+	for _, block := range blocks {
+		if Length(block) <= limit {
+			add(block, "\n\n")
+			continue
+		}
+		for i, line := range strings.Split(block, "\n") {
+			separator := "\n"
+			if i == 0 {
+				separator = "\n\n"
+			}
+			for _, piece := range cut(line, limit) {
+				add(piece, separator)
+				separator = "\n"
+			}
+		}
+	}
+	if current != "" {
+		messages = append(messages, current)
+	}
+	return messages
+}
+
+// cut splits a line into pieces of at most limit characters without breaking a character
+func cut(line string, limit int) []string {
+	var pieces []string
+	start, n := 0, 0
+	for i, r := range line {
+		size := utf16.RuneLen(r)
+		if n+size > limit {
+			pieces = append(pieces, line[start:i])
+			start, n = i, 0
+		}
+		n += size
+	}
+	return append(pieces, line[start:])
+}
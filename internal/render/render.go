@@ -0,0 +1,109 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	"text/template"
+
+	"github.com/sukalov/mshkbot/internal/i18n"
+)
+
+// Mode is a telegram parse mode. text put into templates is escaped for it,
+// the template itself is markup and is sent as written
+type Mode string
+
+const (
+	HTML       Mode = "HTML"
+	MarkdownV2 Mode = "MarkdownV2"
+)
+
+// markdownV2Special are the characters telegram wants escaped anywhere in MarkdownV2 text
+const markdownV2Special = "_*[]()~`>#+-=|{}.!\\"
+
+// Escape makes s safe to put into a message with the given parse mode
+func Escape(mode Mode, s string) string {
+	switch mode {
+	case HTML:
+		return html.EscapeString(s)
+	case MarkdownV2:
+		var sb strings.Builder
+		for _, r := range s {
+			if strings.ContainsRune(markdownV2Special, r) {
+				sb.WriteByte('\\')
+			}
+			sb.WriteRune(r)
+		}
+		return sb.String()
+	default:
+		return s
+	}
+}
+
+// escapeURL escapes a link target, which has its own rules in MarkdownV2
+func escapeURL(mode Mode, url string) string {
+	switch mode {
+	case HTML:
+		return html.EscapeString(url)
+	case MarkdownV2:
+		return strings.NewReplacer(`\`, `\\`, `)`, `\)`).Replace(url)
+	default:
+		return url
+	}
+}
+
+// funcs are available in every template. their text arguments are expected to be escaped already
+func funcs(mode Mode) template.FuncMap {
+	return template.FuncMap{
+		"link": func(url, text string) string {
+			if mode == MarkdownV2 {
+				return fmt.Sprintf("[%s](%s)", text, escapeURL(mode, url))
+			}
+			return fmt.Sprintf(`<a href="%s">%s</a>`, escapeURL(mode, url), text)
+		},
+		"bold": func(text string) string {
+			if mode == MarkdownV2 {
+				return "*" + text + "*"
+			}
+			return "<b>" + text + "</b>"
+		},
+		"italic": func(text string) string {
+			if mode == MarkdownV2 {
+				return "_" + text + "_"
+			}
+			return "<i>" + text + "</i>"
+		},
+		"escape": func(text string) string {
+			return Escape(mode, text)
+		},
+		// plural picks the russian form for n: {{plural .Free "место" "места" "мест"}}
+		"plural": func(n int, one, few, many string) string {
+			switch i18n.Plural(i18n.RU, n) {
+			case "one":
+				return one
+			case "few":
+				return few
+			default:
+				return many
+			}
+		},
+	}
+}
+
+// Parse compiles a template for the given mode
+func Parse(mode Mode, name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(funcs(mode)).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return tmpl, nil
+}
+
+func execute(tmpl *template.Template, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,233 @@
+package render
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// checkGolden compares output with testdata/<name>.golden
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs from golden file\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+	}
+}
+
+func samplePlayers() []types.Player {
+	return []types.Player{
+		{
+			ID: 1, SavedName: "Иван *Петров*", Username: "ivan_petrov", State: types.StateInTournament,
+			CheckinMessageID: 42, CheckinChatID: -1001234567890,
+			Eligibility: &types.Eligibility{Sites: []types.SiteCheck{
+				{Site: types.SiteLichess, Username: "ivan_the_great", Blitz: 1850},
+				{Site: types.SiteChesscom, Username: "ivan_pe", Error: "timeout"},
+			}},
+		},
+		{
+			ID: 2, SavedName: "Anna <Smith> & co", Username: "anna", State: types.StateInTournament,
+			PeakRating: &types.PeakRating{Site: types.SiteChesscom, BlitzPeak: 1500, SiteUsername: "anna_(x)"},
+			OTBRating:  &types.OTBRating{Source: types.SiteFide, Standard: 1700, Blitz: 1650},
+			Unverified: true,
+		},
+		{ID: 3, SavedName: "Пётр [1.e4]", State: types.StateQueued},
+		{ID: 4, SavedName: "Вышедший", State: types.StateCheckedOut, CheckedOutTime: time.Unix(0, 0)},
+		{ID: 5, SavedName: "Ждущий", Username: "wait_er", State: types.StatePending},
+		{
+			ID: -1, SavedName: "Гость Гостев", State: types.StateQueued,
+			PeakRating: &types.PeakRating{Site: types.SiteLichess, BlitzPeak: 1900},
+			OTBRating:  &types.OTBRating{Source: types.SiteRcf, Standard: 1600},
+		},
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		mode Mode
+		in   string
+		want string
+	}{
+		{HTML, `a <b> & "c"`, `a &lt;b&gt; &amp; &#34;c&#34;`},
+		{MarkdownV2, `snake_case *bold* 1.e4!`, `snake\_case \*bold\* 1\.e4\!`},
+		{MarkdownV2, `back\slash`, `back\\slash`},
+	}
+	for _, tt := range tests {
+		if got := Escape(tt.mode, tt.in); got != tt.want {
+			t.Errorf("Escape(%s, %q) = %q, want %q", tt.mode, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultAnnouncement(t *testing.T) {
+	for _, tc := range []struct {
+		mode Mode
+		name string
+	}{
+		{HTML, "announcement.html"},
+		{MarkdownV2, "announcement.md"},
+	} {
+		got, err := RenderAnnouncement(tc.mode, "", NewAnnouncement(tc.mode, "ТУРНИР НАЧАЛСЯ!!! (в 19:00)", 26, samplePlayers()))
+		if err != nil {
+			t.Fatalf("failed to render %s: %v", tc.name, err)
+		}
+		checkGolden(t, tc.name, got)
+	}
+}
+
+func TestEmptyAnnouncement(t *testing.T) {
+	got, err := RenderAnnouncement(HTML, "", NewAnnouncement(HTML, "запись открыта", 10, nil))
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	checkGolden(t, "announcement_empty.html", got)
+}
+
+func TestCustomAnnouncement(t *testing.T) {
+	custom := `{{bold .Intro}}
+свободно мест: {{.Free}} из {{.Limit}}
+{{range .Players}}{{.Number}}) {{.Name}}{{if .Username}} @{{.Username}}{{end}}
+{{end}}{{with .Queue}}в очереди {{len .}}{{end}}`
+
+	if err := ValidateAnnouncement(HTML, custom); err != nil {
+		t.Fatalf("expected custom template to be valid: %v", err)
+	}
+	got, err := RenderAnnouncement(HTML, custom, NewAnnouncement(HTML, "южный турнир", 26, samplePlayers()))
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+	checkGolden(t, "announcement_custom.html", got)
+}
+
+func TestPlural(t *testing.T) {
+	tmpl, err := Parse(HTML, "plural", `{{.}} {{plural . "место" "места" "мест"}}`)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	tests := map[int]string{
+		0: "0 мест", 1: "1 место", 2: "2 места", 4: "4 места", 5: "5 мест",
+		11: "11 мест", 14: "14 мест", 21: "21 место", 22: "22 места", 111: "111 мест",
+	}
+	for n, want := range tests {
+		got, err := execute(tmpl, n)
+		if err != nil {
+			t.Fatalf("failed to render %d: %v", n, err)
+		}
+		if got != want {
+			t.Errorf("plural %d = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestValidateAnnouncementRejectsBrokenTemplates(t *testing.T) {
+	for _, text := range []string{
+		"{{.Intro",
+		"{{.Missing}}",
+		"{{range .Players}}{{.Nmae}}{{end}}",
+		"{{/* nothing */}}",
+	} {
+		if err := ValidateAnnouncement(HTML, text); err == nil {
+			t.Errorf("expected %q to be rejected", text)
+		}
+	}
+}
+
+func TestAdminList(t *testing.T) {
+	for _, tc := range []struct {
+		mode Mode
+		name string
+	}{
+		{HTML, "admin_list.html"},
+		{MarkdownV2, "admin_list.md"},
+	} {
+		got, err := RenderAdminList(tc.mode, samplePlayers())
+		if err != nil {
+			t.Fatalf("failed to render %s: %v", tc.name, err)
+		}
+		checkGolden(t, tc.name, got)
+	}
+}
+
+func TestValidateAnnouncementRejectsBrokenHTML(t *testing.T) {
+	for _, text := range []string{
+		"<b>{{.Intro}}",
+		"<b><i>{{.Intro}}</b></i>",
+		"<h1>{{.Intro}}</h1>",
+		`<span>{{.Intro}}</span>`,
+		"{{.Intro}} <3",
+		"{{.Intro}} & co",
+	} {
+		if err := ValidateAnnouncement(HTML, text); err == nil {
+			t.Errorf("expected %q to be rejected", text)
+		}
+	}
+}
+
+func TestCheckHTML(t *testing.T) {
+	for _, text := range []string{
+		`<b>жирный</b> <i>курсив</i> <a href="https://t.me/x?a=1&amp;b=2">ссылка</a>`,
+		`<span class="tg-spoiler">спойлер</span> <tg-spoiler>ещё</tg-spoiler>`,
+		`<pre><code class="language-go">a &lt; b &#62; c &#x26;</code></pre>`,
+		`<blockquote expandable>цитата</blockquote>`,
+	} {
+		if err := CheckHTML(text); err != nil {
+			t.Errorf("CheckHTML(%q) = %v, want nil", text, err)
+		}
+	}
+}
+
+func TestLength(t *testing.T) {
+	tests := map[string]int{"": 0, "abc": 3, "шахматы": 7, "♟": 1, "🏆": 2, "ok 👍🏻": 7}
+	for text, want := range tests {
+		if got := Length(text); got != want {
+			t.Errorf("Length(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
+
+func TestPack(t *testing.T) {
+	tests := []struct {
+		name   string
+		blocks []string
+		limit  int
+		want   []string
+	}{
+		{"fits together", []string{"aaa", "bbb"}, 8, []string{"aaa\n\nbbb"}},
+		{"next block does not fit", []string{"aaa", "bbb"}, 7, []string{"aaa", "bbb"}},
+		{"emoji count twice", []string{"🏆🏆", "bb"}, 7, []string{"🏆🏆", "bb"}},
+		{"block longer than the limit", []string{"head", "line1\nline2\nline3"}, 12, []string{"head\n\nline1", "line2\nline3"}},
+		{"line longer than the limit", []string{"abcdefgh"}, 3, []string{"abc", "def", "gh"}},
+		{"emoji is not cut in half", []string{"a🏆b"}, 2, []string{"a", "🏆", "b"}},
+		{"nothing", nil, 10, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Pack(tt.blocks, tt.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Pack = %q, want %q", got, tt.want)
+			}
+			for _, message := range got {
+				if Length(message) > tt.limit {
+					t.Errorf("message %q is %d long, over the limit of %d", message, Length(message), tt.limit)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// Summary sums up one archived tournament for the admin reports
+type Summary struct {
+	Metadata types.TournamentMetadata
+	// Entries counts check-ins, players who checked out later included
+	Entries int
+	Seated  int
+	// Queue is the queue at the end, Waited everyone who waited in it at some point
+	Queue     int
+	Waited    int
+	CheckOuts int
+	// TimeToFull is from opening registration to the last place taken, zero when the tournament never filled
+	TimeToFull time.Duration
+}
+
+// Summarize computes the report numbers of an archived tournament
+func Summarize(tournament Tournament) Summary {
+	summary := Summary{Metadata: tournament.Metadata}
+
+	left := 0
+	for _, player := range tournament.Players {
+		if player.Queued {
+			summary.Waited++
+		}
+		switch player.State {
+		case types.StateCheckedOut:
+			left++
+			continue
+		case types.StateInTournament:
+			summary.Seated++
+		case types.StateQueued:
+			summary.Queue++
+		}
+		summary.Entries++
+	}
+
+	// tournaments archived before check-outs were counted only know the players still in the list
+	summary.CheckOuts = max(tournament.Metadata.CheckOuts, left)
+	summary.Entries += summary.CheckOuts
+
+	if full := tournament.Metadata.FullAt; full != nil && !tournament.Metadata.OpenedAt.IsZero() {
+		summary.TimeToFull = full.Sub(tournament.Metadata.OpenedAt)
+	}
+	return summary
+}
+
+// FillRate is the share of places taken, 0 for tournaments without a limit
+func (s Summary) FillRate() float64 {
+	if s.Metadata.Limit == 0 {
+		return 0
+	}
+	return float64(s.Seated) / float64(s.Metadata.Limit)
+}
+
+// CheckOutRate is the share of entries that checked out
+func (s Summary) CheckOutRate() float64 {
+	if s.Entries == 0 {
+		return 0
+	}
+	return float64(s.CheckOuts) / float64(s.Entries)
+}
+
+// ParseDay reads dd.mm or dd.mm.yyyy as the start of that day in the location of now, the year
+// defaults to the current one
+func ParseDay(text string, now time.Time) (time.Time, bool) {
+	if t, err := time.ParseInLocation("02.01.2006", text, now.Location()); err == nil {
+		return t, true
+	}
+	// parsed together with the year so 29.02 is checked against it instead of rolling over to 01.03
+	t, err := time.ParseInLocation("02.01.2006", fmt.Sprintf("%s.%d", text, now.Year()), now.Location())
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,147 @@
+// Package stats computes player statistics from archived tournaments. the archive is the only
+// source, counters kept on the user change with every check-in and check-out
+package stats
+
+import (
+	"sort"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// Tournament is an archived tournament with its final list
+type Tournament struct {
+	Metadata types.TournamentMetadata
+	Players  []types.Player
+}
+
+// what a player's entry into a tournament ended with
+const (
+	OutcomePlayed   = "played"
+	OutcomeWaited   = "waited"
+	OutcomeWithdrew = "withdrew"
+	OutcomeNoShow   = "no_show"
+)
+
+// Entry is one tournament of a player's history
+type Entry struct {
+	Date    time.Time
+	Outcome string
+}
+
+// Player sums up a player's archived tournaments
+type Player struct {
+	Entered     int
+	Played      int
+	Queued      int
+	Promoted    int
+	Withdrawals int
+	NoShows     int
+
+	// FavouriteDay is the weekday of most entries, valid when Entered > 0
+	FavouriteDay time.Weekday
+
+	// streaks count tournaments played in a row, any tournament without the player breaks them
+	CurrentStreak int
+	LongestStreak int
+
+	// History lists the entries, newest first
+	History []Entry
+}
+
+// ForPlayer computes the statistics of a player. tournaments may come in any order,
+// weekdays are taken in the given location
+func ForPlayer(playerID int, tournaments []Tournament, location *time.Location) Player {
+	sorted := append([]Tournament{}, tournaments...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Metadata.OpenedAt.Before(sorted[j].Metadata.OpenedAt)
+	})
+
+	var stats Player
+	days := make(map[time.Weekday]int)
+	streak := 0
+
+	for _, tournament := range sorted {
+		player, ok := find(tournament.Players, playerID)
+		if !ok {
+			streak = 0
+			continue
+		}
+
+		outcome := Outcome(player)
+		if outcome == "" {
+			streak = 0
+			continue
+		}
+
+		stats.Entered++
+		if player.Queued {
+			stats.Queued++
+		}
+		if player.Promoted {
+			stats.Promoted++
+		}
+
+		switch outcome {
+		case OutcomePlayed:
+			stats.Played++
+			streak++
+			if streak > stats.LongestStreak {
+				stats.LongestStreak = streak
+			}
+		case OutcomeWithdrew:
+			stats.Withdrawals++
+			streak = 0
+		case OutcomeNoShow:
+			stats.NoShows++
+			streak = 0
+		default:
+			streak = 0
+		}
+
+		date := tournament.Metadata.OpenedAt.In(location)
+		days[date.Weekday()]++
+		stats.History = append([]Entry{{Date: date, Outcome: outcome}}, stats.History...)
+	}
+
+	stats.CurrentStreak = streak
+	stats.FavouriteDay = favourite(days)
+	return stats
+}
+
+// Outcome tells how an archived entry ended, empty for players who checked out while registration was open
+func Outcome(player types.Player) string {
+	switch {
+	case player.Withdrawn:
+		return OutcomeWithdrew
+	case player.State == types.StateCheckedOut:
+		return ""
+	case player.NoShow:
+		return OutcomeNoShow
+	case player.State == types.StateInTournament:
+		return OutcomePlayed
+	default:
+		return OutcomeWaited
+	}
+}
+
+func find(players []types.Player, id int) (types.Player, bool) {
+	for _, player := range players {
+		if player.ID == id {
+			return player, true
+		}
+	}
+	return types.Player{}, false
+}
+
+// favourite picks the weekday with the most entries, ties go to the earlier day of the week starting on monday
+func favourite(days map[time.Weekday]int) time.Weekday {
+	best := time.Monday
+	for i := 0; i < 7; i++ {
+		day := time.Weekday((int(time.Monday) + i) % 7)
+		if days[day] > days[best] {
+			best = day
+		}
+	}
+	return best
+}
@@ -0,0 +1,173 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// tournament opens on the given day of october 2026, the 5th is a monday
+func tournament(day int, players ...types.Player) Tournament {
+	return Tournament{
+		Metadata: types.TournamentMetadata{OpenedAt: time.Date(2026, time.October, day, 9, 0, 0, 0, time.UTC)},
+		Players:  players,
+	}
+}
+
+func TestForPlayer(t *testing.T) {
+	played := types.Player{ID: 1, State: types.StateInTournament}
+	other := types.Player{ID: 2, State: types.StateInTournament}
+
+	tournaments := []Tournament{
+		// given out of order on purpose
+		tournament(12, types.Player{ID: 1, State: types.StateInTournament, Queued: true, Promoted: true}),
+		tournament(5, played),
+		tournament(6, played),
+		tournament(7, other),
+		tournament(8, types.Player{ID: 1, State: types.StateQueued, Queued: true}),
+		tournament(9, types.Player{ID: 1, State: types.StateCheckedOut, Withdrawn: true}),
+		tournament(13, types.Player{ID: 1, State: types.StateInTournament, NoShow: true}),
+		tournament(14, types.Player{ID: 1, State: types.StateCheckedOut}),
+		tournament(19, played),
+		tournament(20, played),
+	}
+
+	got := ForPlayer(1, tournaments, time.UTC)
+
+	want := Player{
+		Entered:       8,
+		Played:        5,
+		Queued:        2,
+		Promoted:      1,
+		Withdrawals:   1,
+		NoShows:       1,
+		FavouriteDay:  time.Monday,
+		CurrentStreak: 2,
+		LongestStreak: 2,
+	}
+	got.History = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ForPlayer = %+v, want %+v", got, want)
+	}
+}
+
+func TestForPlayerHistory(t *testing.T) {
+	tournaments := []Tournament{
+		tournament(5, types.Player{ID: 1, State: types.StateInTournament}),
+		tournament(6, types.Player{ID: 1, State: types.StateQueued}),
+		tournament(7, types.Player{ID: 1, State: types.StateCheckedOut, Withdrawn: true}),
+	}
+
+	got := ForPlayer(1, tournaments, time.UTC).History
+	want := []string{OutcomeWithdrew, OutcomeWaited, OutcomePlayed}
+	if len(got) != len(want) {
+		t.Fatalf("history has %d entries, want %d", len(got), len(want))
+	}
+	for i, entry := range got {
+		if entry.Outcome != want[i] {
+			t.Errorf("entry %d outcome = %s, want %s", i, entry.Outcome, want[i])
+		}
+	}
+	if got[0].Date.Day() != 7 {
+		t.Errorf("newest entry is from day %d, want 7", got[0].Date.Day())
+	}
+}
+
+func TestForPlayerNoEntries(t *testing.T) {
+	got := ForPlayer(1, []Tournament{tournament(5, types.Player{ID: 2, State: types.StateInTournament})}, time.UTC)
+	if got.Entered != 0 || got.CurrentStreak != 0 || len(got.History) != 0 {
+		t.Errorf("ForPlayer = %+v, want no entries", got)
+	}
+}
+
+func TestFavouriteDayUsesLocation(t *testing.T) {
+	// 22:00 utc on sunday is already monday in moscow
+	moscow := time.FixedZone("MSK", 3*60*60)
+	late := Tournament{
+		Metadata: types.TournamentMetadata{OpenedAt: time.Date(2026, time.October, 11, 22, 0, 0, 0, time.UTC)},
+		Players:  []types.Player{{ID: 1, State: types.StateInTournament}},
+	}
+
+	if got := ForPlayer(1, []Tournament{late}, moscow).FavouriteDay; got != time.Monday {
+		t.Errorf("FavouriteDay = %s, want Monday", got)
+	}
+	if got := ForPlayer(1, []Tournament{late}, time.UTC).FavouriteDay; got != time.Sunday {
+		t.Errorf("FavouriteDay = %s, want Sunday", got)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	opened := time.Date(2026, time.October, 5, 12, 0, 0, 0, time.UTC)
+	full := opened.Add(90 * time.Minute)
+
+	got := Summarize(Tournament{
+		Metadata: types.TournamentMetadata{Limit: 2, OpenedAt: opened, FullAt: &full, CheckOuts: 3},
+		Players: []types.Player{
+			{ID: 1, State: types.StateInTournament},
+			{ID: 2, State: types.StateInTournament, Queued: true, Promoted: true},
+			{ID: 3, State: types.StateQueued, Queued: true},
+			{ID: 4, State: types.StateCheckedOut, Withdrawn: true},
+		},
+	})
+
+	if got.Entries != 6 || got.Seated != 2 || got.Queue != 1 || got.Waited != 2 || got.CheckOuts != 3 {
+		t.Errorf("Summarize = %+v", got)
+	}
+	if got.TimeToFull != 90*time.Minute {
+		t.Errorf("TimeToFull = %v, want 1h30m", got.TimeToFull)
+	}
+	if got.FillRate() != 1 {
+		t.Errorf("FillRate = %v, want 1", got.FillRate())
+	}
+	if got.CheckOutRate() != 0.5 {
+		t.Errorf("CheckOutRate = %v, want 0.5", got.CheckOutRate())
+	}
+}
+
+func TestSummarizeLegacyArchive(t *testing.T) {
+	// archives from before check-outs were counted still show the players who stayed checked out
+	got := Summarize(Tournament{Players: []types.Player{
+		{ID: 1, State: types.StateInTournament},
+		{ID: 2, State: types.StateCheckedOut},
+	}})
+
+	if got.Entries != 2 || got.CheckOuts != 1 || got.TimeToFull != 0 || got.FillRate() != 0 {
+		t.Errorf("Summarize = %+v", got)
+	}
+}
+
+func TestParseDay(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	now := time.Date(2026, time.October, 18, 15, 0, 0, 0, moscow)
+
+	tests := []struct {
+		text   string
+		want   time.Time
+		wantOK bool
+	}{
+		{"05.10", time.Date(2026, time.October, 5, 0, 0, 0, 0, moscow), true},
+		{"05.10.2025", time.Date(2025, time.October, 5, 0, 0, 0, 0, moscow), true},
+		{"29.02.2028", time.Date(2028, time.February, 29, 0, 0, 0, 0, moscow), true},
+		// 2026 is not a leap year, the day must not roll over to 01.03
+		{"29.02", time.Time{}, false},
+		{"29.02.2027", time.Time{}, false},
+		{"31.04", time.Time{}, false},
+		{"5.10", time.Time{}, false},
+		{"вчера", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, ok := ParseDay(tt.text, now)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("ParseDay(%s) = %v, %v, want %v, %v", tt.text, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	leap := time.Date(2028, time.January, 10, 12, 0, 0, 0, moscow)
+	if got, ok := ParseDay("29.02", leap); !ok || got.Month() != time.February || got.Day() != 29 {
+		t.Errorf("ParseDay(29.02) in a leap year = %v, %v, want 29 february", got, ok)
+	}
+}
@@ -0,0 +1,82 @@
+package tournament
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/announce"
+	"github.com/sukalov/mshkbot/internal/render"
+)
+
+// ErrAnnouncementGone is returned by a publisher when the announcement message no longer exists
+var ErrAnnouncementGone = announce.ErrGone
+
+// DefaultAnnouncementIntro is shown when the tournament has no intro of its own
+const DefaultAnnouncementIntro = "ТУРНИР НАЧАЛСЯ!!!"
+
+// AnnouncementMode is the parse mode announcements and their templates are written in
+const AnnouncementMode = render.HTML
+
+// AnnouncementPublisher delivers the rendered announcement to the chat
+type AnnouncementPublisher = announce.Publisher
+
+// SetAnnouncementPublisher enables debounced announcement rendering
+func (tm *TournamentManager) SetAnnouncementPublisher(publisher AnnouncementPublisher, interval time.Duration) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.announcer = announce.New(publisher, announcementSource{tm}, interval)
+}
+
+// MarkAnnouncementDirty asks for the announcement to be re-rendered soon
+func (tm *TournamentManager) MarkAnnouncementDirty() {
+	tm.mu.RLock()
+	a := tm.announcer
+	tm.mu.RUnlock()
+	if a != nil {
+		a.MarkDirty()
+	}
+}
+
+// AnnouncementText renders the current announcement with the tournament template
+func (tm *TournamentManager) AnnouncementText() string {
+	tm.mu.RLock()
+	intro := tm.Metadata.AnnouncementIntro
+	if intro == "" {
+		intro = DefaultAnnouncementIntro
+	}
+	custom := tm.Metadata.AnnouncementTemplate
+	data := render.NewAnnouncement(AnnouncementMode, intro, tm.Metadata.Limit, tm.List)
+	tm.mu.RUnlock()
+
+	text, err := render.RenderAnnouncement(AnnouncementMode, custom, data)
+	if err != nil && custom != "" {
+		// templates are checked when saved, but never leave the chat without a list
+		fmt.Printf("error happened while rendering the announcement template: %s\n", err)
+		text, err = render.RenderAnnouncement(AnnouncementMode, "", data)
+	}
+	if err != nil {
+		fmt.Printf("error happened while rendering the announcement: %s\n", err)
+	}
+	return text
+}
+
+// announcementSource lets the announcer read the tournament without knowing about redis
+type announcementSource struct {
+	tm *TournamentManager
+}
+
+func (s announcementSource) Current() (string, int) {
+	s.tm.mu.RLock()
+	exists := s.tm.Metadata.Exists
+	messageID := s.tm.Metadata.AnnouncementMessageID
+	s.tm.mu.RUnlock()
+	if !exists || messageID == 0 {
+		return "", 0
+	}
+	return s.tm.AnnouncementText(), messageID
+}
+
+func (s announcementSource) Reposted(messageID int) error {
+	return s.tm.SetAnnouncementMessageID(context.Background(), messageID)
+}
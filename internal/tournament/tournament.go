@@ -3,17 +3,31 @@ package tournament
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/sukalov/mshkbot/internal/announce"
 	"github.com/sukalov/mshkbot/internal/redis"
 	"github.com/sukalov/mshkbot/internal/types"
 )
 
+// ErrAlreadyInList is returned by AddPlayer when the player is in the list and has not checked out
+var ErrAlreadyInList = errors.New("player is already in the list")
+
+// ErrNotInList is returned when the player is not in the list at all
+var ErrNotInList = errors.New("player is not in the list")
+
+// ErrPlayerMoved is returned when a player left the state the caller acted on, e.g. checked out meanwhile
+var ErrPlayerMoved = errors.New("player state changed")
+
 type TournamentManager struct {
-	mu       sync.RWMutex
-	List     []types.Player
-	Metadata types.TournamentMetadata
+	mu        sync.RWMutex
+	List      []types.Player
+	Metadata  types.TournamentMetadata
+	announcer *announce.Announcer
 }
 
 type ByTimeAdded []types.Player
@@ -47,30 +61,66 @@ func (tm *TournamentManager) Init() error {
 	return nil
 }
 
-func (tm *TournamentManager) AddPlayer(ctx context.Context, player types.Player) error {
+// AddPlayer appends a player to the list and returns them as stored. a player who comes in the tournament
+// state goes to the queue when no seat is free, the seat is decided here so simultaneous check-ins can't
+// all take the last one. a player with id 0 is a guest without telegram and gets a guest id here as well,
+// a guest with the name of one already in the list is refused like a second check-in
+func (tm *TournamentManager) AddPlayer(ctx context.Context, player types.Player) (types.Player, error) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
+	guest := player.ID == 0
+	for _, existing := range tm.List {
+		if existing.State == types.StateCheckedOut {
+			continue
+		}
+		if existing.ID == player.ID || guest && existing.IsGuest() && strings.EqualFold(existing.SavedName, player.SavedName) {
+			return existing, ErrAlreadyInList
+		}
+	}
+	if guest {
+		player.ID = tm.nextGuestID()
+	}
+	if player.State == types.StateInTournament && !tm.hasSeat() {
+		player.State = types.StateQueued
+	}
+	track("", &player)
 	tm.List = append(tm.List, player)
 	if err := redis.SetList(ctx, tm.List); err != nil {
 		fmt.Printf("error happened while adding to redis list: %s", err)
-		return err
+		// the caller reports the check-in as failed, it must not linger in the list
+		tm.List = tm.List[:len(tm.List)-1]
+		return player, err
 	}
-	return nil
+	// the player is stored, missing the time the tournament filled up only affects the stats
+	_ = tm.noteFull(ctx)
+	return player, nil
+}
+
+// nextGuestID picks a negative id below every id in the list, telegram user ids are positive
+func (tm *TournamentManager) nextGuestID() int {
+	id := -1
+	for _, player := range tm.List {
+		if player.ID <= id {
+			id = player.ID - 1
+		}
+	}
+	return id
 }
 
-func (tm *TournamentManager) CreateTournament(ctx context.Context, limit int, lichessRatingLimit int, chesscomRatingLimit int, announcementIntro string) error {
+func (tm *TournamentManager) CreateTournament(ctx context.Context, metadata types.TournamentMetadata) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 	if tm.Metadata.Exists {
 		return fmt.Errorf("tournament already exists")
 	}
-	tm.Metadata = types.TournamentMetadata{
-		Limit:               limit,
-		LichessRatingLimit:  lichessRatingLimit,
-		ChesscomRatingLimit: chesscomRatingLimit,
-		AnnouncementIntro:   announcementIntro,
-		Exists:              true,
+	metadata.AnnouncementMessageID = 0
+	metadata.Exists = true
+	if metadata.ID == "" {
+		metadata.ID = time.Now().UTC().Format("20060102-1504")
 	}
+	metadata.Phase = types.PhaseOpen
+	metadata.OpenedAt = time.Now().UTC()
+	tm.Metadata = metadata
 	if err := redis.SetMetadata(ctx, tm.Metadata); err != nil {
 		fmt.Printf("error happened while saving metadata to redis: %s", err)
 		return err
@@ -88,6 +138,7 @@ func (tm *TournamentManager) RemoveTournament(ctx context.Context) error {
 		Limit:                 0,
 		LichessRatingLimit:    0,
 		ChesscomRatingLimit:   0,
+		OTBRatingLimit:        0,
 		AnnouncementMessageID: 0,
 		AnnouncementIntro:     "",
 		Exists:                false,
@@ -108,6 +159,7 @@ func (tm *TournamentManager) removeTournament(ctx context.Context) error {
 		Limit:                 0,
 		LichessRatingLimit:    0,
 		ChesscomRatingLimit:   0,
+		OTBRatingLimit:        0,
 		AnnouncementMessageID: 0,
 		AnnouncementIntro:     "",
 		Exists:                false,
@@ -137,12 +189,13 @@ func (tm *TournamentManager) EditPlayer(ctx context.Context, playerID int, updat
 
 	for i, player := range tm.List {
 		if player.ID == playerID {
+			track(player.State, &updatedPlayer)
 			tm.List[i] = updatedPlayer
 			if err := redis.SetList(ctx, tm.List); err != nil {
 				fmt.Printf("error happened while updating the redis list: %s", err)
 				return err
 			}
-			return nil
+			return tm.noteFull(ctx)
 		}
 	}
 
@@ -167,6 +220,302 @@ func (tm *TournamentManager) RemovePlayer(ctx context.Context, playerID int) err
 	return fmt.Errorf("player with ID %d not found in list", playerID)
 }
 
+// SwapPlayers exchanges the places of two players in the list, which is also their order in the queue
+func (tm *TournamentManager) SwapPlayers(ctx context.Context, firstID, secondID int) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	first, second := -1, -1
+	for i, player := range tm.List {
+		switch player.ID {
+		case firstID:
+			first = i
+		case secondID:
+			second = i
+		}
+	}
+	if first == -1 || second == -1 {
+		return fmt.Errorf("players %d and %d are not both in list", firstID, secondID)
+	}
+
+	tm.List[first], tm.List[second] = tm.List[second], tm.List[first]
+	if err := redis.SetList(ctx, tm.List); err != nil {
+		fmt.Printf("error happened while updating the redis list: %s", err)
+		return err
+	}
+	return nil
+}
+
+// DemotePlayer moves a player from the tournament to the head of the queue
+func (tm *TournamentManager) DemotePlayer(ctx context.Context, playerID int) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	index := -1
+	for i, player := range tm.List {
+		if player.ID == playerID {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return fmt.Errorf("player with ID %d not found in list", playerID)
+	}
+
+	player := tm.List[index]
+	player.State = types.StateQueued
+	player.Queued = true
+	list := append(append([]types.Player{}, tm.List[:index]...), tm.List[index+1:]...)
+
+	head := len(list)
+	for i, p := range list {
+		if p.State == types.StateQueued {
+			head = i
+			break
+		}
+	}
+	list = append(list[:head], append([]types.Player{player}, list[head:]...)...)
+
+	tm.List = list
+	if err := redis.SetList(ctx, tm.List); err != nil {
+		fmt.Printf("error happened while updating the redis list: %s", err)
+		return err
+	}
+	return nil
+}
+
+// Players returns a copy of the list that stays consistent while handlers change the list
+func (tm *TournamentManager) Players() []types.Player {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return append([]types.Player(nil), tm.List...)
+}
+
+// UpdateVerified stores the result of a background rating check. checked is the state the check started
+// from, the player is skipped with ErrPlayerMoved when they are no longer in it. a pending player gets
+// a seat when one is free or a place in the queue. returns the player as stored
+func (tm *TournamentManager) UpdateVerified(ctx context.Context, playerID int, checked string, update func(*types.Player)) (types.Player, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	index := tm.indexOf(playerID)
+	if index == -1 || tm.List[index].State != checked {
+		return types.Player{}, ErrPlayerMoved
+	}
+
+	player := tm.List[index]
+	update(&player)
+	if checked == types.StatePending {
+		player.State = types.StateQueued
+		if tm.hasSeat() {
+			player.State = types.StateInTournament
+		}
+	}
+	track(checked, &player)
+	tm.List[index] = player
+	if err := redis.SetList(ctx, tm.List); err != nil {
+		fmt.Printf("error happened while updating the redis list: %s", err)
+		return player, err
+	}
+	return player, tm.noteFull(ctx)
+}
+
+// RemoveRejected drops a player a background rating check rejected. checked is the state the check
+// started from, the player is skipped with ErrPlayerMoved when they are no longer in it. when the
+// removal frees a seat the first queued player takes it and is returned
+func (tm *TournamentManager) RemoveRejected(ctx context.Context, playerID int, checked string) (*types.Player, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	index := tm.indexOf(playerID)
+	if index == -1 || tm.List[index].State != checked {
+		return nil, ErrPlayerMoved
+	}
+	tm.List = append(tm.List[:index], tm.List[index+1:]...)
+
+	var promoted *types.Player
+	if checked == types.StateInTournament {
+		promoted = tm.promoteFirst()
+	}
+	if err := redis.SetList(ctx, tm.List); err != nil {
+		fmt.Printf("error happened while updating the redis list: %s", err)
+		return nil, err
+	}
+	return promoted, nil
+}
+
+// indexOf finds a player in the list, -1 when absent. the caller holds the lock
+func (tm *TournamentManager) indexOf(playerID int) int {
+	for i, player := range tm.List {
+		if player.ID == playerID {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasSeat tells whether a new player fits under the limit without queueing. queued players count as
+// taken places so nobody overtakes the queue. the caller holds the lock
+func (tm *TournamentManager) hasSeat() bool {
+	if tm.Metadata.Limit == 0 {
+		return true
+	}
+	taken := 0
+	for _, player := range tm.List {
+		if player.State == types.StateInTournament || player.State == types.StateQueued {
+			taken++
+		}
+	}
+	return taken < tm.Metadata.Limit
+}
+
+// promoteFirst seats the first queued player and returns them, nil when the queue is empty. the caller
+// holds the lock and saves the list
+func (tm *TournamentManager) promoteFirst() *types.Player {
+	for i, player := range tm.List {
+		if player.State == types.StateQueued {
+			tm.List[i].State = types.StateInTournament
+			tm.List[i].Promoted = true
+			promoted := tm.List[i]
+			return &promoted
+		}
+	}
+	return nil
+}
+
+// CheckOut marks a player as checked out and returns them as they were before. only the call that
+// actually checked the player out frees their seat: the first queued player takes it and is returned.
+// a player who had already checked out is returned unchanged
+func (tm *TournamentManager) CheckOut(ctx context.Context, playerID int, withdrawn bool) (previous types.Player, promoted *types.Player, err error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	index := tm.indexOf(playerID)
+	if index == -1 {
+		return types.Player{}, nil, ErrNotInList
+	}
+	previous = tm.List[index]
+	if previous.State == types.StateCheckedOut {
+		return previous, nil, nil
+	}
+
+	tm.List[index].State = types.StateCheckedOut
+	tm.List[index].CheckedOutTime = time.Now().UTC()
+	tm.List[index].Withdrawn = withdrawn
+	if previous.State == types.StateInTournament {
+		promoted = tm.promoteFirst()
+	}
+	if err := redis.SetList(ctx, tm.List); err != nil {
+		fmt.Printf("error happened while updating the redis list: %s", err)
+		return previous, nil, err
+	}
+	return previous, promoted, nil
+}
+
+// PromoteQueuedPlayer moves the first queued player into the tournament and returns them
+func (tm *TournamentManager) PromoteQueuedPlayer(ctx context.Context) (*types.Player, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	promoted := tm.promoteFirst()
+	if promoted == nil {
+		return nil, nil
+	}
+	if err := redis.SetList(ctx, tm.List); err != nil {
+		fmt.Printf("error happened while updating the redis list: %s", err)
+		return nil, err
+	}
+	return promoted, nil
+}
+
+// ApplyLimit sets the player limit and rebalances the list to it. when there is room queued players
+// are promoted in order, when there are too many players the latest entrants go back to the head of
+// the queue keeping their order. a limit of 0 means no limit
+func (tm *TournamentManager) ApplyLimit(ctx context.Context, limit int) (promoted, demoted []types.Player, err error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	seated := 0
+	for _, player := range tm.List {
+		if player.State == types.StateInTournament {
+			seated++
+		}
+	}
+
+	list := append([]types.Player{}, tm.List...)
+
+	if limit > 0 && seated > limit {
+		// the overflow are the last seated players, walk from the end to find them
+		overflow := seated - limit
+		for i := len(list) - 1; i >= 0 && overflow > 0; i-- {
+			if list[i].State == types.StateInTournament {
+				list[i].State = types.StateQueued
+				list[i].Queued = true
+				demoted = append([]types.Player{list[i]}, demoted...)
+				overflow--
+			}
+		}
+		var kept []types.Player
+		for _, player := range list {
+			if !containsPlayer(demoted, player.ID) {
+				kept = append(kept, player)
+			}
+		}
+
+		head := len(kept)
+		for i, player := range kept {
+			if player.State == types.StateQueued {
+				head = i
+				break
+			}
+		}
+		list = append(append(append([]types.Player{}, kept[:head]...), demoted...), kept[head:]...)
+	} else {
+		for i, player := range list {
+			if limit > 0 && seated >= limit {
+				break
+			}
+			if player.State == types.StateQueued {
+				list[i].State = types.StateInTournament
+				list[i].Promoted = true
+				promoted = append(promoted, list[i])
+				seated++
+			}
+		}
+	}
+
+	tm.List = list
+	tm.Metadata.Limit = limit
+	if err := redis.SetList(ctx, tm.List); err != nil {
+		fmt.Printf("error happened while updating the redis list: %s", err)
+		return nil, nil, err
+	}
+	if err := redis.SetMetadata(ctx, tm.Metadata); err != nil {
+		fmt.Printf("error happened while updating the redis metadata: %s", err)
+		return nil, nil, err
+	}
+	return promoted, demoted, nil
+}
+
+// track records the queue history of a player whose state changes from previous, it ends up in the archive
+func track(previous string, player *types.Player) {
+	if player.State == types.StateQueued {
+		player.Queued = true
+	}
+	if previous == types.StateQueued && player.State == types.StateInTournament {
+		player.Promoted = true
+	}
+}
+
+func containsPlayer(players []types.Player, id int) bool {
+	for _, player := range players {
+		if player.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
 func (tm *TournamentManager) Sync(ctx context.Context) error {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
@@ -234,6 +583,102 @@ func (tm *TournamentManager) SetChesscomRatingLimit(ctx context.Context, ratingL
 	return nil
 }
 
+func (tm *TournamentManager) SetOTBRatingLimit(ctx context.Context, ratingLimit int) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.Metadata.OTBRatingLimit = ratingLimit
+	if err := redis.SetMetadata(ctx, tm.Metadata); err != nil {
+		fmt.Printf("error happened while updating the redis metadata: %s", err)
+		return err
+	}
+	return nil
+}
+
+func (tm *TournamentManager) SetUnverifiedPolicy(ctx context.Context, policy string) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.Metadata.UnverifiedPolicy = policy
+	if err := redis.SetMetadata(ctx, tm.Metadata); err != nil {
+		fmt.Printf("error happened while updating the redis metadata: %s", err)
+		return err
+	}
+	return nil
+}
+
+// DropAnnouncementTemplate switches the tournament back to the default announcement template
+func (tm *TournamentManager) DropAnnouncementTemplate(ctx context.Context) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.Metadata.AnnouncementTemplate = ""
+	if err := redis.SetMetadata(ctx, tm.Metadata); err != nil {
+		fmt.Printf("error happened while updating the redis metadata: %s", err)
+		return err
+	}
+	return nil
+}
+
+// RecordCheckOut counts a check-out for the reports
+func (tm *TournamentManager) RecordCheckOut(ctx context.Context) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.Metadata.CheckOuts++
+	if err := redis.SetMetadata(ctx, tm.Metadata); err != nil {
+		fmt.Printf("error happened while updating the redis metadata: %s", err)
+		return err
+	}
+	return nil
+}
+
+// RecordRejection counts a refused check-in by its reason for the reports
+func (tm *TournamentManager) RecordRejection(ctx context.Context, reason string) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if tm.Metadata.Rejections == nil {
+		tm.Metadata.Rejections = make(map[string]int)
+	}
+	tm.Metadata.Rejections[reason]++
+	if err := redis.SetMetadata(ctx, tm.Metadata); err != nil {
+		fmt.Printf("error happened while updating the redis metadata: %s", err)
+		return err
+	}
+	return nil
+}
+
+// noteFull stores when the last place was first taken. the caller holds the lock
+func (tm *TournamentManager) noteFull(ctx context.Context) error {
+	if tm.Metadata.Limit == 0 || tm.Metadata.FullAt != nil {
+		return nil
+	}
+	seated := 0
+	for _, player := range tm.List {
+		if player.State == types.StateInTournament {
+			seated++
+		}
+	}
+	if seated < tm.Metadata.Limit {
+		return nil
+	}
+	now := time.Now().UTC()
+	tm.Metadata.FullAt = &now
+	if err := redis.SetMetadata(ctx, tm.Metadata); err != nil {
+		fmt.Printf("error happened while updating the redis metadata: %s", err)
+		return err
+	}
+	return nil
+}
+
+// SetPhase moves the tournament to another phase
+func (tm *TournamentManager) SetPhase(ctx context.Context, phase string) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.Metadata.Phase = phase
+	if err := redis.SetMetadata(ctx, tm.Metadata); err != nil {
+		fmt.Printf("error happened while updating the redis metadata: %s", err)
+		return err
+	}
+	return nil
+}
+
 func (tm *TournamentManager) SetAnnouncementMessageID(ctx context.Context, messageID int) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
@@ -10,32 +10,165 @@ type PeakRating struct {
 	SiteUsername string `json:"site_username"`
 }
 
+type OTBRating struct {
+	Source   string `json:"source"`
+	ID       string `json:"id"`
+	Standard int    `json:"standard"`
+	Rapid    int    `json:"rapid"`
+	Blitz    int    `json:"blitz"`
+}
+
 type Player struct {
-	ID               int         `json:"id"`
-	Username         string      `json:"username"`
-	SavedName        string      `json:"saved_name"`
-	TimeAdded        time.Time   `json:"time_added"`
-	State            string      `json:"state"`
-	CheckedOutTime   time.Time   `json:"checked_out_time,omitempty"`
-	PeakRating       *PeakRating `json:"peak_rating,omitempty"`
-	CheckinMessageID int         `json:"checkin_message_id,omitempty"`
-	CheckinChatID    int64       `json:"checkin_chat_id,omitempty"`
+	ID               int          `json:"id"`
+	Username         string       `json:"username"`
+	SavedName        string       `json:"saved_name"`
+	TimeAdded        time.Time    `json:"time_added"`
+	State            string       `json:"state"`
+	CheckedOutTime   time.Time    `json:"checked_out_time,omitempty"`
+	PeakRating       *PeakRating  `json:"peak_rating,omitempty"`
+	OTBRating        *OTBRating   `json:"otb_rating,omitempty"`
+	Eligibility      *Eligibility `json:"eligibility,omitempty"`
+	Unverified       bool         `json:"unverified,omitempty"`
+	CheckinMessageID int          `json:"checkin_message_id,omitempty"`
+	CheckinChatID    int64        `json:"checkin_chat_id,omitempty"`
+	// Withdrawn marks players who checked out after registration closed
+	Withdrawn bool `json:"withdrawn,omitempty"`
+	// Queued marks players who waited in the queue at some point, Promoted those who got a place from it
+	Queued   bool `json:"queued,omitempty"`
+	Promoted bool `json:"promoted,omitempty"`
+	// NoShow marks players the arbiters recorded as not coming to the tournament
+	NoShow bool `json:"no_show,omitempty"`
+}
+
+// IsGuest tells players added by admins without telegram, they get negative ids
+func (p Player) IsGuest() bool {
+	return p.ID < 0
 }
 
 const (
 	StateInTournament = "in_tournament"
 	StateQueued       = "queued"
 	StateCheckedOut   = "checked_out"
+	StatePending      = "pending_verification"
 )
 
 const SiteLichess = "lichess"
 const SiteChesscom = "chesscom"
+const SiteFide = "fide"
+const SiteRcf = "rcf"
+
+// SiteCheck is the result of checking one rating source during check-in
+type SiteCheck struct {
+	Site      string `json:"site"`
+	Username  string `json:"username"`
+	Blitz     int    `json:"blitz"`
+	Rapid     int    `json:"rapid"`
+	Classical int    `json:"classical"`
+	Limit     int    `json:"limit"`
+	Exceeded  bool   `json:"exceeded"`
+	Error     string `json:"error,omitempty"`
+	// Unrated marks an otb id missing from the loaded rating list, the player has no rating there
+	Unrated bool `json:"unrated,omitempty"`
+}
+
+type EligibilityLimits struct {
+	Lichess  int  `json:"lichess"`
+	Chesscom int  `json:"chesscom"`
+	OTB      int  `json:"otb"`
+	Green    bool `json:"green"`
+}
+
+// Eligibility is the evidence a check-in decision was based on
+type Eligibility struct {
+	CheckedAt     time.Time         `json:"checked_at"`
+	Limits        EligibilityLimits `json:"limits"`
+	Sites         []SiteCheck       `json:"sites"`
+	NotGreenUntil *time.Time        `json:"not_green_until,omitempty"`
+	Decision      string            `json:"decision"`
+	Reason        string            `json:"reason,omitempty"`
+}
+
+const (
+	DecisionAdmitted   = "admitted"
+	DecisionRejected   = "rejected"
+	DecisionUnverified = "unverified"
+)
+
+// policies for players whose ratings could not be checked because a rating site is down
+const (
+	UnverifiedAllow   = "allow"
+	UnverifiedPending = "pending"
+	UnverifiedReject  = "reject"
+)
+
+const (
+	ReasonNotGreen      = "not_green"
+	ReasonLichessLimit  = "lichess_limit"
+	ReasonChesscomLimit = "chesscom_limit"
+	ReasonFideLimit     = "fide_limit"
+	ReasonRcfLimit      = "rcf_limit"
+
+	ReasonRatingUnavailable = "rating_unavailable"
+)
+
+// tournament phases: planned in advance, open for check-in, closed once it starts, finished when archived
+const (
+	PhaseScheduled = "scheduled"
+	PhaseOpen      = "open"
+	PhaseClosed    = "closed"
+	PhaseFinished  = "finished"
+)
 
 type TournamentMetadata struct {
+	// ID tells tournaments apart, e.g. in /start links. it's the creation time, yyyymmdd-hhmm
+	ID                    string `json:"id,omitempty"`
 	Limit                 int    `json:"limit"`
 	LichessRatingLimit    int    `json:"lichess_rating_limit"`
 	ChesscomRatingLimit   int    `json:"chesscom_rating_limit"`
+	OTBRatingLimit        int    `json:"otb_rating_limit"`
 	AnnouncementMessageID int    `json:"announcement_message_id"`
 	AnnouncementIntro     string `json:"announcement_intro"`
-	Exists                bool   `json:"exists"`
+	AnnouncementTemplate  string `json:"announcement_template,omitempty"`
+	UnverifiedPolicy      string `json:"unverified_policy,omitempty"`
+	Phase                 string `json:"phase,omitempty"`
+	// EventID is the schedule event the tournament was opened for, empty for one-off tournaments
+	EventID string `json:"event_id,omitempty"`
+	// OpenedAt is when registration opened
+	OpenedAt time.Time `json:"opened_at"`
+	// StartsAt closes registration, nil when it stays open until the end
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	// CloseAt ends and archives the tournament, nil when it is ended by hand
+	CloseAt *time.Time `json:"close_at,omitempty"`
+	// FullAt is when the last place was first taken, nil while places are free or without a limit
+	FullAt *time.Time `json:"full_at,omitempty"`
+	// CheckOuts counts check-outs, players who left while registration was open are gone from the list by the end
+	CheckOuts int `json:"check_outs,omitempty"`
+	// Rejections counts refused check-ins by reason
+	Rejections map[string]int `json:"rejections,omitempty"`
+	Exists     bool           `json:"exists"`
+}
+
+// CurrentPhase is the phase of the tournament. tournaments saved before phases existed are open
+func (m TournamentMetadata) CurrentPhase() string {
+	if m.Phase == "" && m.Exists {
+		return PhaseOpen
+	}
+	return m.Phase
+}
+
+// subscription topics: every tournament, green tournaments, or tournaments of one schedule event
+const (
+	TopicAll   = "all"
+	TopicGreen = "green"
+)
+
+// EventTopic is the subscription topic of a schedule event
+func EventTopic(eventID string) string {
+	return "event_" + eventID
+}
+
+// PlannedTournament is a tournament created in advance that opens at OpenAt
+type PlannedTournament struct {
+	OpenAt   time.Time          `json:"open_at"`
+	Metadata TournamentMetadata `json:"metadata"`
 }
@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// OTBRatings holds over-the-board ratings of a single player from a rating list
+type OTBRatings struct {
+	Name     string
+	Standard int
+	Rapid    int
+	Blitz    int
+}
+
+var (
+	fideRatings = map[string]OTBRatings{}
+	rcfRatings  = map[string]OTBRatings{}
+	otbMu       sync.RWMutex
+)
+
+// LoadFideList loads the downloadable fide rating list (players_list_xml_foa.xml)
+func LoadFideList(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open fide list: %w", err)
+	}
+	defer file.Close()
+
+	ratings, err := ParseFideList(file)
+	if err != nil {
+		return 0, err
+	}
+
+	otbMu.Lock()
+	defer otbMu.Unlock()
+	fideRatings = ratings
+	return len(ratings), nil
+}
+
+// LoadRcfList loads the russian chess federation rating list exported as csv
+func LoadRcfList(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open rcf list: %w", err)
+	}
+	defer file.Close()
+
+	ratings, err := ParseRcfList(file)
+	if err != nil {
+		return 0, err
+	}
+
+	otbMu.Lock()
+	defer otbMu.Unlock()
+	rcfRatings = ratings
+	return len(ratings), nil
+}
+
+// ParseFideList streams the fide xml list and indexes players by fide id
+func ParseFideList(r io.Reader) (map[string]OTBRatings, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		switch strings.ToLower(charset) {
+		case "iso-8859-1", "latin1":
+			return latin1Reader{input}, nil
+		}
+		return nil, fmt.Errorf("unsupported charset: %s", charset)
+	}
+	ratings := make(map[string]OTBRatings)
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse fide list: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "player" {
+			continue
+		}
+
+		var player struct {
+			FideID      string `xml:"fideid"`
+			Name        string `xml:"name"`
+			Rating      int    `xml:"rating"`
+			RapidRating int    `xml:"rapid_rating"`
+			BlitzRating int    `xml:"blitz_rating"`
+		}
+		if err := decoder.DecodeElement(&player, &start); err != nil {
+			return nil, fmt.Errorf("failed to parse fide player: %w", err)
+		}
+
+		id := strings.TrimSpace(player.FideID)
+		if id == "" {
+			continue
+		}
+		ratings[id] = OTBRatings{
+			Name:     strings.TrimSpace(player.Name),
+			Standard: player.Rating,
+			Rapid:    player.RapidRating,
+			Blitz:    player.BlitzRating,
+		}
+	}
+
+	return ratings, nil
+}
+
+// latin1Reader converts iso-8859-1 bytes to utf-8, the encoding fide publishes its lists in
+type latin1Reader struct {
+	r io.Reader
+}
+
+func (l latin1Reader) Read(p []byte) (int, error) {
+	// every latin-1 byte takes at most two bytes in utf-8
+	if len(p) < 2 {
+		return 0, io.ErrShortBuffer
+	}
+	buf := make([]byte, len(p)/2)
+	n, err := l.r.Read(buf)
+	written := 0
+	for _, c := range buf[:n] {
+		written += utf8.EncodeRune(p[written:], rune(c))
+	}
+	return written, err
+}
+
+// ParseRcfList reads a csv with a header row containing id, name, standard, rapid and blitz columns.
+// both comma and semicolon separated files are accepted
+func ParseRcfList(r io.Reader) (map[string]OTBRatings, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rcf list: %w", err)
+	}
+
+	reader := csv.NewReader(strings.NewReader(string(data)))
+	firstLine, _, _ := strings.Cut(string(data), "\n")
+	if strings.Count(firstLine, ";") > strings.Count(firstLine, ",") {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rcf list header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	idColumn, ok := columns["id"]
+	if !ok {
+		return nil, fmt.Errorf("rcf list has no id column")
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	number := func(record []string, name string) int {
+		n, _ := strconv.Atoi(field(record, name))
+		return n
+	}
+
+	ratings := make(map[string]OTBRatings)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse rcf list: %w", err)
+		}
+		if idColumn >= len(record) {
+			continue
+		}
+
+		id := strings.TrimSpace(record[idColumn])
+		if id == "" {
+			continue
+		}
+		ratings[id] = OTBRatings{
+			Name:     field(record, "name"),
+			Standard: number(record, "standard"),
+			Rapid:    number(record, "rapid"),
+			Blitz:    number(record, "blitz"),
+		}
+	}
+
+	return ratings, nil
+}
+
+// GetFideRatings looks up a player in the loaded fide list
+func GetFideRatings(fideID string) (OTBRatings, bool) {
+	otbMu.RLock()
+	defer otbMu.RUnlock()
+	ratings, ok := fideRatings[strings.TrimSpace(fideID)]
+	return ratings, ok
+}
+
+// GetRcfRatings looks up a player in the loaded rcf list
+func GetRcfRatings(rcfID string) (OTBRatings, bool) {
+	otbMu.RLock()
+	defer otbMu.RUnlock()
+	ratings, ok := rcfRatings[strings.TrimSpace(rcfID)]
+	return ratings, ok
+}
+
+// FideListLoaded reports whether a fide list has been loaded
+func FideListLoaded() bool {
+	otbMu.RLock()
+	defer otbMu.RUnlock()
+	return len(fideRatings) > 0
+}
+
+// RcfListLoaded reports whether an rcf list has been loaded
+func RcfListLoaded() bool {
+	otbMu.RLock()
+	defer otbMu.RUnlock()
+	return len(rcfRatings) > 0
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFideList(t *testing.T) {
+	list := `<?xml version="1.0" encoding="ISO-8859-1"?>
+<playerslist>
+<player><fideid>24101605</fideid><name>Ivanov, Ivan</name><country>RUS</country><rating>1850</rating><rapid_rating>1790</rapid_rating><blitz_rating>1905</blitz_rating></player>
+<player><fideid>4100018</fideid><name>Petrov, Petr</name><country>RUS</country><rating>0</rating><rapid_rating></rapid_rating><blitz_rating>1500</blitz_rating></player>
+</playerslist>`
+
+	ratings, err := ParseFideList(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("failed to parse fide list: %v", err)
+	}
+	if len(ratings) != 2 {
+		t.Fatalf("expected 2 players, got %d", len(ratings))
+	}
+	ivanov := ratings["24101605"]
+	if ivanov.Standard != 1850 || ivanov.Rapid != 1790 || ivanov.Blitz != 1905 {
+		t.Errorf("unexpected ratings: %+v", ivanov)
+	}
+	if ratings["4100018"].Blitz != 1500 {
+		t.Errorf("unexpected ratings: %+v", ratings["4100018"])
+	}
+}
+
+func TestParseRcfList(t *testing.T) {
+	list := "ID;Name;Standard;Rapid;Blitz\n12345;Иванов Иван;1650;1700;1720\n67890;Петров Пётр;;1400;\n"
+
+	ratings, err := ParseRcfList(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("failed to parse rcf list: %v", err)
+	}
+	if ratings["12345"].Blitz != 1720 || ratings["12345"].Standard != 1650 {
+		t.Errorf("unexpected ratings: %+v", ratings["12345"])
+	}
+	if ratings["67890"].Standard != 0 || ratings["67890"].Rapid != 1400 {
+		t.Errorf("unexpected ratings: %+v", ratings["67890"])
+	}
+}
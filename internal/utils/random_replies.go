@@ -27,55 +27,6 @@ func ApproveEmoji() string {
 	}
 }
 
-func AlreadyCheckedInMessage() string {
-	n := rand.Intn(4)
-
-	switch n {
-	case 0:
-		return "вы уже записаны на турнир"
-	case 1:
-		return "хватит тыкать, вы уже записаны"
-	case 2:
-		return "второй раз записаться нельзя"
-	default:
-		return "достаточно записаться один раз"
-	}
-}
-
-func CheckinUnavailibleMessage() string {
-	n := rand.Intn(5)
-
-	switch n {
-	case 0:
-		return "сейчас нелья записаться"
-	case 1:
-		return "турнир ещё не начался"
-	case 2:
-		return "попробуйте позже"
-	case 3:
-		return "ceйчас никуда не могу записать"
-	default:
-		return "сначала дождитесь объявления"
-	}
-}
-
-func NoTournamentMessage() string {
-	n := rand.Intn(5)
-
-	switch n {
-	case 0:
-		return "турнира нет пока"
-	case 1:
-		return "турнир ещё не начался"
-	case 2:
-		return "попробуйте позже"
-	case 3:
-		return "ceйчас никуда не могу записать"
-	default:
-		return "дождитесь объявления"
-	}
-}
-
 func SadEmoji() string {
 	n := rand.Intn(4)
 
@@ -55,3 +55,32 @@ func Transliterate(input string) string {
 
 	return strings.TrimSpace(result.String())
 }
+
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d",
+	'е': "e", 'ё': "e", 'ж': "zh", 'з': "z", 'и': "i",
+	'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n",
+	'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+	'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch",
+	'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+	'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+// Romanize writes cyrillic letters in latin for tools that only take latin names, the rest is kept
+func Romanize(input string) string {
+	var result strings.Builder
+
+	for _, r := range input {
+		latin, ok := cyrillicToLatin[unicode.ToLower(r)]
+		if !ok {
+			result.WriteRune(r)
+			continue
+		}
+		if unicode.IsUpper(r) && latin != "" {
+			latin = strings.ToUpper(latin[:1]) + latin[1:]
+		}
+		result.WriteString(latin)
+	}
+
+	return result.String()
+}
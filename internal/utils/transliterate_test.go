@@ -0,0 +1,19 @@
+package utils
+
+import "testing"
+
+func TestRomanize(t *testing.T) {
+	tests := map[string]string{
+		"Иван Петров":     "Ivan Petrov",
+		"щукин юрий":      "shchukin yuriy",
+		"Щукин Ёжиков":    "Shchukin Ezhikov",
+		"подъезд":         "podezd",
+		"Anna Smith":      "Anna Smith",
+		"Гость 2 (guest)": "Gost 2 (guest)",
+	}
+	for input, want := range tests {
+		if got := Romanize(input); got != want {
+			t.Errorf("Romanize(%q) = %q, want %q", input, got, want)
+		}
+	}
+}